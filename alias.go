@@ -0,0 +1,65 @@
+package conf
+
+import (
+	"fmt"
+)
+
+// Deprecation reports that an option was found under an old name registered
+// with AddAlias.
+type Deprecation struct {
+	Section   string
+	OldOption string
+	NewOption string
+	Location  Location // Where the old name was used; Line is 0 if unknown.
+}
+
+func (d Deprecation) String() string {
+	msg := fmt.Sprintf("option '%s' in section '%s' is deprecated, use '%s' instead", d.OldOption, d.Section, d.NewOption)
+	if d.Location.Line == 0 {
+		return msg
+	}
+	return d.Location.String() + ": " + msg
+}
+
+// AddAlias registers oldOption as the former name of newOption in the section,
+// so that looking up newOption finds values still configured under the old
+// name. The new name takes precedence if both are present. Several old names
+// may be registered for the same option.
+func (c *ConfigFile) AddAlias(section string, oldOption string, newOption string) {
+	if section == "" {
+		section = "default"
+	}
+	key := cacheKey{c.foldSection(section), c.foldOption(newOption)}
+
+	if c.aliases == nil {
+		c.aliases = make(map[cacheKey][]string)
+	}
+	c.aliases[key] = append(c.aliases[key], c.foldOption(oldOption))
+	c.changed()
+}
+
+// SetDeprecationHandler sets a function which is called whenever an option is
+// found under an old name registered with AddAlias, e.g. to log a warning.
+func (c *ConfigFile) SetDeprecationHandler(handler func(Deprecation)) {
+	c.deprecated = handler
+}
+
+// lookupAlias looks the option up under its old names.
+func (c *ConfigFile) lookupAlias(section string, option string) (value string, ok bool) {
+	for _, old := range c.aliases[cacheKey{section, option}] {
+		if value, ok = c.lookupEnv(section, old); !ok {
+			if value, ok = c.data[section].get(old); ok {
+				c.markUsed(section, old)
+			}
+		}
+		if ok {
+			if c.deprecated != nil {
+				loc, _ := c.data[section].location(old)
+				c.deprecated(Deprecation{section, old, option, loc})
+			}
+			return value, true
+		}
+	}
+
+	return "", false
+}
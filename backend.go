@@ -0,0 +1,121 @@
+package conf
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// Backend is a key/value store holding configuration options, such as etcd or
+// consul. Options are stored under keys of the form "prefix/section/option";
+// keys of the form "prefix/option" belong to the default section. See the
+// packages below conf/backend for implementations.
+type Backend interface {
+	// List returns the keys and values of all keys starting with prefix.
+	List(prefix string) (map[string]string, error)
+
+	// Get returns the value of a key. ok is false if the key does not exist.
+	Get(key string) (value string, ok bool, err error)
+
+	// Watch blocks until keys starting with prefix may have changed since
+	// the last List, or until stop is closed.
+	Watch(prefix string, stop <-chan bool) error
+}
+
+// ExpiringBackend is a Backend whose keys may expire, such as etcd keys
+// attached to a lease. ReadBackend sets the expiry of their options, see
+// SetExpiry.
+type ExpiringBackend interface {
+	Backend
+
+	// Expiry returns when those of the keys returned by the last List which
+	// expire do, at once rather than key by key.
+	Expiry(keys []string) (map[string]time.Time, error)
+}
+
+// ReadBackend reads the options stored below prefix in the backend and returns
+// a new configuration representation. Keys with more than one separator below
+// the prefix belong to the section named by all but their last component.
+// Sections and options are added in the order of their keys. Options of keys
+// which expire in an ExpiringBackend expire with them.
+func ReadBackend(b Backend, prefix string) (*ConfigFile, error) {
+	prefix = strings.TrimSuffix(prefix, "/") + "/"
+
+	kvs, err := b.List(prefix)
+	metrics.ConfigRead(err)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(kvs))
+	for key := range kvs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var expiries map[string]time.Time
+	if eb, ok := b.(ExpiringBackend); ok {
+		if expiries, err = eb.Expiry(keys); err != nil {
+			return nil, err
+		}
+	}
+
+	c := NewConfigFile()
+	for _, key := range keys {
+		value := kvs[key]
+		name := strings.TrimPrefix(key, prefix)
+		if name == "" || strings.HasSuffix(name, "/") {
+			continue // directory entries
+		}
+
+		section, option := DefaultSection, name
+		if i := strings.LastIndex(name, "/"); i >= 0 {
+			section, option = name[:i], name[i+1:]
+		}
+		c.AddOption(section, option, value)
+		if expires, ok := expiries[key]; ok {
+			c.SetExpiry(section, option, expires)
+		}
+	}
+
+	return c, nil
+}
+
+// WatchBackend calls fn with a freshly read configuration whenever the options
+// stored below prefix in the backend change, or with the error if watching or
+// reading them failed. fn is called from the poller's goroutine, never
+// concurrently with itself.
+func WatchBackend(b Backend, prefix string, fn func(newCfg *ConfigFile, err error)) *Poller {
+	p := &Poller{make(chan bool), make(chan bool)}
+
+	go func() {
+		defer close(p.done)
+		ReadBackend(b, prefix) // lets the backend note where to start watching
+		for {
+			err := b.Watch(strings.TrimSuffix(prefix, "/")+"/", p.stop)
+			select {
+			case <-p.stop:
+				return
+			default:
+			}
+
+			var c *ConfigFile
+			if err == nil {
+				c, err = ReadBackend(b, prefix)
+			}
+			metrics.ConfigReloaded(err)
+			if err != nil {
+				fn(nil, err)
+				select { // don't hammer a failing backend
+				case <-p.stop:
+					return
+				case <-time.After(time.Second):
+				}
+				continue
+			}
+			fn(c, nil)
+		}
+	}()
+
+	return p
+}
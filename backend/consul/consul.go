@@ -0,0 +1,139 @@
+// Package consul stores configurations in the key/value store of consul.
+//
+//	c, err := conf.ReadBackend(consul.New("http://127.0.0.1:8500"), "myapp")
+package consul
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// Backend implements conf.Backend for a consul agent.
+type Backend struct {
+	Address string       // Base URL of the agent, e.g. "http://127.0.0.1:8500".
+	Token   string       // ACL token sent with every request, if not empty.
+	Client  *http.Client // Client for requests; http.DefaultClient if nil.
+
+	mu    sync.Mutex
+	index string // Consul index of the last List, where Watch starts.
+}
+
+// New creates a backend talking to the consul agent at address.
+func New(address string) *Backend {
+	return &Backend{Address: address}
+}
+
+type pair struct {
+	Key   string
+	Value *string // base64 encoded, nil for keys without a value
+}
+
+// List returns the keys and values of all keys starting with prefix.
+func (b *Backend) List(prefix string) (map[string]string, error) {
+	pairs, index, err := b.get(context.Background(), prefix, url.Values{"recurse": {""}})
+	if err != nil {
+		return nil, err
+	}
+
+	b.mu.Lock()
+	b.index = index
+	b.mu.Unlock()
+
+	kvs := make(map[string]string, len(pairs))
+	for _, p := range pairs {
+		if kvs[p.Key], err = p.value(); err != nil {
+			return nil, err
+		}
+	}
+
+	return kvs, nil
+}
+
+// Get returns the value of a key.
+func (b *Backend) Get(key string) (value string, ok bool, err error) {
+	pairs, _, err := b.get(context.Background(), key, nil)
+	if err != nil || len(pairs) == 0 {
+		return "", false, err
+	}
+
+	value, err = pairs[0].value()
+	return value, err == nil, err
+}
+
+// Watch blocks until the index of the keys starting with prefix changes from
+// the index of the last List, or until stop is closed.
+func (b *Backend) Watch(prefix string, stop <-chan bool) error {
+	b.mu.Lock()
+	index := b.index
+	b.mu.Unlock()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	for {
+		_, i, err := b.get(ctx, prefix, url.Values{"recurse": {""}, "index": {index}, "wait": {"5m"}})
+		switch {
+		case ctx.Err() != nil:
+			return nil // stopped
+		case err != nil || i != index || index == "":
+			return err
+		}
+	}
+}
+
+func (p pair) value() (string, error) {
+	if p.Value == nil {
+		return "", nil
+	}
+	v, err := base64.StdEncoding.DecodeString(*p.Value)
+	return string(v), err
+}
+
+// get reads the pairs of a key, or of all keys starting with it if query has recurse set,
+// and returns them with the consul index of the response.
+func (b *Backend) get(ctx context.Context, key string, query url.Values) (pairs []pair, index string, err error) {
+	u := strings.TrimSuffix(b.Address, "/") + "/v1/kv/" + strings.TrimPrefix(key, "/")
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	if b.Token != "" {
+		req.Header.Set("X-Consul-Token", b.Token)
+	}
+
+	client := b.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	index = resp.Header.Get("X-Consul-Index")
+	switch resp.StatusCode {
+	case http.StatusNotFound:
+		return nil, index, nil
+	case http.StatusOK:
+		err = json.NewDecoder(resp.Body).Decode(&pairs)
+		return pairs, index, err
+	}
+	return nil, "", fmt.Errorf("consul %s: %s", key, resp.Status)
+}
@@ -0,0 +1,113 @@
+package consul
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/akrennmair/goconf"
+)
+
+// fakeConsul serves a fixed set of keys, bumping the index on every PUT.
+type fakeConsul struct {
+	mu    sync.Mutex
+	kvs   map[string]string
+	index int
+}
+
+func (f *fakeConsul) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	key := strings.TrimPrefix(r.URL.Path, "/v1/kv/")
+	if r.Method == "PUT" {
+		f.kvs[key] = r.URL.Query().Get("value")
+		f.index++
+		return
+	}
+	if r.URL.Query().Get("index") == string(rune('0'+f.index)) {
+		f.mu.Unlock()
+		time.Sleep(10 * time.Millisecond) // nothing changed, let the client retry
+		f.mu.Lock()
+	}
+
+	var pairs []pair
+	for k, v := range f.kvs {
+		if k == key || (r.URL.Query().Has("recurse") && strings.HasPrefix(k, key)) {
+			enc := base64.StdEncoding.EncodeToString([]byte(v))
+			pairs = append(pairs, pair{k, &enc})
+		}
+	}
+	w.Header().Set("X-Consul-Index", string(rune('0'+f.index)))
+	if pairs == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(pairs)
+}
+
+func TestReadBackend(t *testing.T) {
+	fake := &fakeConsul{kvs: map[string]string{
+		"myapp/host":              "example.com",
+		"myapp/service-1/port":    "443",
+		"myapp/service-1/url":     "http://%(host)s/",
+		"otherapp/service-1/port": "80",
+	}, index: 1}
+	ts := httptest.NewServer(fake)
+	defer ts.Close()
+
+	b := New(ts.URL)
+	c, err := conf.ReadBackend(b, "myapp")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if port, _ := c.GetInt("service-1", "port"); port != 443 {
+		t.Errorf("port = %d; want 443", port)
+	}
+	if url, _ := c.GetString("service-1", "url"); url != "http://example.com/" {
+		t.Errorf("url = %q; want http://example.com/", url)
+	}
+
+	if v, ok, err := b.Get("myapp/host"); err != nil || !ok || v != "example.com" {
+		t.Errorf("b.Get() = %q, %v, %v; want example.com", v, ok, err)
+	}
+	if _, ok, err := b.Get("myapp/missing"); err != nil || ok {
+		t.Errorf("b.Get() of a missing key = %v, %v; want false, nil", ok, err)
+	}
+}
+
+func TestWatchBackend(t *testing.T) {
+	fake := &fakeConsul{kvs: map[string]string{"myapp/port": "1"}, index: 1}
+	ts := httptest.NewServer(fake)
+	defer ts.Close()
+
+	configs := make(chan *conf.ConfigFile, 10)
+	p := conf.WatchBackend(New(ts.URL), "myapp", func(c *conf.ConfigFile, err error) {
+		if err != nil {
+			t.Error(err.Error())
+			return
+		}
+		configs <- c
+	})
+	defer p.Close()
+
+	time.Sleep(50 * time.Millisecond) // let the watch start
+	req, _ := http.NewRequest("PUT", ts.URL+"/v1/kv/myapp/port?value=2", nil)
+	if _, err := http.DefaultClient.Do(req); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	select {
+	case c := <-configs:
+		if port, _ := c.GetInt("", "port"); port != 2 {
+			t.Errorf("port after change = %d; want 2", port)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no configuration delivered after change")
+	}
+}
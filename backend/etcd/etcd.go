@@ -0,0 +1,260 @@
+// Package etcd stores configurations in etcd, using the JSON gateway of its v3 API.
+//
+//	c, err := conf.ReadBackend(etcd.New("http://127.0.0.1:2379"), "/myapp")
+package etcd
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Backend implements conf.Backend for an etcd cluster.
+type Backend struct {
+	Endpoint string       // Base URL of an etcd member, e.g. "http://127.0.0.1:2379".
+	Client   *http.Client // Client for requests; http.DefaultClient if nil.
+
+	mu       sync.Mutex
+	revision int64             // Revision of the last List, where Watch starts.
+	leases   map[string]string // Leases of the keys of the last List, by key.
+}
+
+// New creates a backend talking to the etcd member at endpoint.
+func New(endpoint string) *Backend {
+	return &Backend{Endpoint: endpoint}
+}
+
+type keyValue struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+	Lease string `json:"lease"` // ID of the lease the key is attached to, if any.
+}
+
+type rangeResponse struct {
+	Header struct {
+		Revision string `json:"revision"`
+	} `json:"header"`
+	Kvs []keyValue `json:"kvs"`
+}
+
+// List returns the keys and values of all keys starting with prefix.
+func (b *Backend) List(prefix string) (map[string]string, error) {
+	var resp rangeResponse
+	err := b.post(context.Background(), "/v3/kv/range", map[string]string{
+		"key":       encode(prefix),
+		"range_end": encode(prefixEnd(prefix)),
+	}, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	kvs := make(map[string]string, len(resp.Kvs))
+	leases := make(map[string]string)
+	for _, kv := range resp.Kvs {
+		key, err := decode(kv.Key)
+		if err != nil {
+			return nil, err
+		}
+		if kvs[key], err = decode(kv.Value); err != nil {
+			return nil, err
+		}
+		if kv.Lease != "" && kv.Lease != "0" {
+			leases[key] = kv.Lease
+		}
+	}
+
+	b.mu.Lock()
+	if rev, err := strconv.ParseInt(resp.Header.Revision, 10, 64); err == nil {
+		b.revision = rev
+	}
+	b.leases = leases
+	b.mu.Unlock()
+
+	return kvs, nil
+}
+
+// Get returns the value of a key.
+func (b *Backend) Get(key string) (value string, ok bool, err error) {
+	var resp rangeResponse
+	if err = b.post(context.Background(), "/v3/kv/range", map[string]string{"key": encode(key)}, &resp); err != nil {
+		return "", false, err
+	}
+	if len(resp.Kvs) == 0 {
+		return "", false, nil
+	}
+
+	value, err = decode(resp.Kvs[0].Value)
+	return value, err == nil, err
+}
+
+// Expiry returns when the leases which those of the keys returned by the last
+// List are attached to expire, implementing conf.ExpiringBackend. Each lease
+// is looked up once, however many keys are attached to it.
+func (b *Backend) Expiry(keys []string) (map[string]time.Time, error) {
+	b.mu.Lock()
+	leases := b.leases
+	b.mu.Unlock()
+
+	expiries := make(map[string]time.Time)
+	byLease := make(map[string]time.Time)
+	for _, key := range keys {
+		id, ok := leases[key]
+		if !ok {
+			continue
+		}
+		expires, ok := byLease[id]
+		if !ok {
+			var err error
+			if expires, err = b.leaseExpiry(id); err != nil {
+				return nil, err
+			}
+			byLease[id] = expires
+		}
+		expiries[key] = expires
+	}
+
+	return expiries, nil
+}
+
+// leaseExpiry returns when the lease expires.
+func (b *Backend) leaseExpiry(id string) (time.Time, error) {
+	var lease struct {
+		TTL string `json:"TTL"`
+	}
+	if err := b.post(context.Background(), "/v3/lease/timetolive", map[string]string{"ID": id}, &lease); err != nil {
+		return time.Time{}, err
+	}
+	ttl, err := strconv.ParseInt(lease.TTL, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if ttl < 0 {
+		return time.Now(), nil // expired meanwhile
+	}
+
+	return time.Now().Add(time.Duration(ttl) * time.Second), nil
+}
+
+// Watch blocks until a key starting with prefix is modified after the revision
+// of the last List, or until stop is closed.
+func (b *Backend) Watch(prefix string, stop <-chan bool) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	b.mu.Lock()
+	create := map[string]any{
+		"key":       encode(prefix),
+		"range_end": encode(prefixEnd(prefix)),
+	}
+	if b.revision > 0 {
+		create["start_revision"] = strconv.FormatInt(b.revision+1, 10)
+	}
+	b.mu.Unlock()
+
+	body, err := json.Marshal(map[string]any{"create_request": create})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", b.Endpoint+"/v3/watch", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp, err := b.client().Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil // stopped
+		}
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("etcd watch: %s", resp.Status)
+	}
+
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var msg struct {
+			Result struct {
+				Events []json.RawMessage `json:"events"`
+			} `json:"result"`
+			Error *struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if err := dec.Decode(&msg); err != nil {
+			if ctx.Err() != nil {
+				return nil // stopped
+			}
+			return err
+		}
+		if msg.Error != nil {
+			return fmt.Errorf("etcd watch: %s", msg.Error.Message)
+		}
+		if len(msg.Result.Events) > 0 {
+			return nil
+		}
+	}
+}
+
+func (b *Backend) client() *http.Client {
+	if b.Client != nil {
+		return b.Client
+	}
+	return http.DefaultClient
+}
+
+func (b *Backend) post(ctx context.Context, path string, request any, response any) error {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", b.Endpoint+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	resp, err := b.client().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("etcd %s: %s", path, resp.Status)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(response)
+}
+
+func encode(s string) string {
+	return base64.StdEncoding.EncodeToString([]byte(s))
+}
+
+func decode(s string) (string, error) {
+	b, err := base64.StdEncoding.DecodeString(s)
+	return string(b), err
+}
+
+// prefixEnd returns the end of the key range holding all keys starting with prefix.
+func prefixEnd(prefix string) string {
+	end := []byte(prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return string(end[:i+1])
+		}
+	}
+	return "\x00" // all keys
+}
@@ -0,0 +1,182 @@
+package etcd
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/akrennmair/goconf"
+)
+
+// fakeEtcd serves a fixed set of keys through the JSON gateway, bumping the
+// revision on every put and counting the lease lookups.
+type fakeEtcd struct {
+	mu       sync.Mutex
+	kvs      map[string]string
+	leases   map[string]string // Leases of keys, by key.
+	ttls     map[string]int    // TTLs of leases, by ID.
+	revision int
+	lookups  int
+	changed  chan bool // Closed on the next put.
+}
+
+func newFakeEtcd(kvs map[string]string) *fakeEtcd {
+	return &fakeEtcd{kvs: kvs, leases: map[string]string{}, ttls: map[string]int{}, revision: 1, changed: make(chan bool)}
+}
+
+func (f *fakeEtcd) put(key string, value string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.kvs[key] = value
+	f.revision++
+	close(f.changed)
+	f.changed = make(chan bool)
+}
+
+func (f *fakeEtcd) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req map[string]json.RawMessage
+	json.NewDecoder(r.Body).Decode(&req)
+	field := func(m map[string]json.RawMessage, name string) string {
+		var s string
+		json.Unmarshal(m[name], &s)
+		return s
+	}
+
+	switch r.URL.Path {
+	case "/v3/kv/range":
+		key, _ := decode(field(req, "key"))
+		end, _ := decode(field(req, "range_end"))
+
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		var resp rangeResponse
+		resp.Header.Revision = strconv.Itoa(f.revision)
+		for k, v := range f.kvs {
+			if k == key || end != "" && k >= key && k < end {
+				resp.Kvs = append(resp.Kvs, keyValue{Key: encode(k), Value: encode(v), Lease: f.leases[k]})
+			}
+		}
+		json.NewEncoder(w).Encode(resp)
+	case "/v3/lease/timetolive":
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.lookups++
+		json.NewEncoder(w).Encode(map[string]string{"TTL": strconv.Itoa(f.ttls[field(req, "ID")])})
+	case "/v3/watch":
+		f.mu.Lock()
+		changed := f.changed
+		f.mu.Unlock()
+		w.Write([]byte(`{"result":{"created":true}}` + "\n"))
+		w.(http.Flusher).Flush()
+		select {
+		case <-changed:
+			w.Write([]byte(`{"result":{"events":[{"kv":{}}]}}` + "\n"))
+		case <-r.Context().Done():
+		}
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestReadBackend(t *testing.T) {
+	fake := newFakeEtcd(map[string]string{
+		"/myapp/host":              "example.com",
+		"/myapp/service-1/port":    "443",
+		"/myapp/service-1/url":     "http://%(host)s/",
+		"/otherapp/service-1/port": "80",
+	})
+	fake.leases["/myapp/service-1/port"] = "7"
+	fake.leases["/myapp/service-1/url"] = "7"
+	fake.ttls["7"] = 60
+	ts := httptest.NewServer(fake)
+	defer ts.Close()
+
+	b := New(ts.URL)
+	c, err := conf.ReadBackend(b, "/myapp")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if port, _ := c.GetInt("service-1", "port"); port != 443 {
+		t.Errorf("port = %d; want 443", port)
+	}
+	if url, _ := c.GetString("service-1", "url"); url != "http://example.com/" {
+		t.Errorf("url = %q; want http://example.com/", url)
+	}
+	if len(c.GetSections()) != 2 {
+		t.Errorf("sections = %v; want default and service-1", c.GetSections())
+	}
+
+	for _, option := range []string{"port", "url"} {
+		expires, err := time.Parse(time.RFC3339Nano, c.Metadata("service-1", option)[conf.ExpiresKey])
+		if err != nil || time.Until(expires) < 50*time.Second || time.Until(expires) > time.Minute {
+			t.Errorf("%s expires at %v, %v; want in a minute", option, expires, err)
+		}
+	}
+	if expires := c.Metadata("", "host")[conf.ExpiresKey]; expires != "" {
+		t.Errorf("host expires at %s; want never", expires)
+	}
+	if fake.lookups != 1 {
+		t.Errorf("looked leases up %d times; want once", fake.lookups)
+	}
+
+	if v, ok, err := b.Get("/myapp/host"); err != nil || !ok || v != "example.com" {
+		t.Errorf("b.Get() = %q, %v, %v; want example.com", v, ok, err)
+	}
+	if _, ok, err := b.Get("/myapp/missing"); err != nil || ok {
+		t.Errorf("b.Get() of a missing key = %v, %v; want false, nil", ok, err)
+	}
+	if expiries, err := b.Expiry([]string{"/myapp/host", "/myapp/service-1/url"}); err != nil || len(expiries) != 1 {
+		t.Errorf("b.Expiry() = %v, %v; want the expiry of /myapp/service-1/url", expiries, err)
+	}
+}
+
+func TestList(t *testing.T) {
+	fake := newFakeEtcd(map[string]string{"/a/x": "1", "/a/y": "2", "/ab/z": "3"})
+	ts := httptest.NewServer(fake)
+	defer ts.Close()
+
+	kvs, err := New(ts.URL).List("/a/")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(kvs) != 2 || kvs["/a/x"] != "1" || kvs["/a/y"] != "2" {
+		t.Errorf("List() = %v; want the keys below /a/", kvs)
+	}
+
+	if _, err := New(ts.URL + "/missing").List("/a/"); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("List() from a missing endpoint returned %v", err)
+	}
+}
+
+func TestWatchBackend(t *testing.T) {
+	fake := newFakeEtcd(map[string]string{"/myapp/port": "1"})
+	ts := httptest.NewServer(fake)
+	defer ts.Close()
+
+	configs := make(chan *conf.ConfigFile, 10)
+	p := conf.WatchBackend(New(ts.URL), "/myapp", func(c *conf.ConfigFile, err error) {
+		if err != nil {
+			t.Error(err.Error())
+			return
+		}
+		configs <- c
+	})
+	defer p.Close()
+
+	time.Sleep(50 * time.Millisecond) // let the watch start
+	fake.put("/myapp/port", "2")
+
+	select {
+	case c := <-configs:
+		if port, _ := c.GetInt("", "port"); port != 2 {
+			t.Errorf("port after change = %d; want 2", port)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no configuration delivered after change")
+	}
+}
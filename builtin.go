@@ -0,0 +1,68 @@
+package conf
+
+import (
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SetBuiltins enables or disables the unfolding of placeholders naming
+// builtin variables, which GetString substitutes by:
+//
+//	hostname      the host name reported by the kernel
+//	pid           the process ID
+//	user          the name of the user running the process
+//	now:LAYOUT    the current time formatted with the time.Format layout,
+//	              e.g. %(now:2006-01-02)s, or in RFC 3339 format without one
+//
+// Options of the same names take precedence. As GetString caches its results,
+// values are fixed when first unfolded until the configuration is next modified.
+// Builtins are disabled by default.
+func (c *ConfigFile) SetBuiltins(enabled bool) {
+	c.builtins = enabled
+	c.changed()
+}
+
+// builtin returns the value of the builtin variable referenced by a placeholder,
+// consisting of its name, optionally followed by a colon and an argument.
+func (c *ConfigFile) builtin(ref string) (value string, ok bool) {
+	if !c.builtins {
+		return "", false
+	}
+
+	name, arg, hasArg := strings.Cut(ref, ":")
+	switch strings.ToLower(name) {
+	case "hostname":
+		if name, err := os.Hostname(); !hasArg && err == nil {
+			return name, true
+		}
+	case "pid":
+		if !hasArg {
+			return strconv.Itoa(os.Getpid()), true
+		}
+	case "user":
+		if !hasArg {
+			return currentUser(), true
+		}
+	case "now":
+		if !hasArg {
+			arg = time.RFC3339
+		}
+		return time.Now().Format(arg), true
+	}
+
+	return "", false
+}
+
+// currentUser returns the name of the user running the process.
+func currentUser() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	if name, ok := os.LookupEnv("USER"); ok {
+		return name
+	}
+	return os.Getenv("USERNAME")
+}
@@ -0,0 +1,44 @@
+package conf
+
+import (
+	"strings"
+	"unsafe"
+)
+
+// GetBytesRaw gets the raw value of the option in the section as GetRawString
+// does, as a byte slice sharing the memory of the value instead of a copy, e.g.
+// to feed a large embedded payload to a parser taking []byte. The slice is
+// read-only: modifying it is undefined behaviour, and may crash the program.
+// It returns nil for an empty value.
+func (c *ConfigFile) GetBytesRaw(section string, option string) (value []byte, err error) {
+	raw, err := c.GetRawString(section, option)
+	if err != nil || raw == "" {
+		return nil, err
+	}
+
+	return unsafe.Slice(unsafe.StringData(raw), len(raw)), nil
+}
+
+// GetReader gets the value of the option in the section as GetString does, as
+// a reader of the value which does not copy it, for parsers reading from an
+// io.Reader.
+func (c *ConfigFile) GetReader(section string, option string) (value *strings.Reader, err error) {
+	sv, err := c.GetString(section, option)
+	if err != nil {
+		return nil, err
+	}
+
+	return strings.NewReader(sv), nil
+}
+
+// AppendString appends the value of the option in the section, as GetString
+// returns it, to dst and returns the extended buffer, so that callers can
+// reuse a buffer instead of allocating a copy of the value for every read.
+func (c *ConfigFile) AppendString(dst []byte, section string, option string) ([]byte, error) {
+	sv, err := c.GetString(section, option)
+	if err != nil {
+		return dst, err
+	}
+
+	return append(dst, sv...), nil
+}
@@ -0,0 +1,99 @@
+package conf
+
+import (
+	"maps"
+)
+
+// Clone returns a copy of the configuration, including its settings such as
+// defaults, aliases, validators and environment overrides, but neither its
+// change handler nor its history.
+//
+// The copy is made on write: the configuration and its clone share the options
+// of their sections until either modifies a section, which then copies that
+// section only. Cloning costs time proportional to the number of sections, not
+// options, so that e.g. a server can cheaply take a copy of its configuration
+// for every batch of requests while it keeps being reloaded. As both are
+// marked as sharing their sections, Clone counts as a modification of c for
+// synchronization.
+func (c *ConfigFile) Clone() *ConfigFile {
+	dup := &ConfigFile{
+		sections:      copySections(c.sections),
+		data:          make(map[string]*section, len(c.data)),
+		shared:        make(map[string]bool, len(c.data)),
+		dialect:       c.dialect,
+		normalize:     c.normalize,
+		commands:      c.commands,
+		intLiterals:   c.intLiterals,
+		localeNumbers: c.localeNumbers,
+		interning:     c.interning,
+		capacity:      c.capacity,
+		lazy:          c.lazy,
+		builtins:      c.builtins,
+		document:      c.document,
+		doc:           append([]docEntry(nil), c.doc...),
+		envPrefixes:   append([]string(nil), c.envPrefixes...),
+		profile:       c.profile,
+		redefined:     append([]Location(nil), c.redefined...),
+		aead:          c.aead,
+		limits:        c.limits,
+		logger:        c.logger,
+
+		validators: maps.Clone(c.validators),
+		schema:     c.schema,
+		units:      c.units,
+		protected:  maps.Clone(c.protected),
+
+		deprecated: c.deprecated,
+	}
+
+	if c.shared == nil {
+		c.shared = make(map[string]bool, len(c.data))
+	}
+	for name, s := range c.data {
+		dup.data[name] = s
+		dup.shared[name] = true
+		c.shared[name] = true
+	}
+	if c.defaults != nil {
+		dup.defaults = make(map[string]map[string]string, len(c.defaults))
+		for name, defaults := range c.defaults {
+			dup.defaults[name] = maps.Clone(defaults)
+		}
+	}
+	dup.metadata = copyMetadata(c.metadata)
+	if c.aliases != nil {
+		dup.aliases = make(map[cacheKey][]string, len(c.aliases))
+		for key, old := range c.aliases {
+			dup.aliases[key] = append([]string(nil), old...)
+		}
+	}
+
+	return dup
+}
+
+// mutableSection returns the section, given in lower case, for modification,
+// copying it first if it is shared with a clone and parsing it if it was read
+// lazily. It returns nil if the section does not exist.
+func (c *ConfigFile) mutableSection(name string) *section {
+	s := c.data[name]
+	if s != nil && c.shared[name] {
+		s = s.copy()
+		c.data[name] = s
+		delete(c.shared, name)
+	}
+	s.load()
+
+	return s
+}
+
+// copyMetadata returns a deep copy of the metadata, see SetMetadata.
+func copyMetadata(metadata map[cacheKey]map[string]string) map[cacheKey]map[string]string {
+	if metadata == nil {
+		return nil
+	}
+	dup := make(map[cacheKey]map[string]string, len(metadata))
+	for key, m := range metadata {
+		dup[key] = maps.Clone(m)
+	}
+	return dup
+}
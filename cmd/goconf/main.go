@@ -0,0 +1,225 @@
+// Command goconf reads and edits configuration files from the command line.
+//
+// Usage:
+//
+//	goconf get FILE SECTION.OPTION
+//	goconf set FILE SECTION.OPTION VALUE
+//	goconf unset FILE SECTION.OPTION
+//	goconf validate FILE SCHEMA
+//	goconf keys SCHEMA
+//	goconf completion bash|zsh SCHEMA COMMAND
+//	goconf convert [-from ini|json] [-to ini|json] FILE
+//
+// Options of the default section may be given without "SECTION.". get prints the
+// unfolded value of an option and fails if it is missing. set and unset modify the
+// file in place while holding a lock on it, keeping its comments, blank lines and
+// the formatting of the lines they do not change. validate checks the file against a
+// schema stored as JSON, e.g.
+//
+//	{"Options": [{"Section": "service-1", "Option": "port", "Type": "int", "Required": true}]}
+//
+// keys lists the options of a schema with their descriptions, and completion
+// writes a bash or zsh script completing arguments of the form key=value of
+// COMMAND with the options of the schema, e.g.
+//
+//	goconf completion bash schema.json myapp > /etc/bash_completion.d/myapp
+//
+// convert writes the file in another format to standard output.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/akrennmair/goconf"
+)
+
+func usage() {
+	fmt.Fprintln(os.Stderr, `usage: goconf get FILE SECTION.OPTION
+       goconf set FILE SECTION.OPTION VALUE
+       goconf unset FILE SECTION.OPTION
+       goconf validate FILE SCHEMA
+       goconf keys SCHEMA
+       goconf completion bash|zsh SCHEMA COMMAND
+       goconf convert [-from ini|json] [-to ini|json] FILE`)
+	os.Exit(2)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	var err error
+	cmd, args := os.Args[1], os.Args[2:]
+	switch {
+	case cmd == "get" && len(args) == 2:
+		err = get(args[0], args[1])
+	case cmd == "set" && len(args) == 3:
+		err = edit(args[0], func(c *conf.ConfigFile) error {
+			section, option := splitKey(args[1])
+			return c.SetOption(section, option, args[2])
+		})
+	case cmd == "unset" && len(args) == 2:
+		err = edit(args[0], func(c *conf.ConfigFile) error {
+			if section, option := splitKey(args[1]); !c.RemoveOption(section, option) {
+				return fmt.Errorf("option %s not found", args[1])
+			}
+			return nil
+		})
+	case cmd == "validate" && len(args) == 2:
+		err = validate(args[0], args[1])
+	case cmd == "keys" && len(args) == 1:
+		err = keys(args[0])
+	case cmd == "completion" && len(args) == 3:
+		err = completion(args[0], args[1], args[2])
+	case cmd == "convert":
+		err = convert(args)
+	default:
+		usage()
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "goconf:", err)
+		os.Exit(1)
+	}
+}
+
+// splitKey splits a key of the form "section.option" at the first dot.
+func splitKey(key string) (section string, option string) {
+	if i := strings.Index(key, "."); i >= 0 {
+		return key[:i], key[i+1:]
+	}
+	return "", key
+}
+
+func get(fname string, key string) error {
+	c, err := conf.ReadConfigFile(fname)
+	if err != nil {
+		return err
+	}
+
+	value, err := c.GetString(splitKey(key))
+	if err != nil {
+		return err
+	}
+	fmt.Println(value)
+
+	return nil
+}
+
+// edit applies fn to the configuration file while holding a lock on it, reading
+// it in document mode so that the lines left alone are written back unchanged.
+func edit(fname string, fn func(*conf.ConfigFile) error) error {
+	fi, err := os.Stat(fname)
+	if err != nil {
+		return err
+	}
+	l, err := conf.LockFile(fname)
+	if err != nil {
+		return err
+	}
+	defer l.Unlock()
+
+	c, err := conf.ReadConfigDocument(fname)
+	if err != nil {
+		return err
+	}
+	if err = fn(c); err != nil {
+		return err
+	}
+
+	return c.WriteConfigFile(fname, uint32(fi.Mode().Perm()), "")
+}
+
+func validate(fname string, schemaFile string) error {
+	c, err := conf.ReadConfigFile(fname)
+	if err != nil {
+		return err
+	}
+	s, err := readSchema(schemaFile)
+	if err != nil {
+		return err
+	}
+
+	return c.Validate(s)
+}
+
+// readSchema reads a schema stored as JSON.
+func readSchema(fname string) (*conf.Schema, error) {
+	data, err := os.ReadFile(fname)
+	if err != nil {
+		return nil, err
+	}
+	s := new(conf.Schema)
+	if err = json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("%s: %v", fname, err)
+	}
+
+	return s, nil
+}
+
+func keys(schemaFile string) error {
+	s, err := readSchema(schemaFile)
+	if err != nil {
+		return err
+	}
+
+	return s.WriteHelp(os.Stdout)
+}
+
+func completion(shell string, schemaFile string, command string) error {
+	s, err := readSchema(schemaFile)
+	if err != nil {
+		return err
+	}
+
+	switch shell {
+	case "bash":
+		return s.WriteBashCompletion(os.Stdout, command)
+	case "zsh":
+		return s.WriteZshCompletion(os.Stdout, command)
+	}
+	return fmt.Errorf("unknown shell %s", shell)
+}
+
+func convert(args []string) error {
+	fs := flag.NewFlagSet("convert", flag.ExitOnError)
+	from := fs.String("from", "ini", "format of the input file: ini or json")
+	to := fs.String("to", "json", "format of the output: ini or json")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		usage()
+	}
+
+	var c *conf.ConfigFile
+	var err error
+	switch *from {
+	case "ini":
+		c, err = conf.ReadConfigFile(fs.Arg(0))
+	case "json":
+		var data []byte
+		if data, err = os.ReadFile(fs.Arg(0)); err == nil {
+			c = conf.NewConfigFile()
+			err = json.Unmarshal(data, c)
+		}
+	default:
+		return fmt.Errorf("unknown input format %s", *from)
+	}
+	if err != nil {
+		return err
+	}
+
+	switch *to {
+	case "ini":
+		return c.Write(os.Stdout, "")
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(c)
+	}
+	return fmt.Errorf("unknown output format %s", *to)
+}
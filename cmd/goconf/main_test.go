@@ -0,0 +1,35 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/akrennmair/goconf"
+)
+
+func TestEditKeepsComments(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "app.conf")
+	data := "# application settings\n\n[service-1]\n; listening port\nport = 443\nhost=x   # the host\n\n[service-2]\nport = 80\n"
+	if err := os.WriteFile(fname, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := edit(fname, func(c *conf.ConfigFile) error { return c.SetOption("service-1", "port", "8080") }); err != nil {
+		t.Fatal(err)
+	}
+	if err := edit(fname, func(c *conf.ConfigFile) error {
+		c.RemoveOption("service-2", "port")
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := os.ReadFile(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "# application settings\n\n[service-1]\n; listening port\nport = 8080\nhost=x   # the host\n\n[service-2]\n"; string(got) != want {
+		t.Errorf("edited file is %q; want %q", got, want)
+	}
+}
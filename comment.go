@@ -0,0 +1,217 @@
+package conf
+
+import "strings"
+
+// CommentOut removes an option, turning its lines into comments in document
+// mode (see SetDocumentMode) instead of leaving them out, so that its value
+// is kept in the file for Uncomment, e.g. for installers disabling options of
+// files owned by users. The lines are prefixed by the first of the
+// CommentPrefixes of the dialect and a space, continued lines without
+// indentation by more spaces. Options whose values changed since they were
+// read are commented out as they would be written, options added since after
+// the last line of their section. Outside of document mode, and in dialects
+// without comments, the option is just removed. It returns an error if the
+// option does not exist or is protected.
+func (c *ConfigFile) CommentOut(section string, option string) error {
+	if section == "" {
+		section = DefaultSection
+	}
+	section, option = c.foldSection(section), c.foldOption(option)
+
+	value, ok := c.data[section].get(option)
+	if !ok {
+		return GetError{OptionNotFound, "", "", section, option, nil}
+	}
+	if err := c.checkProtected(section, option); err != nil {
+		return err
+	}
+	if c.document && len(c.dialect.CommentPrefixes) > 0 {
+		c.commentOut(section, option, value)
+	}
+	c.RemoveOption(section, option)
+
+	return nil
+}
+
+// Uncomment restores an option commented out, by CommentOut or by hand, in
+// document mode: the last comment line of the section defining the option,
+// such as "# level = 2", turns back into an option line, along with the
+// comment lines following it which continue the value in the dialect, and
+// the option takes the value written. It does nothing if the option is set,
+// and returns an error if no such comment is found or the value cannot be
+// set.
+func (c *ConfigFile) Uncomment(section string, option string) error {
+	if section == "" {
+		section = DefaultSection
+	}
+	section, option = c.foldSection(section), c.foldOption(option)
+
+	if _, ok := c.data[section].get(option); ok {
+		return nil
+	}
+
+	for i := len(c.doc) - 1; i >= 0; i-- {
+		e := c.doc[i]
+		if e.kind != docOther || e.section != section || e.option != "" {
+			continue
+		}
+		text, ok := c.uncommentLine(e.raw)
+		if !ok || c.commentedOption(text) != option {
+			continue
+		}
+
+		// parse the lines restored as a document of their own
+		lines := []string{text}
+		for j := i + 1; j < len(c.doc) && c.doc[j].kind == docOther && c.doc[j].section == section && c.doc[j].option == ""; j++ {
+			next, ok := c.uncommentLine(c.doc[j].raw)
+			if !ok || !c.continuesComment(lines, next, option) {
+				break
+			}
+			lines = append(lines, next)
+		}
+		tmp := NewConfigFile()
+		tmp.dialect = c.dialect
+		tmp.SetDocumentMode(true)
+		if err := tmp.Read(strings.NewReader("[s]\n" + strings.Join(lines, ""))); err != nil {
+			return err
+		}
+		value, ok := tmp.data["s"].get(option)
+		if !ok {
+			break
+		}
+		if err := c.SetOption(section, option, value); err != nil {
+			return err
+		}
+
+		restored := tmp.doc[1:]
+		for k := range restored {
+			restored[k].section = section
+		}
+		c.doc = append(c.doc[:i], append(restored, c.doc[i+len(lines):]...)...)
+		return nil
+	}
+
+	return GetError{OptionNotFound, "", "", section, option, nil}
+}
+
+// commentOut implements CommentOut in document mode.
+func (c *ConfigFile) commentOut(section string, option string, value string) {
+	at := -1
+	for i, e := range c.doc {
+		if e.kind == docOption && e.section == section && e.option == option {
+			at = i
+		}
+	}
+
+	if at >= 0 && c.doc[at].value == value { // earlier definitions included
+		for i, e := range c.doc {
+			if e.section == section && e.option == option {
+				c.doc[i] = docEntry{raw: c.commentLine(e.raw, e.kind == docContinuation), section: section}
+			}
+		}
+		return
+	}
+
+	// as Write writes the value, replacing the lines of the option
+	eol := c.docEOL()
+	line := c.dialect.formatOption(option, value, eol) + eol
+	if at >= 0 {
+		line = c.dialect.valuePrefix(c.doc[at].raw) + c.dialect.formatValue(option, value, eol) + eol
+	}
+	var entries []docEntry
+	for i, l := range strings.SplitAfter(line, eol) {
+		if l != "" {
+			entries = append(entries, docEntry{raw: c.commentLine(l, i > 0), section: section})
+		}
+	}
+	if at < 0 { // after the last line of the section, if any
+		for i, e := range c.doc {
+			if e.section == section && (e.kind != docOther || e.option != "") {
+				at = i
+			}
+		}
+		if at < 0 {
+			return
+		}
+		c.doc = append(c.doc[:at+1], append(entries, c.doc[at+1:]...)...)
+		return
+	}
+
+	doc := make([]docEntry, 0, len(c.doc)+len(entries))
+	for i, e := range c.doc {
+		if i == at {
+			doc = append(doc, entries...)
+		}
+		if e.section != section || e.option != option {
+			doc = append(doc, e)
+		}
+	}
+	c.doc = doc
+}
+
+// commentLine returns the raw line commented out, indenting continued lines
+// so that Uncomment tells them from comments following the option.
+func (c *ConfigFile) commentLine(raw string, continued bool) string {
+	prefix := c.dialect.CommentPrefixes[0] + " "
+	if continued && lineIndent([]byte(raw)) == 0 {
+		prefix += "  "
+	}
+	return prefix + raw
+}
+
+// uncommentLine returns the raw comment line without its comment prefix and
+// the space following it, if any. It returns false for other lines.
+func (c *ConfigFile) uncommentLine(raw string) (string, bool) {
+	l := strings.TrimLeft(raw, " \t")
+	for _, prefix := range c.dialect.CommentPrefixes {
+		if len(l) >= len(prefix) && strings.EqualFold(l[:len(prefix)], prefix) {
+			return strings.TrimPrefix(l[len(prefix):], " "), true
+		}
+	}
+	return "", false
+}
+
+// commentedOption returns the folded name of the option defined by the text
+// of a comment line, or "" if it does not define an option.
+func (c *ConfigFile) commentedOption(text string) string {
+	l := strings.TrimSpace(text)
+	if l == "" || l[0] == '[' || c.dialect.isComment([]byte(l)) {
+		return ""
+	}
+	i := c.dialect.optionEnd([]byte(l))
+	if i < 0 {
+		if c.dialect.syntax != gitSyntax { // boolean shorthand
+			return ""
+		}
+		i = len(l)
+	}
+	name := strings.TrimSpace(l[:i])
+	if c.dialect.syntax == gitSyntax {
+		if !isGitName(name) {
+			return ""
+		}
+	} else {
+		name = c.dialect.unescapeName(name)
+	}
+	if name == "" {
+		return ""
+	}
+	return c.foldOption(name)
+}
+
+// continuesComment reports whether the text of a comment line continues the
+// value of the option defined by the comment lines before, as uncommented.
+func (c *ConfigFile) continuesComment(lines []string, text string, option string) bool {
+	prev := strings.TrimRight(lines[len(lines)-1], "\r\n")
+	switch {
+	case c.dialect.syntax == gitSyntax:
+		return (len(prev)-len(strings.TrimRight(prev, `\`)))%2 == 1
+	case c.dialect.Continuation == ContinueBackslash:
+		return strings.HasSuffix(strings.TrimSpace(prev), `\`)
+	case c.dialect.Duplicates == DuplicatesAppend:
+		return c.commentedOption(text) == option
+	case c.dialect.Continuation == ContinueIndented, c.dialect.Continuation == ContinueBareLines:
+		return strings.TrimSpace(text) != "" && lineIndent([]byte(text)) > lineIndent([]byte(lines[0]))
+	}
+	return false
+}
@@ -0,0 +1,54 @@
+package conf
+
+import (
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+var hostname struct {
+	sync.Once
+	name string
+}
+
+// conditions returns the option name suffixes selecting values for the current
+// host and operating system, most specific first.
+func conditions() []string {
+	hostname.Do(func() {
+		if name, err := os.Hostname(); err == nil {
+			hostname.name = strings.ToLower(name)
+		}
+	})
+
+	if hostname.name == "" {
+		return []string{runtime.GOOS}
+	}
+	return []string{hostname.name, runtime.GOOS}
+}
+
+// lookupConditional returns the value of the option in the section of the
+// configuration which applies to the current host or operating system. Such
+// values are stored under the option's name followed by a dot and the host
+// name or the value of runtime.GOOS:
+//
+//	socket = /run/app.sock
+//	socket.windows = \\.\pipe\app
+//	socket.web1.example.com = /srv/app.sock
+//
+// Values for the host take precedence over values for the operating system.
+func (c *ConfigFile) lookupConditional(section string, option string) (value string, ok bool) {
+	sectionmap := c.data[section]
+	if sectionmap.len() == 0 {
+		return "", false
+	}
+
+	for _, cond := range conditions() {
+		if value, ok = sectionmap.get(option + "." + cond); ok {
+			c.markUsed(section, option+"."+cond)
+			return value, true
+		}
+	}
+
+	return "", false
+}
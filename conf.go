@@ -25,23 +25,158 @@
 // Note that all section and option names are case insensitive. All values are case
 // sensitive.
 //
+// Options may have values specific to an operating system or host, which take
+// precedence over the option's plain value on matching systems:
+//
+//	socket = /run/app.sock
+//	socket.windows = \\.\pipe\app
+//
 // Goconfig's string substitution syntax has not been removed. However, it may be
 // taken out or modified in the future.
 package conf
 
 import (
-	"regexp"
-	"strings"
+	"crypto/cipher"
+	"errors"
 	"fmt"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
 )
 
-
 // ConfigFile is the representation of configuration settings.
 // The public interface is entirely through methods.
 type ConfigFile struct {
-	data map[string]map[string]string // Maps sections to options to values.
+	sections      []string                     // Section names in order.
+	data          map[string]*section          // Maps sections to their options.
+	shared        map[string]bool              // Sections of data shared with clones, see Clone.
+	capacity      int                          // Expected number of options per section, see SetCapacity.
+	defaults      map[string]map[string]string // Values used for options missing from data.
+	dialect       Dialect                      // Syntax of files read and written, see SetDialect.
+	normalize     func(string) string          // Folds option names, see SetOptionNormalizer.
+	commands      bool                         // Whether GetString runs $(command) substitutions.
+	intLiterals   bool                         // Whether GetInt accepts Go integer literals.
+	localeNumbers bool                         // Whether GetFloat64 accepts decimal commas, see SetLocaleNumbers.
+	interning     bool                         // Whether Read interns names and values, see SetInterning.
+	lazy          bool                         // Whether Read defers parsing sections, see SetLazy.
+	builtins      bool                         // Whether GetString unfolds builtin placeholders.
+	document      bool                         // Whether Read keeps lines for Write, see SetDocumentMode.
+	doc           []docEntry                   // Lines kept in document mode.
+	including     []string                     // Files being read with those included by include.path options in git mode, outermost first.
+	included      []string                     // Files included by include.path options, see Included.
+	noIncludes    bool                         // Whether reading refuses to include files, see ReadConfigURL.
+	envPrefixes   []string                     // Prefixes of environment overrides, see AddEnvOverrides.
+	profile       string                       // Suffix of sections overriding others, see SetProfile.
+	redefined     []Location                   // Where Read replaced the value of an option, see Lint.
+	aead          cipher.AEAD                  // Decrypts encrypted values, see SetEncryptionKey.
+	limits        Limits                       // Restrict the input read and the values unfolded.
+	logger        Logger                       // Receives debug messages, see SetLogger.
+
+	metadata   map[cacheKey]map[string]string  // Set with SetMetadata, keyed by option, or by section with option "".
+	validators map[cacheKey]func(string) error // Check values before they are set, see SetValidator.
+	schema     *Schema                         // Validates and coerces values read, see SetSchema.
+	units      map[cacheKey]Unit               // Units of the options of schema.
+	protected  map[cacheKey]bool               // Options, or sections with option "", which cannot be modified.
+
+	aliases    map[cacheKey][]string // Old names of renamed options.
+	deprecated func(Deprecation)     // Called when an option is found under an old name.
+
+	onChange func()   // Called after modifications, see SetChangeHandler.
+	batch    int      // While positive, modifications are not reported to onChange.
+	history  *history // Earlier states for Undo, if enabled with SetHistory.
+
+	onExpire func(section, option string) // Called when options expire, see SetExpiryHandler.
+	timers   map[cacheKey]*time.Timer     // Timers of the options set to expire, see SetExpiry.
+
+	mu    sync.Mutex          // Guards cache and used, which are filled on lookups.
+	cache map[cacheKey]string // Unfolded values, dropped whenever data changes.
+	used  map[cacheKey]bool   // Options of data which have been looked up.
 }
 
+// cacheKey identifies an unfolded value by lower-case section and option.
+type cacheKey struct {
+	section, option string
+}
+
+// foldSection returns a section name as it is stored: case folded, see
+// foldCase, unless the dialect has case sensitive sections, and except for
+// subsections in git mode.
+func (c *ConfigFile) foldSection(name string) string {
+	switch {
+	case c.dialect.syntax == pythonSyntax && name == "DEFAULT":
+		return DefaultSection
+	case c.dialect.CaseSensitiveSections:
+		return name
+	case c.dialect.syntax == gitSyntax:
+		if i := strings.IndexByte(name, '.'); i >= 0 {
+			return foldCase(name[:i]) + name[i:]
+		}
+	}
+	return foldCase(name)
+}
+
+// foldCase returns the name in lower case, folding the case of characters as
+// strings.EqualFold does, so that names equal regardless of case are folded
+// to the same name. Unlike strings.ToLower, it treats the forms of Greek sigma
+// and the Kelvin sign as the same letters as EqualFold does, and keeps letters
+// without case equivalents, such as the Turkish dotted İ and dotless ı, as
+// they are instead of folding İ to the distinct letter i.
+func foldCase(name string) string {
+	for i := 0; i < len(name); i++ {
+		if name[i] >= utf8.RuneSelf {
+			return strings.Map(foldRune, name)
+		}
+	}
+	return strings.ToLower(name) // fast path for ASCII
+}
+
+// foldRune returns the lower case of the smallest rune equal to r under simple
+// case folding, or r itself if no other rune is.
+func foldRune(r rune) rune {
+	if unicode.SimpleFold(r) == r {
+		return r
+	}
+	least := r
+	for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+		least = min(least, f)
+	}
+	return unicode.ToLower(least)
+}
+
+// foldOption returns an option name as it is stored: as returned by the
+// normalizer set with SetOptionNormalizer, if any, or else case folded, see
+// foldCase, unless the dialect has case sensitive options.
+func (c *ConfigFile) foldOption(name string) string {
+	if c.normalize != nil {
+		return c.normalize(name)
+	}
+	if c.dialect.CaseSensitiveOptions {
+		return name
+	}
+	return foldCase(name)
+}
+
+// Interpolation selects the placeholder syntax that GetString unfolds.
+type Interpolation int
+
+const (
+	// BasicInterpolation unfolds %(option)s placeholders, looking the option
+	// up in the requested section and then in the default section.
+	BasicInterpolation Interpolation = iota
+
+	// ExtendedInterpolation unfolds ${option} and ${section:option}
+	// placeholders as done by Python's configparser.ExtendedInterpolation.
+	// A literal dollar sign is written as $$.
+	ExtendedInterpolation
+
+	// NoInterpolation takes values literally.
+	NoInterpolation
+)
+
+// Reasons of errors. New reasons are appended, keeping the values of those
+// before.
 const (
 	// Get Errors
 	SectionNotFound = iota
@@ -53,6 +188,19 @@ const (
 
 	// Get and Read Errors
 	CouldNotParse
+
+	CommandFailed    // Get Error
+	DecryptionFailed // Get Error
+	InvalidSignature // Read Error
+	OutOfRange       // Get Error
+	TemplateFailed   // Get Error
+	ReadFailed       // Get Error
+	InvalidValue     // Set Error
+	Protected        // Set Error
+	LimitExceeded    // Get and Read Error
+	Duplicate        // Read Error
+	IncludeCycle     // Read Error
+	IncludeRefused   // Read Error
 )
 
 var (
@@ -75,97 +223,370 @@ var (
 		"0":     false,
 	}
 
-	varRegExp = regexp.MustCompile(`%\(([a-zA-Z0-9_.\-]+)\)s`)
+	// Strings accepted as bool by GetBoolStrict, matched exactly.
+	StrictBoolStrings = map[string]bool{
+		"true":  true,
+		"false": false,
+	}
 )
 
-
 // AddSection adds a new section to the configuration.
 // It returns true if the new section was inserted, and false if the section already existed.
 func (c *ConfigFile) AddSection(section string) bool {
-	section = strings.ToLower(section)
+	section = c.foldSection(section)
 
 	if _, ok := c.data[section]; ok {
 		return false
 	}
-	c.data[section] = make(map[string]string)
+	c.sections = append(c.sections, section)
+	c.data[section] = newSection(c.capacity)
+	c.changed()
 
 	return true
 }
 
-
 // RemoveSection removes a section from the configuration.
-// It returns true if the section was removed, and false if section did not exist.
+// It returns true if the section was removed, and false if section did not exist,
+// is protected (see ProtectSection) or is the default section, which cannot be removed.
 func (c *ConfigFile) RemoveSection(section string) bool {
-	section = strings.ToLower(section)
+	section = c.foldSection(section)
 
 	switch _, ok := c.data[section]; {
 	case !ok:
 		return false
 	case section == DefaultSection:
 		return false // default section cannot be removed
+	case c.checkProtected(section, "") != nil:
+		return false
 	default:
-		for o, _ := range c.data[section] {
-			delete(c.data[section], o)
+		for _, o := range c.data[section].keys() {
+			delete(c.metadata, cacheKey{section, o})
 		}
+		delete(c.metadata, cacheKey{section, ""})
 		delete(c.data, section)
+		delete(c.shared, section)
+		c.sections = removeName(c.sections, section)
+		c.changed()
 	}
 
 	return true
 }
 
-
 // AddOption adds a new option and value to the configuration.
 // It returns true if the option and value were inserted, and false if the value was overwritten.
 // If the section does not exist in advance, it is created.
+// Values rejected by a validator set with SetValidator and values of protected
+// options are not added; use SetOption to learn why.
 func (c *ConfigFile) AddOption(section string, option string, value string) bool {
-	c.AddSection(section) // make sure section exists
+	added, _ := c.addOption(section, option, value)
+
+	return added
+}
+
+// SetOption adds a new option and value to the configuration as AddOption does.
+// It returns a SetError if the value is rejected by a validator set with SetValidator,
+// or if the option is protected with ProtectSection or ProtectOption.
+func (c *ConfigFile) SetOption(section string, option string, value string) error {
+	_, err := c.addOption(section, option, value)
+
+	return err
+}
+
+// addOption implements AddOption and SetOption.
+func (c *ConfigFile) addOption(section string, option string, value string) (added bool, err error) {
+	if err = c.checkProtected(section, option); err != nil {
+		return false, err
+	}
+	if err = c.validate(section, option, value); err != nil {
+		return false, err
+	}
+
+	section = c.foldSection(section)
+	option = c.foldOption(option)
+
+	s := c.mutableSection(section)
+	if s == nil {
+		c.AddSection(section) // make sure section exists
+		s = c.data[section]
+	}
+	added = s.set(option, value)
+	c.changed()
+
+	return added, nil
+}
+
+// SetOptionIfMissing adds the option and value to the configuration unless the
+// section already has the option. It returns true if the option was added.
+// If the section does not exist in advance, it is created.
+func (c *ConfigFile) SetOptionIfMissing(section string, option string, value string) bool {
+	if _, ok := c.data[c.foldSection(section)].get(c.foldOption(option)); ok {
+		return false
+	}
 
-	section = strings.ToLower(section)
-	option = strings.ToLower(option)
+	return c.AddOption(section, option, value)
+}
 
-	_, ok := c.data[section][option]
-	c.data[section][option] = value
+// GetOrSet returns the value of the option as GetString does, after adding the
+// option with the given value if the section does not have it yet, e.g. to
+// initialize a configuration file on first run.
+func (c *ConfigFile) GetOrSet(section string, option string, value string) (string, error) {
+	c.SetOptionIfMissing(section, option, value)
 
-	return !ok
+	return c.GetString(section, option)
 }
 
+// SetDefault registers a default value for an option, which the getters return
+// when the option is missing from the section. Defaults are kept apart from the
+// configuration: they are neither listed by GetOptions nor written out, and IsSet
+// reports whether an option is explicitly configured.
+func (c *ConfigFile) SetDefault(section string, option string, value string) {
+	if section == "" {
+		section = "default"
+	}
+	section = c.foldSection(section)
+	option = c.foldOption(option)
+
+	if c.defaults == nil {
+		c.defaults = make(map[string]map[string]string)
+	}
+	if c.defaults[section] == nil {
+		c.defaults[section] = make(map[string]string)
+	}
+	c.defaults[section][option] = value
+	c.changed()
+}
 
 // RemoveOption removes a option and value from the configuration.
 // It returns true if the option and value were removed, and false otherwise,
-// including if the section did not exist.
+// including if the section did not exist or the option is protected (see ProtectOption).
 func (c *ConfigFile) RemoveOption(section string, option string) bool {
-	section = strings.ToLower(section)
-	option = strings.ToLower(option)
+	section = c.foldSection(section)
+	option = c.foldOption(option)
 
-	if _, ok := c.data[section]; !ok {
+	if _, ok := c.data[section]; !ok || c.checkProtected(section, option) != nil {
 		return false
 	}
 
-	_, ok := c.data[section][option]
-	delete(c.data[section], option)
+	ok := c.mutableSection(section).remove(option)
+	delete(c.metadata, cacheKey{section, option})
+	if ok {
+		c.changed()
+	}
 
 	return ok
 }
 
+// RemoveSectionsMatching removes all sections whose names match the pattern,
+// which has the syntax of path.Match and is case insensitive, except for the
+// default section. It returns the number of sections removed.
+// A malformed pattern matches no section.
+func (c *ConfigFile) RemoveSectionsMatching(pattern string) (n int) {
+	c.beginBatch()
+	defer c.endBatch()
+
+	pattern = c.foldSection(pattern)
+	for _, section := range append([]string(nil), c.sections...) {
+		if matchAny([]string{pattern}, section) && c.RemoveSection(section) {
+			n++
+		}
+	}
+
+	return n
+}
+
+// RemoveOptionsMatching removes all options of the section whose names match
+// the pattern, which has the syntax of path.Match and is case insensitive.
+// It returns the number of options removed. A malformed pattern matches no option.
+func (c *ConfigFile) RemoveOptionsMatching(section string, pattern string) (n int) {
+	c.beginBatch()
+	defer c.endBatch()
+
+	section = c.foldSection(section)
+	pattern = c.foldOption(pattern)
+	for _, option := range append([]string(nil), c.data[section].keys()...) {
+		if matchAny([]string{pattern}, option) && c.RemoveOption(section, option) {
+			n++
+		}
+	}
+
+	return n
+}
+
+// SetInterpolation selects the placeholder syntax unfolded by GetString.
+// The default is BasicInterpolation.
+func (c *ConfigFile) SetInterpolation(i Interpolation) {
+	c.dialect.Interpolation = i
+	c.changed()
+}
+
+// SetCommandSubstitution enables or disables the substitution of $(command args)
+// in values by the standard output of the command, e.g.
+//
+//	password = $(pass show db)
+//
+// The command is run directly, not through a shell, when GetString first unfolds
+// the value. Substitution is disabled by default and must never be enabled for
+// configurations read from untrusted input.
+func (c *ConfigFile) SetCommandSubstitution(enabled bool) {
+	c.commands = enabled
+	c.changed()
+}
+
+// SetIntLiterals enables or disables the parsing of integers by GetInt as Go
+// integer literals, which may have a base prefix and digit separators, e.g.
+//
+//	mode = 0o755
+//	mask = 0xFF
+//	flags = 0b1010
+//	max-size = 1_000_000
+//
+// Note that a leading 0 then also denotes an octal number, so 0755 is 493.
+// It is disabled by default, and only decimal integers are accepted.
+func (c *ConfigFile) SetIntLiterals(enabled bool) {
+	c.intLiterals = enabled
+}
+
+// splitKey splits a key of the form "section.option" at the last dot, so that
+// section names may contain dots. A key without a dot names an option of the
+// default section.
+func splitKey(key string) (section string, option string) {
+	if i := strings.LastIndexByte(key, '.'); i >= 0 {
+		return key[:i], key[i+1:]
+	}
+	return DefaultSection, key
+}
+
+// setLocation records where the option, which must exist, was read from.
+func (c *ConfigFile) setLocation(section string, option string, loc Location) {
+	s := c.mutableSection(c.foldSection(section))
+	if s.locations == nil {
+		s.locations = make(map[string]Location)
+	}
+	s.locations[c.foldOption(option)] = loc
+}
+
+// SetChangeHandler sets a function which is called after every modification
+// of the configuration. Modifications made by Read or a committed transaction
+// are reported once.
+func (c *ConfigFile) SetChangeHandler(handler func()) {
+	c.onChange = handler
+}
+
+// changed must be called after every modification of the configuration.
+// It drops the cached results of GetString, reports the modification and
+// records it in the history.
+func (c *ConfigFile) changed() {
+	c.mu.Lock()
+	c.cache = nil
+	c.mu.Unlock()
+
+	if c.batch > 0 {
+		return
+	}
+	c.record()
+	if c.onChange != nil {
+		c.onChange()
+	}
+}
+
+// beginBatch suspends the reporting of modifications until the matching endBatch,
+// which reports them at once.
+func (c *ConfigFile) beginBatch() {
+	c.batch++
+}
+
+func (c *ConfigFile) endBatch() {
+	c.batch--
+	c.changed()
+}
+
+// abortBatch ends a batch whose modifications were undone, without reporting
+// them.
+func (c *ConfigFile) abortBatch() {
+	c.batch--
+}
 
 // NewConfigFile creates an empty configuration representation.
 // This representation can be filled with AddSection and AddOption and then
 // saved to a file using WriteConfigFile.
 func NewConfigFile() *ConfigFile {
 	c := new(ConfigFile)
-	c.data = make(map[string]map[string]string)
+	c.data = make(map[string]*section)
+	c.interning = true
+	c.dialect = DefaultDialect
 
 	c.AddSection(DefaultSection) // default section always exists
 
 	return c
 }
 
+// Location identifies the line an option was read from.
+type Location struct {
+	File string // File name, or "" if read from another source.
+	Line int    // Line number, starting at 1, or 0 if the source has no lines.
+}
+
+func (loc Location) String() string {
+	file := loc.File
+	if file == "" {
+		file = "<input>"
+	}
+	if loc.Line == 0 {
+		return file
+	}
+	return fmt.Sprintf("%s:%d", file, loc.Line)
+}
+
+// Sentinel errors matching GetError and ReadError values of the corresponding
+// reason with errors.Is. Use errors.As to access the details of the error.
+var (
+	ErrSectionNotFound  = errors.New("section not found")
+	ErrOptionNotFound   = errors.New("option not found")
+	ErrMaxDepth         = errors.New("max depth reached")
+	ErrCommandFailed    = errors.New("command failed")
+	ErrDecryption       = errors.New("decryption failed")
+	ErrOutOfRange       = errors.New("value out of range")
+	ErrTemplate         = errors.New("template execution failed")
+	ErrReadFailed       = errors.New("reading file failed")
+	ErrBlankSection     = errors.New("blank section")
+	ErrInvalidSignature = errors.New("invalid signature")
+	ErrDuplicate        = errors.New("duplicate")
+	ErrIncludeCycle     = errors.New("include cycle")
+	ErrIncludeRefused   = errors.New("include refused")
+	ErrParse            = errors.New("could not parse")
+	ErrLimitExceeded    = errors.New("limit exceeded")
+	ErrInvalidValue     = errors.New("invalid value")
+	ErrProtected        = errors.New("protected")
+)
+
+// reasonErrors maps reasons to the sentinel errors they match.
+var reasonErrors = map[int]error{
+	SectionNotFound:  ErrSectionNotFound,
+	OptionNotFound:   ErrOptionNotFound,
+	MaxDepthReached:  ErrMaxDepth,
+	CommandFailed:    ErrCommandFailed,
+	DecryptionFailed: ErrDecryption,
+	OutOfRange:       ErrOutOfRange,
+	TemplateFailed:   ErrTemplate,
+	ReadFailed:       ErrReadFailed,
+	BlankSection:     ErrBlankSection,
+	InvalidSignature: ErrInvalidSignature,
+	Duplicate:        ErrDuplicate,
+	IncludeCycle:     ErrIncludeCycle,
+	IncludeRefused:   ErrIncludeRefused,
+	CouldNotParse:    ErrParse,
+	LimitExceeded:    ErrLimitExceeded,
+	InvalidValue:     ErrInvalidValue,
+	Protected:        ErrProtected,
+}
+
 type GetError struct {
 	Reason    int
 	ValueType string
 	Value     string
 	Section   string
 	Option    string
+	Err       error // Underlying error, if any.
 }
 
 func (err GetError) Error() string {
@@ -175,26 +596,103 @@ func (err GetError) Error() string {
 	case OptionNotFound:
 		return fmt.Sprintf("option '%s' not found in section '%s'", string(err.Option), string(err.Section))
 	case CouldNotParse:
+		if err.ValueType == "choice" {
+			return fmt.Sprintf("could not parse choice value '%s' of option '%s' in section '%s': %v", string(err.Value), string(err.Option), string(err.Section), err.Err)
+		}
 		return fmt.Sprintf("could not parse %s value '%s'", string(err.ValueType), string(err.Value))
+	case CommandFailed:
+		if err.Err != nil {
+			return fmt.Sprintf("command '%s' failed for option '%s' in section '%s': %v", string(err.Value), string(err.Option), string(err.Section), err.Err)
+		}
+		return fmt.Sprintf("command '%s' failed for option '%s' in section '%s'", string(err.Value), string(err.Option), string(err.Section))
+	case DecryptionFailed:
+		return fmt.Sprintf("could not decrypt option '%s' in section '%s'", string(err.Option), string(err.Section))
+	case OutOfRange:
+		return fmt.Sprintf("%s value '%s' out of range for option '%s' in section '%s'", string(err.ValueType), string(err.Value), string(err.Option), string(err.Section))
+	case TemplateFailed:
+		return fmt.Sprintf("template of option '%s' in section '%s' failed: %v", string(err.Option), string(err.Section), err.Err)
+	case ReadFailed:
+		return fmt.Sprintf("could not read file '%s' for option '%s' in section '%s': %v", string(err.Value), string(err.Option), string(err.Section), err.Err)
 	case MaxDepthReached:
 		return fmt.Sprintf("possible cycle while unfolding variables: max depth of %d reached", int(DepthValues))
+	case LimitExceeded:
+		return fmt.Sprintf("value of option '%s' in section '%s' exceeds %s", string(err.Option), string(err.Section), string(err.ValueType))
 	}
 
 	return "invalid get error"
 }
 
+// Is reports whether target is the sentinel error of the error's reason.
+func (err GetError) Is(target error) bool {
+	return target != nil && reasonErrors[err.Reason] == target
+}
+
+// Unwrap returns the underlying error, such as the error of a failed command.
+func (err GetError) Unwrap() error {
+	return err.Err
+}
+
+type SetError struct {
+	Reason  int
+	Value   string
+	Section string
+	Option  string
+	Err     error // Underlying error, if any.
+}
+
+func (err SetError) Error() string {
+	switch err.Reason {
+	case InvalidValue:
+		return fmt.Sprintf("invalid value '%s' for option '%s' in section '%s': %v", string(err.Value), string(err.Option), string(err.Section), err.Err)
+	case Protected:
+		if err.Option == "" {
+			return fmt.Sprintf("section '%s' is protected", string(err.Section))
+		}
+		return fmt.Sprintf("option '%s' in section '%s' is protected", string(err.Option), string(err.Section))
+	}
+
+	return "invalid set error"
+}
+
+// Is reports whether target is the sentinel error of the error's reason.
+func (err SetError) Is(target error) bool {
+	return target != nil && reasonErrors[err.Reason] == target
+}
+
+// Unwrap returns the underlying error, such as the error returned by a validator.
+func (err SetError) Unwrap() error {
+	return err.Err
+}
+
 type ReadError struct {
 	Reason int
-	Line   string
+	Line   string // The offending line, or the limit exceeded for LimitExceeded.
 }
 
 func (err ReadError) Error() string {
 	switch err.Reason {
 	case BlankSection:
 		return "empty section name not allowed"
+	case InvalidSignature:
+		return "missing or invalid signature"
+	case DecryptionFailed:
+		return "could not decrypt file"
+	case Duplicate:
+		return fmt.Sprintf("duplicate %s", string(err.Line))
+	case IncludeCycle:
+		return fmt.Sprintf("%s includes itself", string(err.Line))
+	case IncludeRefused:
+		return fmt.Sprintf("refusing to include %s", string(err.Line))
 	case CouldNotParse:
 		return fmt.Sprintf("could not parse line: %s", string(err.Line))
+	case LimitExceeded:
+		return fmt.Sprintf("input exceeds %s", string(err.Line))
 	}
 
 	return "invalid read error"
 }
+
+// Is reports whether target is the sentinel error of the error's reason.
+func (err ReadError) Is(target error) bool {
+	return target != nil && reasonErrors[err.Reason] == target
+}
@@ -1,9 +1,27 @@
 package conf_test
 
 import (
-	. "conf"
-	"testing"
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"runtime"
 	"strconv"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	. "github.com/akrennmair/goconf"
 )
 
 const confFile = `
@@ -83,3 +101,2967 @@ func TestBuild(t *testing.T) {
 		}
 	}
 }
+
+const extendedConfFile = `
+[default]
+host = example.com
+
+[paths]
+home = /home/${user}
+user = joe
+
+[service-1]
+url = http://${host}/${paths:home}
+price = $$5
+`
+
+func TestExtendedInterpolation(t *testing.T) {
+	c, err := ReadConfigBytes([]byte(extendedConfFile))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	c.SetInterpolation(ExtendedInterpolation)
+
+	for _, e := range []stringtest{
+		{"paths", "home", "/home/joe"},
+		{"service-1", "url", "http://example.com//home/joe"},
+		{"service-1", "price", "$5"},
+	} {
+		ans, err := c.GetString(e.section, e.option)
+		if err != nil {
+			t.Error("c.GetString(\"" + e.section + "\",\"" + e.option + "\") returned error: " + err.Error())
+		}
+		if ans != e.answer {
+			t.Error("c.GetString(\"" + e.section + "\",\"" + e.option + "\") returned incorrect answer: " + ans)
+		}
+	}
+
+	c.AddOption("service-1", "broken", "${nothere:host}")
+	if _, err := c.GetString("service-1", "broken"); err == nil {
+		t.Error("expected error for placeholder naming a missing section")
+	}
+}
+
+func BenchmarkGetString(b *testing.B) {
+	c, err := ReadConfigBytes([]byte(confFile))
+	if err != nil {
+		b.Fatal(err.Error())
+	}
+
+	for i := 0; i < b.N; i++ {
+		if _, err := c.GetString("service-1", "url"); err != nil {
+			b.Fatal(err.Error())
+		}
+	}
+}
+
+func BenchmarkKey(b *testing.B) {
+	c, err := ReadConfigBytes([]byte(confFile))
+	if err != nil {
+		b.Fatal(err.Error())
+	}
+	url := c.Key("service-1", "url")
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := url.String(); err != nil {
+			b.Fatal(err.Error())
+		}
+	}
+}
+
+func BenchmarkUnfold(b *testing.B) {
+	c := NewConfigFile()
+	c.AddOption("default", "host", "example.com")
+	c.AddOption("default", "base", "http://%(host)s:%(port)s")
+	c.AddOption("service-1", "port", "443")
+	c.AddOption("service-1", "api", "%(base)s/api")
+	c.AddOption("service-1", "urls", "%(api)s/users %(api)s/groups %(api)s/roles %(base)s/static 100%% literal text")
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		c.AddOption("service-1", "changed", "") // drop the cached values
+		if _, err := c.GetString("service-1", "urls"); err != nil {
+			b.Fatal(err.Error())
+		}
+	}
+}
+
+// generatedConfig returns a configuration of about 50000 lines, as generated
+// by provisioning tools.
+func generatedConfig() []byte {
+	var buf strings.Builder
+	for i := 0; i < 1000; i++ {
+		buf.WriteString("# service " + strconv.Itoa(i) + "\n[service-" + strconv.Itoa(i) + "]\n")
+		for j := 0; j < 46; j++ {
+			buf.WriteString("option-" + strconv.Itoa(j) + " = value " + strconv.Itoa(i*j) + " ; generated\n")
+		}
+		buf.WriteString("\n")
+	}
+	return []byte(buf.String())
+}
+
+func BenchmarkRead(b *testing.B) {
+	data := generatedConfig()
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := ReadConfigBytes(data); err != nil {
+			b.Fatal(err.Error())
+		}
+	}
+}
+
+func BenchmarkReadLazy(b *testing.B) {
+	data := generatedConfig()
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		c := NewConfigFile()
+		c.SetLazy(true)
+		if err := c.Read(bytes.NewReader(data)); err != nil {
+			b.Fatal(err.Error())
+		}
+		if _, err := c.GetString("service-1", "option-1"); err != nil {
+			b.Fatal(err.Error())
+		}
+	}
+}
+
+// BenchmarkReadRetained reports the heap retained by a configuration read
+// with and without interning.
+func BenchmarkReadRetained(b *testing.B) {
+	data := generatedConfig()
+	for _, interning := range []bool{true, false} {
+		b.Run("interning="+strconv.FormatBool(interning), func(b *testing.B) {
+			var before, after runtime.MemStats
+			var retained uint64
+			b.ReportAllocs()
+
+			for i := 0; i < b.N; i++ {
+				runtime.GC()
+				runtime.ReadMemStats(&before)
+				c := NewConfigFile()
+				c.SetInterning(interning)
+				if err := c.Read(bytes.NewReader(data)); err != nil {
+					b.Fatal(err.Error())
+				}
+				runtime.GC()
+				runtime.ReadMemStats(&after)
+				retained += after.HeapAlloc - before.HeapAlloc
+				runtime.KeepAlive(c)
+			}
+			b.ReportMetric(float64(retained)/float64(b.N), "retained-B/op")
+		})
+	}
+}
+
+func BenchmarkClone(b *testing.B) {
+	c, err := ReadConfigBytes(generatedConfig())
+	if err != nil {
+		b.Fatal(err.Error())
+	}
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		c.Clone().AddOption("service-1", "option-0", "changed")
+	}
+}
+
+func TestCacheInvalidation(t *testing.T) {
+	c, err := ReadConfigBytes([]byte(confFile))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if ans, _ := c.GetString("service-1", "url"); ans != "http://example.com/something" {
+		t.Error("c.GetString(\"service-1\",\"url\") returned incorrect answer: " + ans)
+	}
+	c.AddOption("default", "host", "example.org")
+	if ans, _ := c.GetString("service-1", "url"); ans != "http://example.org/something" {
+		t.Error("c.GetString(\"service-1\",\"url\") returned stale answer after AddOption: " + ans)
+	}
+	c.RemoveOption("service-1", "url")
+	if _, err := c.GetString("service-1", "url"); err == nil {
+		t.Error("c.GetString(\"service-1\",\"url\") returned cached answer after RemoveOption")
+	}
+}
+
+func TestCommandSubstitution(t *testing.T) {
+	c := NewConfigFile()
+	c.AddOption("default", "greeting", "$(echo hello world)!")
+
+	if ans, _ := c.GetString("default", "greeting"); ans != "$(echo hello world)!" {
+		t.Error("command substituted while disabled: " + ans)
+	}
+
+	c.SetCommandSubstitution(true)
+	if ans, _ := c.GetString("default", "greeting"); ans != "hello world!" {
+		t.Error("c.GetString(\"default\",\"greeting\") returned incorrect answer: " + ans)
+	}
+
+	c.AddOption("default", "broken", "$(/nonexistent/command)")
+	if _, err := c.GetString("default", "broken"); err == nil {
+		t.Error("expected error for failing command")
+	}
+}
+
+func TestEnvOverrides(t *testing.T) {
+	c, err := ReadConfigBytes([]byte(confFile))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	c.AddEnvOverrides("GOCONFTEST")
+	t.Setenv("GOCONFTEST_SERVICE1_PORT", "8443")
+	t.Setenv("GOCONFTEST_DEFAULT_HOST", "example.net")
+
+	if ans, err := c.GetInt("service-1", "port"); err != nil || ans != 8443 {
+		t.Error("c.GetInt(\"service-1\",\"port\") returned incorrect answer: " + strconv.Itoa(ans))
+	}
+	if ans, _ := c.GetString("service-1", "url"); ans != "http://example.net/something" {
+		t.Error("c.GetString(\"service-1\",\"url\") returned incorrect answer: " + ans)
+	}
+	if ans, _ := c.GetInt("default", "port"); ans != 43 {
+		t.Error("c.GetInt(\"default\",\"port\") returned incorrect answer: " + strconv.Itoa(ans))
+	}
+}
+
+func TestDefaults(t *testing.T) {
+	c, err := ReadConfigBytes([]byte(confFile))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	c.SetDefault("service-1", "port", "80")
+	c.SetDefault("service-1", "maxclients", "200")
+	c.SetDefault("service-2", "maxclients", "100")
+
+	for _, e := range []inttest{
+		{"service-1", "port", 443},
+		{"service-1", "maxclients", 200},
+		{"service-2", "maxclients", 100},
+	} {
+		if ans, err := c.GetInt(e.section, e.option); err != nil || ans != e.answer {
+			t.Errorf("c.GetInt(%q,%q) = %d, %v; want %d", e.section, e.option, ans, err, e.answer)
+		}
+	}
+	if !c.IsSet("service-1", "port") {
+		t.Error("c.IsSet(\"service-1\",\"port\") = false for an option in the file")
+	}
+	if c.IsSet("service-1", "maxclients") {
+		t.Error("c.IsSet(\"service-1\",\"maxclients\") = true for a default")
+	}
+}
+
+func TestAliases(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "server.conf")
+	if err := os.WriteFile(fname, []byte("[server]\nhost = a\nmax-clients = 100\n"), 0644); err != nil {
+		t.Fatal(err.Error())
+	}
+	c, err := ReadConfigFile(fname)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	var warnings []Deprecation
+	c.SetDeprecationHandler(func(d Deprecation) { warnings = append(warnings, d) })
+	c.AddAlias("server", "max-clients", "maxclients")
+	c.AddAlias("server", "hostname", "host")
+
+	if ans, err := c.GetInt("server", "maxclients"); err != nil || ans != 100 {
+		t.Errorf("c.GetInt(\"server\",\"maxclients\") = %d, %v; want 100", ans, err)
+	}
+	if ans, _ := c.GetString("server", "host"); ans != "a" {
+		t.Error("c.GetString(\"server\",\"host\") returned incorrect answer: " + ans)
+	}
+
+	if len(warnings) != 1 {
+		t.Fatalf("got %d deprecation warnings; want 1", len(warnings))
+	}
+	want := fname + ":3: option 'max-clients' in section 'server' is deprecated, use 'maxclients' instead"
+	if warnings[0].String() != want {
+		t.Errorf("deprecation warning %q; want %q", warnings[0].String(), want)
+	}
+}
+
+func TestUnusedOptions(t *testing.T) {
+	c, err := ReadConfigBytes([]byte(confFile))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	c.GetInt("service-1", "port")
+	c.GetString("service-1", "url")
+	c.GetBool("", "compression")
+
+	unused := c.UnusedOptions()
+	want := []string{"default.active", "default.port"}
+	if len(unused) != len(want) || unused[0] != want[0] || unused[1] != want[1] {
+		t.Errorf("c.UnusedOptions() = %v; want %v", unused, want)
+	}
+}
+
+func TestTransaction(t *testing.T) {
+	c, err := ReadConfigBytes([]byte(confFile))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	changes := 0
+	c.SetChangeHandler(func() { changes++ })
+
+	tx := c.Begin()
+	tx.AddOption("service-1", "port", "8443")
+	tx.RemoveOption("default", "active")
+	tx.AddOption("service-2", "port", "80")
+	if ans, _ := c.GetInt("service-1", "port"); ans != 443 {
+		t.Error("staged option visible before commit")
+	}
+	if err = tx.Commit(); err != nil {
+		t.Fatal(err.Error())
+	}
+	if changes != 1 {
+		t.Errorf("commit reported %d changes; want 1", changes)
+	}
+	if ans, _ := c.GetInt("service-2", "port"); ans != 80 || c.HasOption("default", "active") {
+		t.Error("committed modifications not applied")
+	}
+	if err = tx.Commit(); err != ErrTxDone {
+		t.Errorf("second commit returned %v; want ErrTxDone", err)
+	}
+
+	tx = c.Begin()
+	tx.RemoveSection("service-2")
+	tx.Rollback()
+	if !c.HasSection("service-2") || changes != 1 {
+		t.Error("rolled back modifications applied")
+	}
+
+	c.SetMetadata("service-2", "port", "owner", "ops")
+	c.SetValidator("service-2", "port", func(v string) error { _, err := strconv.Atoi(v); return err })
+	tx = c.Begin()
+	tx.RemoveOption("service-2", "port")
+	tx.AddOption("service-2", "port", "http")
+	if err = tx.Commit(); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("failing commit returned %v", err)
+	}
+	if ans, _ := c.GetInt("service-2", "port"); ans != 80 || c.Metadata("service-2", "port")["owner"] != "ops" {
+		t.Error("failed commit not rolled back")
+	}
+	if changes != 1 {
+		t.Errorf("failed commit reported %d changes; want none", changes-1)
+	}
+}
+
+func TestApplyPatch(t *testing.T) {
+	c, err := ReadConfigBytes([]byte(confFile))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	var patch Patch
+	err = json.Unmarshal([]byte(`[
+		{"op": "set", "section": "service-1", "option": "timeout", "value": "30"},
+		{"op": "rename", "section": "service-1", "option": "timeout", "to": "read-timeout"},
+		{"op": "rename", "section": "service-1", "to": "service-a"},
+		{"op": "delete", "option": "active"},
+		{"op": "delete", "section": "missing"}
+	]`), &patch)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	for i := 0; i < 2; i++ { // patches can be applied repeatedly
+		if err = ApplyPatch(c, patch); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+	if got := c.GetSections(); !reflect.DeepEqual(got, []string{"default", "service-a"}) {
+		t.Errorf("sections %q", got)
+	}
+	if got, _ := c.GetOptions("service-a"); !reflect.DeepEqual(got[len(got)-3:], []string{"port", "url", "read-timeout"}) {
+		t.Errorf("options %q", got)
+	}
+	if c.HasOption("default", "active") {
+		t.Error("deleted option still set")
+	}
+
+	c.SetValidator("service-a", "port", func(string) error { return errors.New("fixed") })
+	bad := Patch{{Op: "delete", Section: "service-a", Option: "url"}, {Op: "set", Section: "service-a", Option: "port", Value: "1"}}
+	if err = ApplyPatch(c, bad); err == nil || !c.HasOption("service-a", "url") {
+		t.Errorf("failed patch applied partly: %v", err)
+	}
+	if err = ApplyPatch(c, Patch{{Op: "move"}}); err == nil {
+		t.Error("invalid op applied")
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	c, err := ReadConfigBytes([]byte(confFile))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	s := c.Snapshot()
+	c.AddOption("service-1", "port", "8443")
+	c.RemoveSection("service-1")
+	c.AddOption("service-2", "port", "80")
+
+	c.Restore(s)
+	if ans, _ := c.GetInt("service-1", "port"); ans != 443 {
+		t.Errorf("c.GetInt(\"service-1\",\"port\") = %d after Restore; want 443", ans)
+	}
+	if c.HasSection("service-2") {
+		t.Error("section added after the snapshot survived Restore")
+	}
+
+	c.AddOption("service-1", "port", "8443")
+	c.Restore(s)
+	if ans, _ := c.GetInt("service-1", "port"); ans != 443 {
+		t.Errorf("c.GetInt(\"service-1\",\"port\") = %d after second Restore; want 443", ans)
+	}
+}
+
+func TestSecrets(t *testing.T) {
+	key := []byte("0123456789abcdef0123456789abcdef")
+
+	c := NewConfigFile()
+	if err := c.SetSecret("db", "password", "s3cr%(et)s"); err == nil {
+		t.Error("c.SetSecret() without key returned no error")
+	}
+	if err := c.SetEncryptionKey(key); err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := c.SetSecret("db", "password", "s3cr%(et)s"); err != nil {
+		t.Fatal(err.Error())
+	}
+	c.AddOption("db", "dsn", "user:%(password)s@host")
+
+	d, err := ReadConfigBytes(c.WriteConfigBytes(""))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	raw, _ := d.GetString("db", "password")
+	if !strings.HasPrefix(raw, "ENC[AES256,") {
+		t.Error("secret written in plain text: " + raw)
+	}
+
+	d.SetEncryptionKey(key)
+	if ans, _ := d.GetString("db", "password"); ans != "s3cr%(et)s" {
+		t.Error("c.GetString(\"db\",\"password\") returned incorrect answer: " + ans)
+	}
+	if ans, _ := d.GetString("db", "dsn"); ans != "user:s3cr%(et)s@host" {
+		t.Error("c.GetString(\"db\",\"dsn\") returned incorrect answer: " + ans)
+	}
+
+	d.SetEncryptionKey([]byte("fedcba9876543210fedcba9876543210"))
+	if _, err := d.GetString("db", "password"); err == nil {
+		t.Error("decryption with the wrong key returned no error")
+	}
+}
+
+func TestStringRedacted(t *testing.T) {
+	c := NewConfigFile()
+	c.AddOption("db", "db-password", "hunter2")
+	c.AddOption("db", "user", "joe")
+
+	s := c.StringRedacted()
+	if strings.Contains(s, "hunter2") || !strings.Contains(s, "db-password=********\n") {
+		t.Error("password not redacted:\n" + s)
+	}
+	if !strings.Contains(s, "user=joe\n") {
+		t.Error("user redacted:\n" + s)
+	}
+	if s = c.StringRedacted("user"); strings.Contains(s, "joe") || !strings.Contains(s, "hunter2") {
+		t.Error("explicit patterns not applied:\n" + s)
+	}
+}
+
+func TestSignedConfigFile(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	c, err := ReadConfigBytes([]byte(confFile))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	for _, keys := range []struct {
+		signer   Signer
+		verifier Verifier
+	}{
+		{HMACKey("secret"), HMACKey("secret")},
+		{Ed25519PrivateKey(priv), Ed25519PublicKey(pub)},
+	} {
+		fname := filepath.Join(t.TempDir(), "signed.conf")
+		if err := c.WriteConfigFileSigned(fname, 0644, "signed", keys.signer); err != nil {
+			t.Fatal(err.Error())
+		}
+
+		d, err := ReadConfigFileVerified(fname, keys.verifier)
+		if err != nil {
+			t.Fatalf("%s: %s", keys.signer.Algorithm(), err.Error())
+		}
+		if ans, _ := d.GetInt("service-1", "port"); ans != 443 {
+			t.Errorf("%s: verified port = %d; want 443", keys.signer.Algorithm(), ans)
+		}
+
+		data, _ := os.ReadFile(fname)
+		os.WriteFile(fname, []byte(strings.Replace(string(data), "443", "444", 1)), 0644)
+		if _, err := ReadConfigFileVerified(fname, keys.verifier); err == nil {
+			t.Errorf("%s: tampered file verified", keys.signer.Algorithm())
+		}
+	}
+}
+
+func TestFileLock(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "locked.conf")
+	c, err := ReadConfigBytes([]byte(confFile))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if err = c.WriteConfigFileLocked(fname, 0644, ""); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	l, err := LockFile(fname)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	read := make(chan error)
+	go func() {
+		_, err := ReadConfigFileLocked(fname)
+		read <- err
+	}()
+
+	select {
+	case <-read:
+		t.Fatal("ReadConfigFileLocked did not wait for the lock")
+	case <-time.After(50 * time.Millisecond):
+	}
+	if err = l.Unlock(); err != nil {
+		t.Fatal(err.Error())
+	}
+	if err = <-read; err != nil {
+		t.Error("ReadConfigFileLocked returned error: " + err.Error())
+	}
+}
+
+func TestLoad(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "load.conf")
+	if err := os.WriteFile(fname, []byte("port = 1\n"), 0644); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	c, err := Load(fname)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	c.AddOption("", "port", "100") // must not affect the cached copy
+
+	d, err := Load(fname)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if port, _ := d.GetInt("", "port"); port != 1 {
+		t.Errorf("cached port = %d; want 1", port)
+	}
+
+	if err := os.WriteFile(fname, []byte("port = 22\n"), 0644); err != nil {
+		t.Fatal(err.Error())
+	}
+	if d, err = Load(fname); err != nil {
+		t.Fatal(err.Error())
+	}
+	if port, _ := d.GetInt("", "port"); port != 22 {
+		t.Errorf("port after change = %d; want 22", port)
+	}
+}
+
+func TestJSON(t *testing.T) {
+	c, err := ReadConfigBytes([]byte(confFile))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	data, err := json.Marshal(c)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	d := NewConfigFile()
+	if err = json.Unmarshal(data, d); err != nil {
+		t.Fatal(err.Error())
+	}
+	if ans, _ := d.GetString("service-1", "url"); ans != "http://example.com/something" {
+		t.Error("c.GetString(\"service-1\",\"url\") after JSON round trip returned incorrect answer: " + ans)
+	}
+}
+
+func TestProfile(t *testing.T) {
+	c, err := ReadConfigBytes([]byte(confFile + "\n[service-1@production]\nport = 8443\n\n[default@production]\nhost = example.org\n"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if ans, _ := c.GetInt("service-1", "port"); ans != 443 {
+		t.Errorf("port without profile = %d; want 443", ans)
+	}
+	c.SetProfile("Production")
+	if ans, _ := c.GetInt("service-1", "port"); ans != 8443 {
+		t.Errorf("port with profile = %d; want 8443", ans)
+	}
+	if ans, _ := c.GetString("service-1", "url"); ans != "http://example.org/something" {
+		t.Error("url with profile returned incorrect answer: " + ans)
+	}
+	if ans, _ := c.GetInt("default", "port"); ans != 43 {
+		t.Errorf("port of the default section with profile = %d; want 43", ans)
+	}
+}
+
+func TestConditionalValues(t *testing.T) {
+	c := NewConfigFile()
+	c.AddOption("service-1", "socket", "/run/app.sock")
+	c.AddOption("service-1", "socket."+runtime.GOOS, "/run/os.sock")
+	c.AddOption("service-1", "socket.no-such-os", "/run/other.sock")
+
+	if ans, _ := c.GetString("service-1", "socket"); ans != "/run/os.sock" {
+		t.Error("c.GetString(\"service-1\",\"socket\") returned incorrect answer: " + ans)
+	}
+	c.RemoveOption("service-1", "socket."+runtime.GOOS)
+	if ans, _ := c.GetString("service-1", "socket"); ans != "/run/app.sock" {
+		t.Error("c.GetString(\"service-1\",\"socket\") returned incorrect answer: " + ans)
+	}
+}
+
+func TestSource(t *testing.T) {
+	dir := t.TempDir()
+	fname := filepath.Join(dir, "app.conf")
+	if err := os.WriteFile(fname, []byte("[service-1]\nhost = localhost\nmaxclients = 200\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c, err := ReadConfigFile(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.AddOption("service-1", "port", "8080")
+
+	if loc, ok := c.Source("service-1", "maxclients"); !ok || loc.String() != fname+":3" {
+		t.Errorf("c.Source(\"service-1\",\"maxclients\") = %v, %v", loc, ok)
+	}
+	if loc, ok := c.Source("service-1", "port"); ok {
+		t.Errorf("c.Source(\"service-1\",\"port\") = %v, %v", loc, ok)
+	}
+
+	c.AddEnvOverrides("GOCONFTEST")
+	t.Setenv("GOCONFTEST_SERVICE1_HOST", "example.com")
+	if loc, ok := c.Source("service-1", "host"); !ok || loc.String() != "env:GOCONFTEST_SERVICE1_HOST" {
+		t.Errorf("c.Source(\"service-1\",\"host\") = %v, %v", loc, ok)
+	}
+
+	s := NewStack()
+	s.Push("base", c)
+	override, _ := ReadConfigBytes([]byte("[service-1]\nmaxclients = 10\n"))
+	s.Push("override", override)
+	if loc, ok := s.Source("service-1", "maxclients"); !ok || loc.String() != "override:2" {
+		t.Errorf("s.Source(\"service-1\",\"maxclients\") = %v, %v", loc, ok)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	c := NewConfigFile()
+	c.AddOption("service-1", "port", "http")
+
+	_, err := c.GetString("service-2", "port")
+	if !errors.Is(err, ErrSectionNotFound) || errors.Is(err, ErrOptionNotFound) {
+		t.Errorf("c.GetString(\"service-2\",\"port\") returned %v", err)
+	}
+	_, err = c.GetInt("service-1", "port")
+	var gerr GetError
+	if !errors.Is(err, ErrParse) || !errors.Is(err, strconv.ErrSyntax) || !errors.As(err, &gerr) || gerr.Value != "http" {
+		t.Errorf("c.GetInt(\"service-1\",\"port\") returned %v", err)
+	}
+
+	_, err = ReadConfigBytes([]byte("[service-1]\nno value\n"))
+	if !errors.Is(err, ErrParse) {
+		t.Errorf("ReadConfigBytes returned %v", err)
+	}
+}
+
+func TestFileErrors(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "missing", "app.conf")
+
+	_, err := ReadConfigFile(fname)
+	if !errors.Is(err, os.ErrNotExist) || !strings.HasPrefix(err.Error(), "reading config "+fname+": ") {
+		t.Errorf("ReadConfigFile returned %v", err)
+	}
+	err = NewConfigFile().WriteConfigFile(fname, 0644, "")
+	if !errors.Is(err, os.ErrNotExist) || !strings.HasPrefix(err.Error(), "writing config "+fname+": ") {
+		t.Errorf("WriteConfigFile returned %v", err)
+	}
+}
+
+func TestGetBoolStrict(t *testing.T) {
+	c := NewConfigFile()
+	c.AddOption("service-1", "enabled", "true")
+	c.AddOption("service-1", "verbose", "yes")
+	c.AddOption("service-1", "debug", "false")
+
+	if ans, err := c.GetBoolStrict("service-1", "enabled"); err != nil || !ans {
+		t.Errorf("c.GetBoolStrict(\"service-1\",\"enabled\") = %v, %v", ans, err)
+	}
+	if _, err := c.GetBoolStrict("service-1", "verbose"); !errors.Is(err, ErrParse) {
+		t.Errorf("c.GetBoolStrict(\"service-1\",\"verbose\") returned %v", err)
+	}
+
+	if ans, set, err := c.GetBoolOk("service-1", "debug"); err != nil || !set || ans {
+		t.Errorf("c.GetBoolOk(\"service-1\",\"debug\") = %v, %v, %v", ans, set, err)
+	}
+	if ans, set, err := c.GetBoolOk("service-1", "missing"); err != nil || set || ans {
+		t.Errorf("c.GetBoolOk(\"service-1\",\"missing\") = %v, %v, %v", ans, set, err)
+	}
+	if _, set, err := c.GetBoolOk("service-2", "debug"); err != nil || set {
+		t.Errorf("c.GetBoolOk(\"service-2\",\"debug\") = %v, %v", set, err)
+	}
+}
+
+func TestIntLiterals(t *testing.T) {
+	c := NewConfigFile()
+	c.AddOption("default", "mode", "0o755")
+	c.AddOption("default", "mask", "0x1F")
+	c.AddOption("default", "flags", "0b1010")
+	c.AddOption("default", "max-size", "1_000_000")
+
+	if _, err := c.GetInt("", "mask"); !errors.Is(err, ErrParse) {
+		t.Errorf("c.GetInt(\"\",\"mask\") returned %v", err)
+	}
+
+	c.SetIntLiterals(true)
+	for option, want := range map[string]int{"mode": 0755, "mask": 31, "flags": 10, "max-size": 1000000} {
+		if ans, err := c.GetInt("", option); err != nil || ans != want {
+			t.Errorf("c.GetInt(\"\",%q) = %v, %v", option, ans, err)
+		}
+	}
+}
+
+func TestGetRatio(t *testing.T) {
+	c := NewConfigFile()
+	c.AddOption("service-1", "load-factor", "75%")
+	c.AddOption("service-1", "sample-rate", "0.25")
+	c.AddOption("service-1", "overcommit", "150%")
+	c.AddOption("service-1", "name", "half")
+
+	if ans, err := c.GetRatio("service-1", "load-factor"); err != nil || ans != 0.75 {
+		t.Errorf("c.GetRatio(\"service-1\",\"load-factor\") = %v, %v", ans, err)
+	}
+	if ans, err := c.GetRatio("service-1", "sample-rate"); err != nil || ans != 0.25 {
+		t.Errorf("c.GetRatio(\"service-1\",\"sample-rate\") = %v, %v", ans, err)
+	}
+	if _, err := c.GetRatio("service-1", "overcommit"); !errors.Is(err, ErrOutOfRange) {
+		t.Errorf("c.GetRatio(\"service-1\",\"overcommit\") returned %v", err)
+	}
+	if _, err := c.GetRatio("service-1", "name"); !errors.Is(err, ErrParse) {
+		t.Errorf("c.GetRatio(\"service-1\",\"name\") returned %v", err)
+	}
+}
+
+func TestGetTemplate(t *testing.T) {
+	c := NewConfigFile()
+	c.AddOption("log", "format", "{{.Level}}: {{.Message}}")
+	c.AddOption("log", "broken", "{{.Level")
+	c.AddOption("log", "call", "{{.Missing}}")
+
+	data := struct{ Level, Message string }{"INFO", "started"}
+	if ans, err := c.GetTemplate("log", "format", data); err != nil || ans != "INFO: started" {
+		t.Errorf("c.GetTemplate(\"log\",\"format\") = %q, %v", ans, err)
+	}
+	if _, err := c.GetTemplate("log", "broken", data); !errors.Is(err, ErrParse) {
+		t.Errorf("c.GetTemplate(\"log\",\"broken\") returned %v", err)
+	}
+	if _, err := c.GetTemplate("log", "call", data); !errors.Is(err, ErrTemplate) {
+		t.Errorf("c.GetTemplate(\"log\",\"call\") returned %v", err)
+	}
+}
+
+func TestBuiltins(t *testing.T) {
+	c := NewConfigFile()
+	c.AddOption("app", "log", "/var/log/app-%(pid)s-%(now:2006)s.log")
+	c.AddOption("app", "host", "%(hostname)s")
+
+	if _, err := c.GetString("app", "host"); !errors.Is(err, ErrOptionNotFound) {
+		t.Errorf("c.GetString(\"app\",\"host\") returned %v", err)
+	}
+	c.AddOption("app", "year", "%(now:2006)s")
+	if ans, _ := c.GetString("app", "year"); ans != "%(now:2006)s" {
+		t.Errorf("c.GetString(\"app\",\"year\") returned incorrect answer: " + ans)
+	}
+
+	c.SetBuiltins(true)
+	want := "/var/log/app-" + strconv.Itoa(os.Getpid()) + "-" + time.Now().Format("2006") + ".log"
+	if ans, _ := c.GetString("app", "log"); ans != want {
+		t.Errorf("c.GetString(\"app\",\"log\") returned incorrect answer: " + ans)
+	}
+	hostname, _ := os.Hostname()
+	if ans, _ := c.GetString("app", "host"); ans != hostname {
+		t.Errorf("c.GetString(\"app\",\"host\") returned incorrect answer: " + ans)
+	}
+
+	c.AddOption("app", "hostname", "example.com")
+	if ans, _ := c.GetString("app", "host"); ans != "example.com" {
+		t.Errorf("c.GetString(\"app\",\"host\") returned incorrect answer: " + ans)
+	}
+
+	c.SetInterpolation(ExtendedInterpolation)
+	c.AddOption("app", "stamp", "${now:15:04 2006}")
+	if ans, _ := c.GetString("app", "stamp"); !strings.HasSuffix(ans, " "+time.Now().Format("2006")) {
+		t.Errorf("c.GetString(\"app\",\"stamp\") returned incorrect answer: " + ans)
+	}
+}
+
+func TestTimeGetters(t *testing.T) {
+	c := NewConfigFile()
+	c.AddOption("retry", "backoff", "1s, 2s, 5s, 30s")
+	c.AddOption("retry", "broken", "1s, soon")
+	c.AddOption("retry", "maintenance", "02:00-04:30")
+	c.AddOption("retry", "nightly", "23:00 - 01:00:30")
+	c.AddOption("retry", "invalid", "25:00-26:00")
+
+	want := []time.Duration{time.Second, 2 * time.Second, 5 * time.Second, 30 * time.Second}
+	if ans, err := c.GetDurationList("retry", "backoff"); err != nil || len(ans) != len(want) || ans[3] != want[3] {
+		t.Errorf("c.GetDurationList(\"retry\",\"backoff\") = %v, %v", ans, err)
+	}
+	if _, err := c.GetDurationList("retry", "broken"); !errors.Is(err, ErrParse) {
+		t.Errorf("c.GetDurationList(\"retry\",\"broken\") returned %v", err)
+	}
+
+	w, err := c.GetTimeWindow("retry", "maintenance")
+	if err != nil || w.String() != "02:00-04:30" {
+		t.Errorf("c.GetTimeWindow(\"retry\",\"maintenance\") = %v, %v", w, err)
+	}
+	day := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	if !w.Contains(day.Add(3*time.Hour)) || w.Contains(day.Add(4*time.Hour+30*time.Minute)) {
+		t.Errorf("%v.Contains returned incorrect answer", w)
+	}
+	w, err = c.GetTimeWindow("retry", "nightly")
+	if err != nil || w.String() != "23:00-01:00:30" || !w.Contains(day.Add(30*time.Minute)) || w.Contains(day.Add(12*time.Hour)) {
+		t.Errorf("c.GetTimeWindow(\"retry\",\"nightly\") = %v, %v", w, err)
+	}
+	if _, err := c.GetTimeWindow("retry", "invalid"); !errors.Is(err, ErrParse) {
+		t.Errorf("c.GetTimeWindow(\"retry\",\"invalid\") returned %v", err)
+	}
+}
+
+func TestGetFileContents(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "password"), []byte("s3cret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	fname := filepath.Join(dir, "app.conf")
+	if err := os.WriteFile(fname, []byte("[db]\npassword = @file:password\nmissing = @file:nothing\nuser = app\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c, err := ReadConfigFile(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ans, err := c.GetFileContents("db", "password"); err != nil || ans != "s3cret" {
+		t.Errorf("c.GetFileContents(\"db\",\"password\") = %q, %v", ans, err)
+	}
+	if ans, err := c.GetFileContents("db", "user"); err != nil || ans != "app" {
+		t.Errorf("c.GetFileContents(\"db\",\"user\") = %q, %v", ans, err)
+	}
+	if _, err := c.GetFileContents("db", "missing"); !errors.Is(err, ErrReadFailed) || !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("c.GetFileContents(\"db\",\"missing\") returned %v", err)
+	}
+}
+
+func TestTypedMaps(t *testing.T) {
+	c := NewConfigFile()
+	c.AddOption("quotas", "alice", "100")
+	c.AddOption("quotas", "bob", "250")
+	c.AddOption("features", "search", "on")
+	c.AddOption("features", "export", "off")
+
+	if ans, err := c.GetIntMap("quotas"); err != nil || len(ans) != 2 || ans["bob"] != 250 {
+		t.Errorf("c.GetIntMap(\"quotas\") = %v, %v", ans, err)
+	}
+	if ans, err := c.GetBoolMap("features"); err != nil || len(ans) != 2 || !ans["search"] || ans["export"] {
+		t.Errorf("c.GetBoolMap(\"features\") = %v, %v", ans, err)
+	}
+
+	c.AddOption("quotas", "carol", "lots")
+	c.AddOption("quotas", "dave", "none")
+	_, err := c.GetIntMap("quotas")
+	var gerr GetError
+	if !errors.Is(err, ErrParse) || !errors.As(err, &gerr) || gerr.Option != "carol" || !strings.Contains(err.Error(), "'none'") {
+		t.Errorf("c.GetIntMap(\"quotas\") returned %v", err)
+	}
+	if _, err := c.GetBoolMap("missing"); !errors.Is(err, ErrSectionNotFound) {
+		t.Errorf("c.GetBoolMap(\"missing\") returned %v", err)
+	}
+}
+
+func TestGetOrSet(t *testing.T) {
+	c := NewConfigFile()
+	c.AddOption("service-1", "host", "localhost")
+
+	if c.SetOptionIfMissing("service-1", "HOST", "example.com") {
+		t.Error("c.SetOptionIfMissing(\"service-1\",\"HOST\") overwrote the option")
+	}
+	if !c.SetOptionIfMissing("service-2", "host", "example.com") || !c.HasSection("service-2") {
+		t.Error("c.SetOptionIfMissing(\"service-2\",\"host\") did not add the option")
+	}
+
+	if ans, err := c.GetOrSet("service-1", "host", "example.com"); err != nil || ans != "localhost" {
+		t.Errorf("c.GetOrSet(\"service-1\",\"host\") = %q, %v", ans, err)
+	}
+	if ans, err := c.GetOrSet("service-1", "url", "http://%(host)s/"); err != nil || ans != "http://localhost/" {
+		t.Errorf("c.GetOrSet(\"service-1\",\"url\") = %q, %v", ans, err)
+	}
+	if ans, _ := c.GetRawString("service-1", "url"); ans != "http://%(host)s/" {
+		t.Error("c.GetRawString(\"service-1\",\"url\") returned incorrect answer: " + ans)
+	}
+}
+
+func TestRemoveMatching(t *testing.T) {
+	c, err := ReadConfigBytes([]byte(confFile + "[service-2]\nport = 444\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	changes := 0
+	c.SetChangeHandler(func() { changes++ })
+
+	if n := c.RemoveSectionsMatching("SERVICE-*"); n != 2 || c.HasSection("service-1") || c.HasSection("service-2") {
+		t.Errorf("c.RemoveSectionsMatching(\"SERVICE-*\") = %d", n)
+	}
+	if n := c.RemoveSectionsMatching("*"); n != 0 || !c.HasSection("default") {
+		t.Errorf("c.RemoveSectionsMatching(\"*\") = %d", n)
+	}
+
+	c.AddOption("legacy", "old-host", "a")
+	c.AddOption("legacy", "old-port", "1")
+	c.AddOption("legacy", "timeout", "5s")
+	changes = 0
+	if n := c.RemoveOptionsMatching("legacy", "old-*"); n != 2 || c.HasOption("legacy", "old-host") || !c.HasOption("legacy", "timeout") {
+		t.Errorf("c.RemoveOptionsMatching(\"legacy\",\"old-*\") = %d", n)
+	}
+	if changes != 1 {
+		t.Errorf("c.RemoveOptionsMatching reported %d changes", changes)
+	}
+}
+
+func TestOrder(t *testing.T) {
+	c, err := ReadConfigBytes([]byte("[service-1]\nhost = localhost\nport = 443\nurl = http://%(host)s/\n\n[service-2]\nhost = example.com\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if i := c.SectionIndex("service-2"); i != 2 {
+		t.Errorf("c.SectionIndex(\"service-2\") = %d", i)
+	}
+	if i := c.OptionIndex("service-1", "url"); i != 2 {
+		t.Errorf("c.OptionIndex(\"service-1\",\"url\") = %d", i)
+	}
+	if i := c.OptionIndex("service-1", "missing"); i != -1 {
+		t.Errorf("c.OptionIndex(\"service-1\",\"missing\") = %d", i)
+	}
+
+	c.AddOption("service-1", "timeout", "5s")
+	if !c.MoveOption("service-1", "timeout", c.OptionIndex("service-1", "port")+1) {
+		t.Error("c.MoveOption(\"service-1\",\"timeout\") failed")
+	}
+	if !c.MoveSection("service-2", 1) || c.MoveSection("service-2", 3) {
+		t.Error("c.MoveSection(\"service-2\") returned incorrect answer")
+	}
+	if c.MoveOption("service-1", "timeout", 4) {
+		t.Error("c.MoveOption(\"service-1\",\"timeout\",4) succeeded")
+	}
+
+	want := "[service-2]\nhost=example.com\n\n[service-1]\nhost=localhost\nport=443\ntimeout=5s\nurl=http://%(host)s/\n\n"
+	if ans := string(c.WriteConfigBytes("")); ans != want {
+		t.Errorf("c.WriteConfigBytes returned %q, want %q", ans, want)
+	}
+}
+
+const documentFile = "# Service configuration\r\n" +
+	"host = example.com ; the public name\r\n" +
+	"\r\n" +
+	"[service-1]\r\n" +
+	"this line is not understood\r\n" +
+	"  port: 443\r\n" +
+	"motd = Hello,\r\n" +
+	"  world\r\n" +
+	"; end of service-1\r\n" +
+	"\r\n" +
+	"[legacy]\r\n" +
+	"timeout = 5\r\n" +
+	"timeout = 10\r\n" +
+	"[service-2]\r\n" +
+	"host = localhost"
+
+func TestDocumentMode(t *testing.T) {
+	c := NewConfigFile()
+	c.SetDocumentMode(true)
+	if err := c.Read(strings.NewReader(documentFile)); err != nil {
+		t.Fatal(err)
+	}
+	if ans := string(c.WriteConfigBytes("ignored")); ans != documentFile {
+		t.Errorf("c.WriteConfigBytes returned %q, want %q", ans, documentFile)
+	}
+
+	c.AddOption("service-1", "port", "8443")
+	c.AddOption("service-1", "motd", "Bye")
+	c.AddOption("service-1", "timeout", "30s")
+	c.RemoveSection("legacy")
+	c.AddOption("service-2", "port", "80")
+	c.AddOption("service-3", "host", "s3.example.com")
+
+	want := "# Service configuration\r\n" +
+		"host = example.com ; the public name\r\n" +
+		"\r\n" +
+		"[service-1]\r\n" +
+		"this line is not understood\r\n" +
+		"  port: 8443\r\n" +
+		"motd = Bye\r\n" +
+		"timeout=30s\r\n" +
+		"; end of service-1\r\n" +
+		"\r\n" +
+		"[service-2]\r\n" +
+		"host = localhost\r\n" +
+		"port=80\r\n" +
+		"[service-3]\r\n" +
+		"host=s3.example.com\r\n" +
+		"\r\n"
+	if ans := string(c.WriteConfigBytes("")); ans != want {
+		t.Errorf("c.WriteConfigBytes returned %q, want %q", ans, want)
+	}
+}
+
+func TestMetadata(t *testing.T) {
+	c := NewConfigFile()
+	c.AddOption("db", "password", "s3cret")
+	c.SetMetadata("db", "password", "sensitive", "true")
+	c.SetMetadata("DB", "", "owner", "dba")
+
+	if m := c.Metadata("db", "PASSWORD"); m["sensitive"] != "true" || len(m) != 1 {
+		t.Errorf("c.Metadata(\"db\",\"PASSWORD\") = %v", m)
+	}
+	if m := c.Metadata("db", ""); m["owner"] != "dba" {
+		t.Errorf("c.Metadata(\"db\",\"\") = %v", m)
+	}
+	c.Metadata("db", "password")["sensitive"] = "false"
+	if m := c.Metadata("db", "password"); m["sensitive"] != "true" {
+		t.Errorf("c.Metadata(\"db\",\"password\") = %v after modifying a copy", m)
+	}
+
+	c.RemoveOption("db", "password")
+	if m := c.Metadata("db", "password"); m != nil {
+		t.Errorf("c.Metadata(\"db\",\"password\") = %v after removal", m)
+	}
+	c.RemoveSection("db")
+	if m := c.Metadata("db", ""); m != nil {
+		t.Errorf("c.Metadata(\"db\",\"\") = %v after removal", m)
+	}
+}
+
+func TestUndo(t *testing.T) {
+	c := NewConfigFile()
+	c.AddOption("service-1", "host", "localhost")
+	c.SetHistory(2)
+
+	if c.Undo() {
+		t.Error("c.Undo() succeeded without modifications")
+	}
+	c.AddOption("service-1", "host", "a.example.com")
+	c.AddOption("service-1", "host", "b.example.com")
+	c.SetInterpolation(ExtendedInterpolation) // not recorded
+	c.AddOption("service-1", "host", "c.example.com")
+
+	for _, want := range []string{"b.example.com", "a.example.com"} {
+		if !c.Undo() {
+			t.Fatal("c.Undo() failed")
+		}
+		if ans, _ := c.GetString("service-1", "host"); ans != want {
+			t.Errorf("c.GetString(\"service-1\",\"host\") returned %q after undo, want %q", ans, want)
+		}
+	}
+	if c.Undo() {
+		t.Error("c.Undo() went beyond the history depth")
+	}
+
+	if !c.Redo() {
+		t.Fatal("c.Redo() failed")
+	}
+	if ans, _ := c.GetString("service-1", "host"); ans != "b.example.com" {
+		t.Errorf("c.GetString(\"service-1\",\"host\") returned %q after redo", ans)
+	}
+	c.RemoveOption("service-1", "host")
+	if c.Redo() {
+		t.Error("c.Redo() succeeded after a modification")
+	}
+	if !c.Undo() || !c.HasOption("service-1", "host") {
+		t.Error("c.Undo() did not restore the removed option")
+	}
+}
+
+func TestValidator(t *testing.T) {
+	c := NewConfigFile()
+	c.AddOption("service-1", "port", "443")
+	c.SetValidator("service-1", "PORT", func(value string) error {
+		_, err := strconv.Atoi(value)
+		return err
+	})
+
+	if c.AddOption("service-1", "port", "https") {
+		t.Error("c.AddOption(\"service-1\",\"port\",\"https\") accepted an invalid value")
+	}
+	err := c.SetOption("service-1", "port", "https")
+	var serr SetError
+	if !errors.Is(err, ErrInvalidValue) || !errors.Is(err, strconv.ErrSyntax) || !errors.As(err, &serr) || serr.Value != "https" {
+		t.Errorf("c.SetOption(\"service-1\",\"port\",\"https\") returned %v", err)
+	}
+	if ans, _ := c.GetString("service-1", "port"); ans != "443" {
+		t.Error("c.GetString(\"service-1\",\"port\") returned incorrect answer: " + ans)
+	}
+	if err := c.SetOption("service-1", "port", "8443"); err != nil {
+		t.Errorf("c.SetOption(\"service-1\",\"port\",\"8443\") returned %v", err)
+	}
+
+	if err := c.Read(strings.NewReader("[service-1]\nport = http\n")); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("c.Read returned %v", err)
+	}
+
+	tx := c.Begin()
+	tx.AddOption("service-1", "host", "localhost")
+	tx.AddOption("service-1", "port", "http")
+	if err := tx.Commit(); !errors.Is(err, ErrInvalidValue) || c.HasOption("service-1", "host") {
+		t.Errorf("tx.Commit() returned %v", err)
+	}
+}
+
+func TestProtect(t *testing.T) {
+	c := NewConfigFile()
+	c.AddOption("core", "listen", ":443")
+	c.AddOption("service-1", "host", "localhost")
+	c.AddOption("service-1", "port", "443")
+	c.ProtectSection("CORE")
+	c.ProtectOption("service-1", "host")
+
+	if err := c.SetOption("core", "listen", ":80"); !errors.Is(err, ErrProtected) {
+		t.Errorf("c.SetOption(\"core\",\"listen\") returned %v", err)
+	}
+	if c.AddOption("core", "debug", "on") || c.RemoveOption("core", "listen") || c.RemoveSection("core") {
+		t.Error("modified protected section core")
+	}
+	if err := c.SetOption("service-1", "host", "example.com"); !errors.Is(err, ErrProtected) {
+		t.Errorf("c.SetOption(\"service-1\",\"host\") returned %v", err)
+	}
+	if c.RemoveOption("service-1", "host") {
+		t.Error("removed protected option host")
+	}
+	if err := c.SetOption("service-1", "port", "8443"); err != nil {
+		t.Errorf("c.SetOption(\"service-1\",\"port\") returned %v", err)
+	}
+
+	tx := c.Begin()
+	tx.RemoveSection("core")
+	if err := tx.Commit(); !errors.Is(err, ErrProtected) || !c.HasSection("core") {
+		t.Errorf("tx.Commit() returned %v", err)
+	}
+}
+
+func TestPlaceholderSyntax(t *testing.T) {
+	c := NewConfigFile()
+	c.AddOption("default", "host", "example.com")
+	for value, want := range map[string]string{
+		"100%":                   "100%",
+		"%(host)":                "%(host)",
+		"%(host)s%(host)s":       "example.comexample.com",
+		"%(host":                 "%(host",
+		"%()s":                   "%()s",
+		"%(host:arg)s":           "%(host:arg)s",
+		"$(echo)":                "$(echo)",
+		"${host}":                "${host}",
+		"%%(host)s":              "%example.com",
+		"http://%(host)s/%(x)s)": "",
+	} {
+		c.AddOption("basic", "value", value)
+		if ans, _ := c.GetString("basic", "value"); ans != want {
+			t.Errorf("basic %q unfolded to %q, want %q", value, ans, want)
+		}
+	}
+
+	c.SetInterpolation(ExtendedInterpolation)
+	for value, want := range map[string]string{
+		"$":                 "$",
+		"$$${host}$$":       "$example.com$",
+		"${host":            "${host",
+		"${default:host}":   "example.com",
+		"${host with text}": "${host with text}",
+		"${}":               "",
+		"%(host)s":          "%(host)s",
+	} {
+		c.AddOption("extended", "value", value)
+		if ans, _ := c.GetString("extended", "value"); ans != want {
+			t.Errorf("extended %q unfolded to %q, want %q", value, ans, want)
+		}
+	}
+}
+
+func TestKey(t *testing.T) {
+	c := NewConfigFile()
+	c.AddOption("default", "host", "example.com")
+	c.AddOption("Service-1", "URL", "http://%(host)s/")
+	c.AddOption("service-1", "workers", "4")
+	url, workers, debug := c.Key("SERVICE-1", "url"), c.Key("service-1", "Workers"), c.Key("", "debug")
+
+	if value, err := url.String(); err != nil || value != "http://example.com/" {
+		t.Errorf("url.String() returned %q, %v", value, err)
+	}
+	if value, err := workers.Int(); err != nil || value != 4 {
+		t.Errorf("workers.Int() returned %d, %v", value, err)
+	}
+	if _, err := debug.Bool(); !errors.Is(err, ErrOptionNotFound) {
+		t.Errorf("debug.Bool() returned %v", err)
+	}
+
+	c.AddOption("default", "host", "example.org")
+	c.AddOption("default", "debug", "on")
+	if value, _ := url.String(); value != "http://example.org/" {
+		t.Errorf("url.String() returned %q after modification", value)
+	}
+	if value, err := debug.Bool(); err != nil || !value {
+		t.Errorf("debug.Bool() returned %v, %v after modification", value, err)
+	}
+
+	if n := testing.AllocsPerRun(100, func() { url.String(); workers.Int() }); n != 0 {
+		t.Errorf("reading keys allocated %v times", n)
+	}
+}
+
+func TestClone(t *testing.T) {
+	c, err := ReadConfigBytes([]byte("[service-1]\nhost = localhost\nport = 443\n[service-2]\nhost = example.com\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.SetDefault("service-1", "timeout", "10s")
+	dup := c.Clone()
+
+	dup.AddOption("service-1", "host", "example.org")
+	dup.RemoveOption("service-1", "port")
+	dup.SetDefault("service-1", "timeout", "20s")
+	c.AddOption("service-2", "port", "8080")
+	c.AddSection("service-3")
+
+	for _, test := range []struct {
+		c               *ConfigFile
+		section, option string
+		want            string
+	}{
+		{c, "service-1", "host", "localhost"},
+		{c, "service-1", "port", "443"},
+		{c, "service-1", "timeout", "10s"},
+		{c, "service-2", "port", "8080"},
+		{dup, "service-1", "host", "example.org"},
+		{dup, "service-1", "port", ""},
+		{dup, "service-1", "timeout", "20s"},
+		{dup, "service-2", "host", "example.com"},
+		{dup, "service-2", "port", ""},
+	} {
+		if value, _ := test.c.GetString(test.section, test.option); value != test.want {
+			t.Errorf("%s.%s = %q, want %q", test.section, test.option, value, test.want)
+		}
+	}
+	if dup.HasSection("service-3") {
+		t.Error("section added to the original appeared in the clone")
+	}
+	if loc, ok := dup.Source("service-2", "host"); !ok || loc.Line != 5 {
+		t.Errorf("dup.Source(\"service-2\",\"host\") = %v, %v", loc, ok)
+	}
+}
+
+func TestInterning(t *testing.T) {
+	data := generatedConfig()
+	interned, err := ReadConfigBytes(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewConfigFile()
+	c.SetInterning(false)
+	if err = c.Read(bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+
+	if interned.StringRedacted() != c.StringRedacted() {
+		t.Error("configurations read with and without interning differ")
+	}
+}
+
+func TestLazy(t *testing.T) {
+	data := "host = example.com\n[service-1]\nurl = http://%(host)s/\n  api\n[Service-2]\nport = 8080\n[service-1]\nport = 443\n"
+	c := NewConfigFile()
+	c.SetLazy(true)
+	if err := c.Read(strings.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	eager, _ := ReadConfigBytes([]byte(data))
+
+	if !c.HasSection("service-2") || c.SectionIndex("service-2") != 2 {
+		t.Error("section service-2 not indexed in order")
+	}
+	for _, option := range []string{"url", "port"} {
+		value, err := c.GetString("service-1", option)
+		want, _ := eager.GetString("service-1", option)
+		if err != nil || value != want {
+			t.Errorf("c.GetString(\"service-1\",%q) = %q, %v, want %q", option, value, err, want)
+		}
+	}
+	if loc, ok := c.Source("service-1", "port"); !ok || loc.Line != 8 {
+		t.Errorf("c.Source(\"service-1\",\"port\") = %v, %v", loc, ok)
+	}
+	if c.StringRedacted() != eager.StringRedacted() {
+		t.Error("configurations read lazily and eagerly differ")
+	}
+
+	c = NewConfigFile()
+	c.SetLazy(true)
+	c.SetOptionNormalizer(func(name string) string { return strings.ReplaceAll(strings.ToLower(name), "_", "-") })
+	if err := c.Read(strings.NewReader("[s]\nmax_clients = 5\n")); err != nil {
+		t.Fatal(err)
+	}
+	if value, err := c.GetString("s", "max-clients"); err != nil || value != "5" {
+		t.Errorf("c.GetString(\"s\",\"max-clients\") = %q, %v with a normalizer", value, err)
+	}
+
+	for _, data := range []string{"[service-1]\n  continued\n", "[]\nport = 443\n"} {
+		c := NewConfigFile()
+		c.SetLazy(true)
+		if err := c.Read(strings.NewReader(data)); err == nil {
+			t.Errorf("read %q without error", data)
+		}
+	}
+}
+
+func TestStats(t *testing.T) {
+	c := NewConfigFile()
+	c.SetCapacity(100, 10)
+	for i := 0; i < 100; i++ {
+		for j := 0; j < 10; j++ {
+			c.AddOption("section-"+strconv.Itoa(i), "option-"+strconv.Itoa(j), "value")
+		}
+	}
+
+	st := c.Stats()
+	if st.Sections != 101 || st.Options != 1000 {
+		t.Errorf("c.Stats() = %+v, want 101 sections and 1000 options", st)
+	}
+	c.AddOption("section-1", "description", strings.Repeat("x", 1000))
+	if grown := c.Stats(); grown.Bytes <= st.Bytes+1000 {
+		t.Errorf("c.Stats().Bytes grew from %d to %d", st.Bytes, grown.Bytes)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	limits := Limits{MaxSize: 100, MaxLineLength: 20, MaxSections: 2, MaxOptions: 3}
+	for _, data := range []string{
+		strings.Repeat("# comment\n", 11),
+		"option = " + strings.Repeat("x", 12) + "\n",
+		"[a]\n[b]\n[c]\n",
+		"a = 1\nb = 2\n[a]\nc = 3\nd = 4\n",
+	} {
+		for _, lazy := range []bool{false, true} {
+			c := NewConfigFile()
+			c.SetLimits(limits)
+			c.SetLazy(lazy)
+			if err := c.Read(strings.NewReader(data)); !errors.Is(err, ErrLimitExceeded) {
+				t.Errorf("reading %q (lazy %v) returned %v", data, lazy, err)
+			}
+		}
+	}
+	if _, err := HardenedRead(strings.NewReader(strings.Repeat("x", 100<<10) + " = y\n")); !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("HardenedRead of a long line returned %v", err)
+	}
+
+	// each level doubles the length of the value
+	bomb := "a0 = x\n"
+	for i := 1; i <= 40; i++ {
+		bomb += fmt.Sprintf("a%d = %%(a%d)s%%(a%d)s\n", i, i-1, i-1)
+	}
+	c, err := HardenedRead(strings.NewReader(bomb))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = c.GetString("default", "a40"); !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("c.GetString(\"default\",\"a40\") returned %v", err)
+	}
+	if value, err := c.GetString("default", "a10"); err != nil || len(value) != 1024 {
+		t.Errorf("c.GetString(\"default\",\"a10\") returned %d bytes, %v", len(value), err)
+	}
+}
+
+func TestLogger(t *testing.T) {
+	var messages []string
+	c := NewConfigFile()
+	c.SetLogger(LoggerFunc(func(format string, args ...any) {
+		messages = append(messages, fmt.Sprintf(format, args...))
+	}))
+	if err := c.Read(strings.NewReader(confFile)); err != nil {
+		t.Fatal(err)
+	}
+	c.AddOption("service-1", "password", "hunter2")
+	c.AddEnvOverrides("GOCONF_TEST")
+	t.Setenv("GOCONF_TEST_SERVICE1_PORT", "8443")
+
+	c.GetString("service-1", "url")
+	c.GetString("service-1", "port")
+	c.GetString("service-1", "password")
+	log := strings.Join(messages, "\n")
+	for _, want := range []string{
+		"<input>:8: section 'service-1'",
+		"<input>: read 10 lines, 2 sections, 6 options",
+		"option 'url' in section 'service-1': %(host)s refers to option 'host'",
+		`option 'url' in section 'service-1' is "http://example.com/something", from <input>:10`,
+		"option 'port' in section 'service-1' overridden by environment variable GOCONF_TEST_SERVICE1_PORT",
+		`option 'port' in section 'service-1' is "8443", from env:GOCONF_TEST_SERVICE1_PORT`,
+		`option 'password' in section 'service-1' is "********", from an unknown location`,
+	} {
+		if !strings.Contains(log, want) {
+			t.Errorf("log lacks %q:\n%s", want, log)
+		}
+	}
+}
+
+type countingMetrics struct {
+	reads, readErrors, hits, misses, reloads, reloadErrors, invalid int
+}
+
+func (m *countingMetrics) ConfigRead(err error) {
+	m.reads++
+	if err != nil {
+		m.readErrors++
+	}
+}
+
+func (m *countingMetrics) CacheLookup(hit bool) {
+	if hit {
+		m.hits++
+	} else {
+		m.misses++
+	}
+}
+
+func (m *countingMetrics) ConfigReloaded(err error) {
+	m.reloads++
+	if err != nil {
+		m.reloadErrors++
+	}
+}
+
+func (m *countingMetrics) ValidationFailed(section string, option string) {
+	m.invalid++
+}
+
+func TestMetrics(t *testing.T) {
+	m := &countingMetrics{}
+	SetMetrics(m)
+	defer SetMetrics(nil)
+
+	fname := filepath.Join(t.TempDir(), "test.conf")
+	if err := os.WriteFile(fname, []byte(confFile), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewReloader(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	c := r.Load()
+	c.GetString("service-1", "url")
+	c.GetString("service-1", "url")
+	c.SetValidator("default", "port", func(string) error { return errors.New("no") })
+	c.AddOption("default", "port", "80")
+
+	r.Validate = func(*ConfigFile) error { return errors.New("no") }
+	r.Reload()
+	if _, err := ReadConfigFile(fname + ".missing"); err == nil {
+		t.Error("read missing file")
+	}
+
+	want := countingMetrics{reads: 3, readErrors: 1, hits: 1, misses: 1, reloads: 1, reloadErrors: 1, invalid: 2}
+	if *m != want {
+		t.Errorf("metrics %+v, want %+v", *m, want)
+	}
+}
+
+func TestLoadUserConfig(t *testing.T) {
+	home, xdg := t.TempDir(), t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", xdg)
+	t.Setenv("APPDATA", "")
+	app := "goconf-test-" + strconv.Itoa(os.Getpid())
+
+	if _, paths, err := LoadUserConfig(app); err != nil || len(paths) != 0 {
+		t.Fatalf("LoadUserConfig without files: %v, %v", paths, err)
+	}
+
+	write := func(dir string, text string) string {
+		path := filepath.Join(dir, app, app+".conf")
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(text), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	user := write(filepath.Join(home, ".config"), "[server]\nport = 80\nhost = example.com\n")
+	xdgPath := write(xdg, "[server]\nport = 8080\n")
+
+	c, paths, err := LoadUserConfig(app)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != 2 || paths[0] != xdgPath || paths[1] != user {
+		t.Errorf("paths %v, want [%s %s]", paths, xdgPath, user)
+	}
+	if port, _ := c.GetInt("server", "port"); port != 8080 {
+		t.Errorf("port %d, want 8080", port)
+	}
+	if host, _ := c.GetString("server", "host"); host != "example.com" {
+		t.Errorf("host %q, want example.com", host)
+	}
+	if loc, _ := c.Source("server", "host"); loc.File != user || loc.Line != 3 {
+		t.Errorf("host from %v, want %s:3", loc, user)
+	}
+}
+
+func TestEnsureConfigFile(t *testing.T) {
+	defaults := NewConfigFile()
+	defaults.AddOption("server", "host", "localhost")
+	defaults.AddOption("server", "port", "80")
+	fname := filepath.Join(t.TempDir(), "app.conf")
+
+	c, created, err := EnsureConfigFile(fname, defaults, 0o600)
+	if err != nil || !created {
+		t.Fatalf("EnsureConfigFile() = %v, %v; want created", created, err)
+	}
+	if port, _ := c.GetInt("server", "port"); port != 80 {
+		t.Errorf("port %d, want 80", port)
+	}
+	data, err := os.ReadFile(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "# Default configuration. Uncomment options to change them.\n\n[server]\n# host = localhost\n# port = 80\n"
+	if string(data) != want {
+		t.Errorf("created\n%s\nwant\n%s", data, want)
+	}
+	if fi, _ := os.Stat(fname); runtime.GOOS != "windows" && fi.Mode().Perm() != 0o600 {
+		t.Errorf("created with mode %v, want 0600", fi.Mode().Perm())
+	}
+
+	if err := os.WriteFile(fname, append(data, "port = 8080\n"...), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	c, created, err = EnsureConfigFile(fname, defaults, 0o600)
+	if err != nil || created {
+		t.Fatalf("EnsureConfigFile() = %v, %v; want loaded", created, err)
+	}
+	if port, _ := c.GetInt("server", "port"); port != 8080 {
+		t.Errorf("port %d, want 8080", port)
+	}
+	if host, _ := c.GetString("server", "host"); host != "localhost" {
+		t.Errorf("host %q, want localhost", host)
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(fname)); len(entries) != 1 {
+		t.Errorf("%d files left, want 1", len(entries))
+	}
+}
+
+func TestSystemdMode(t *testing.T) {
+	const unit = `[Unit]
+Description=Example # not a comment
+After=network.target
+
+[Service]
+ExecStart=/usr/bin/example \
+    --verbose \
+    # ignored
+    --port=80
+Environment=A=1
+Environment=B=2
+RemainAfterExit=yes
+`
+	c := NewConfigFile()
+	c.SetSystemdMode(true)
+	if err := c.Read(strings.NewReader(unit)); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct{ section, option, want string }{
+		{"Unit", "Description", "Example # not a comment"},
+		{"Service", "ExecStart", "/usr/bin/example --verbose --port=80"},
+		{"Service", "Environment", "A=1\nB=2"},
+		{"Service", "RemainAfterExit", "yes"},
+	} {
+		if got, err := c.GetRawString(tc.section, tc.option); err != nil || got != tc.want {
+			t.Errorf("GetRawString(%q, %q) = %q, %v; want %q", tc.section, tc.option, got, err, tc.want)
+		}
+	}
+	if c.HasSection("unit") {
+		t.Error("section names are not case sensitive")
+	}
+	if loc, _ := c.Source("Service", "RemainAfterExit"); loc.Line != 12 {
+		t.Errorf("RemainAfterExit read from line %d, want 12", loc.Line)
+	}
+
+	dropin := "[Service]\nExecStart=\nExecStart=/usr/bin/other\nEnvironment=C=3\n"
+	if err := c.Read(strings.NewReader(dropin)); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := c.GetRawString("Service", "ExecStart"); got != "\n/usr/bin/other" {
+		t.Errorf("ExecStart after drop-in = %q", got)
+	}
+
+	want := `[Unit]
+Description=Example # not a comment
+After=network.target
+
+[Service]
+ExecStart=
+ExecStart=/usr/bin/other
+Environment=A=1
+Environment=B=2
+Environment=C=3
+RemainAfterExit=yes
+
+`
+	if got := string(c.WriteConfigBytes("")); got != want {
+		t.Errorf("wrote\n%s\nwant\n%s", got, want)
+	}
+
+	c = NewConfigFile()
+	c.SetSystemdMode(true)
+	c.SetDocumentMode(true)
+	if err := c.Read(strings.NewReader(unit)); err != nil {
+		t.Fatal(err)
+	}
+	c.AddOption("Service", "Environment", "A=1\nB=3")
+	want = strings.Replace(unit, "Environment=B=2\n", "", 1)
+	want = strings.Replace(want, "Environment=A=1", "Environment=A=1\nEnvironment=B=3", 1)
+	if got := string(c.WriteConfigBytes("")); got != want {
+		t.Errorf("document mode wrote\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestReadNested(t *testing.T) {
+	c, err := ReadNested(strings.NewReader(`# main server
+ServerName example.com
+<VirtualHost *:80>
+    DocumentRoot "/var/www/html"
+    <Directory /var/www/html>
+        Options Indexes \
+            FollowSymLinks
+        Require all granted
+    </Directory>
+</VirtualHost>
+<VirtualHost *:80>
+    ServerAlias www.example.com
+</VirtualHost>
+`), ApacheStyle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct{ section, option, want string }{
+		{"default", "servername", "example.com"},
+		{"virtualhost *:80", "documentroot", `"/var/www/html"`},
+		{"virtualhost *:80/directory /var/www/html", "options", "Indexes FollowSymLinks"},
+		{"virtualhost *:80#2", "serveralias", "www.example.com"},
+	} {
+		if got, err := c.GetRawString(tc.section, tc.option); err != nil || got != tc.want {
+			t.Errorf("GetRawString(%q, %q) = %q, %v; want %q", tc.section, tc.option, got, err, tc.want)
+		}
+	}
+	if loc, _ := c.Source("virtualhost *:80/directory /var/www/html", "require"); loc.Line != 8 {
+		t.Errorf("require read from line %d, want 8", loc.Line)
+	}
+
+	c, err = ReadNested(strings.NewReader(`worker_processes 4;
+http {
+    server {
+        listen 80; listen [::]:80;
+        location /api { proxy_pass http://api; }  # backend
+        add_header X-Frame-Options "SAMEORIGIN;" always;
+        log_format main '$remote_addr'
+                        '$status';
+    }
+}
+`), NginxStyle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct{ section, option, want string }{
+		{"default", "worker_processes", "4"},
+		{"http/server", "listen", "80\n[::]:80"},
+		{"http/server/location /api", "proxy_pass", "http://api"},
+		{"http/server", "add_header", `X-Frame-Options "SAMEORIGIN;" always`},
+		{"http/server", "log_format", `main '$remote_addr' '$status'`},
+	} {
+		if got, err := c.GetRawString(tc.section, tc.option); err != nil || got != tc.want {
+			t.Errorf("GetRawString(%q, %q) = %q, %v; want %q", tc.section, tc.option, got, err, tc.want)
+		}
+	}
+
+	for _, input := range []string{"<a>\n</b>\n", "<a>\n", "</a>\n"} {
+		if _, err := ReadNested(strings.NewReader(input), ApacheStyle); err == nil {
+			t.Errorf("ReadNested(%q) succeeded", input)
+		}
+	}
+	for _, input := range []string{"a {\n", "}\n", "a b\n", "a 'b;\n"} {
+		if _, err := ReadNested(strings.NewReader(input), NginxStyle); err == nil {
+			t.Errorf("ReadNested(%q) succeeded", input)
+		}
+	}
+}
+
+func TestPythonMode(t *testing.T) {
+	// expectations as produced by Python's configparser.ConfigParser
+	const input = `# comment
+[DEFAULT]
+Home = /srv
+
+[Paths]
+data = %(home)s/data ; not a comment
+share: 100%%
+multi = first
+  second = still value
+
+  # comment in value
+  third
+
+Next=x
+[paths]
+lower = 1
+`
+	c := NewConfigFile()
+	c.SetPythonMode(true)
+	if err := c.Read(strings.NewReader(input)); err != nil {
+		t.Fatal(err)
+	}
+	if got := c.GetSections(); !reflect.DeepEqual(got, []string{"default", "Paths", "paths"}) {
+		t.Errorf("sections %q", got)
+	}
+	for _, tc := range []struct{ section, option, want string }{
+		{"Paths", "data", "/srv/data ; not a comment"},
+		{"Paths", "share", "100%"},
+		{"Paths", "multi", "first\nsecond = still value\n\nthird"},
+		{"Paths", "NEXT", "x"},
+		{"paths", "home", "/srv"},
+	} {
+		if got, err := c.GetString(tc.section, tc.option); err != nil || got != tc.want {
+			t.Errorf("GetString(%q, %q) = %q, %v; want %q", tc.section, tc.option, got, err, tc.want)
+		}
+	}
+
+	want := "[DEFAULT]\nhome = /srv\n\n[Paths]\ndata = %(home)s/data ; not a comment\nshare = 100%%\nmulti = first\n\tsecond = still value\n\t\n\tthird\nnext = x\n\n[paths]\nlower = 1\n\n"
+	if got := string(c.WriteConfigBytes("")); got != want {
+		t.Errorf("wrote %q, want %q", got, want)
+	}
+
+	for input, reason := range map[string]int{
+		"[a]\nx=1\nx=2\n": Duplicate,
+		"[a]\n[a]\n":      Duplicate,
+		"x=1\n":           BlankSection,
+	} {
+		c := NewConfigFile()
+		c.SetPythonMode(true)
+		var rerr ReadError
+		if err := c.Read(strings.NewReader(input)); !errors.As(err, &rerr) || rerr.Reason != reason {
+			t.Errorf("Read(%q) = %v, want reason %d", input, err, reason)
+		}
+	}
+	c.AddOption("paths", "bad", "%z")
+	if _, err := c.GetString("paths", "bad"); !errors.Is(err, ErrParse) {
+		t.Errorf("GetString of %%z = %v, want ErrParse", err)
+	}
+}
+
+func TestGitMode(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "included"), []byte("[user]\n\temail = me@example.com\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	const input = `[core]
+	bare
+	editor = "vim -f" ; comment
+	pager = less \
+		-R
+[Remote "Origin"]
+	url = git@example.com:repo.git # comment
+	fetch = +refs/heads/*:refs/remotes/origin/*
+	fetch = +refs/tags/*:refs/tags/*
+[alias]
+	lg = "log --format=\"%h %s\"\t#"
+	empty =
+[include]
+	path = included
+	path = missing
+`
+	fname := filepath.Join(dir, "config")
+	if err := os.WriteFile(fname, []byte(input), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	c := NewConfigFile()
+	c.SetGitMode(true)
+	if err := c.ReadFile(fname); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct{ section, option, want string }{
+		{"core", "bare", "true"},
+		{"core", "editor", "vim -f"},
+		{"core", "pager", "less   -R"},
+		{"remote.Origin", "URL", "git@example.com:repo.git"},
+		{"REMOTE.Origin", "fetch", "+refs/tags/*:refs/tags/*"},
+		{"alias", "lg", "log --format=\"%h %s\"\t#"},
+		{"user", "email", "me@example.com"},
+	} {
+		if got, err := c.GetString(tc.section, tc.option); err != nil || got != tc.want {
+			t.Errorf("GetString(%q, %q) = %q, %v; want %q", tc.section, tc.option, got, err, tc.want)
+		}
+	}
+	if c.HasSection("remote.origin") {
+		t.Error("subsection names are not case sensitive")
+	}
+	if b, err := c.GetBool("alias", "empty"); err != nil || b {
+		t.Errorf("GetBool of empty value = %v, %v; want false", b, err)
+	}
+
+	c.AddOption("core", "bare", "false")
+	c.AddOption("remote.Origin", "prune", "true")
+	c.RemoveSection("include")
+	want := `[core]
+	bare = false
+	editor = vim -f
+	pager = less   -R
+
+[remote "Origin"]
+	url = git@example.com:repo.git
+	fetch = +refs/tags/*:refs/tags/*
+	prune = true
+
+[alias]
+	lg = "log --format=\"%h %s\"\t#"
+	empty = 
+
+[user]
+	email = me@example.com
+
+`
+	if got := string(c.WriteConfigBytes("")); got != want {
+		t.Errorf("wrote\n%s\nwant\n%s", got, want)
+	}
+
+	doc := NewConfigFile()
+	doc.SetGitMode(true)
+	doc.SetDocumentMode(true)
+	if err := doc.ReadFile(fname); err != nil {
+		t.Fatal(err)
+	}
+	if doc.HasSection("user") {
+		t.Error("included file read in document mode")
+	}
+	doc.AddOption("core", "bare", "false")
+	doc.AddOption("remote.Origin", "prune", "true")
+	want = strings.Replace(input, "\tbare\n", "\tbare = false\n", 1)
+	want = strings.Replace(want, "refs/tags/*\n", "refs/tags/*\n\tprune = true\n", 1)
+	if got := string(doc.WriteConfigBytes("")); got != want {
+		t.Errorf("document mode wrote\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestPHPMode(t *testing.T) {
+	const input = `engine = On
+; comment
+[PHP]
+error_reporting = E_ALL & ~(E_NOTICE | E_STRICT) ; comment
+display_errors = Off
+include_path = ".:/usr/share/php;/opt" ; comment
+#notacomment = 1
+SMTP = localhost
+[Date]
+date.timezone = 'Europe/Vienna'
+memory_limit = 128M
+[Pdo]
+memory_limit = 256M
+`
+	c := NewConfigFile()
+	c.SetPHPMode(true)
+	if err := c.Read(strings.NewReader(input)); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct{ section, option, want string }{
+		{"", "engine", "1"},
+		{"PHP", "error_reporting", "30711"},
+		{"", "error_reporting", "30711"},
+		{"PHP", "display_errors", ""},
+		{"PHP", "include_path", ".:/usr/share/php;/opt"},
+		{"PHP", "#notacomment", "1"},
+		{"", "SMTP", "localhost"},
+		{"Date", "date.timezone", "Europe/Vienna"},
+		{"Date", "memory_limit", "128M"},
+		{"", "memory_limit", "256M"},
+	} {
+		if got, err := c.GetString(tc.section, tc.option); err != nil || got != tc.want {
+			t.Errorf("GetString(%q, %q) = %q, %v; want %q", tc.section, tc.option, got, err, tc.want)
+		}
+	}
+	if _, err := c.GetString("", "smtp"); err == nil {
+		t.Error("option names are not case sensitive")
+	}
+	if b, err := c.GetBool("PHP", "display_errors"); err != nil || b {
+		t.Errorf("GetBool of Off = %v, %v; want false", b, err)
+	}
+	if raw, _ := c.GetRawString("PHP", "include_path"); raw != `".:/usr/share/php;/opt"` {
+		t.Errorf("GetRawString = %q", raw)
+	}
+
+	c.RemoveSection("Date")
+	c.RemoveSection("Pdo")
+	c.RemoveOption("PHP", "#notacomment")
+	want := `engine = On
+
+[PHP]
+error_reporting = E_ALL & ~(E_NOTICE | E_STRICT)
+display_errors = Off
+include_path = ".:/usr/share/php;/opt"
+SMTP = localhost
+
+`
+	if got := string(c.WriteConfigBytes("")); got != want {
+		t.Errorf("wrote\n%s\nwant\n%s", got, want)
+	}
+
+	for _, input := range []string{"value\n", "a : b\n"} {
+		c := NewConfigFile()
+		c.SetPHPMode(true)
+		if err := c.Read(strings.NewReader(input)); err == nil {
+			t.Errorf("Read(%q) succeeded", input)
+		}
+	}
+}
+
+func TestDialect(t *testing.T) {
+	c, err := ReadConfigBytes([]byte("[DEFAULT]\nname = base\n[Paths]\nhome = /home/%(name)s\n  more\n"), PythonDialect)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := c.GetString("Paths", "home"); err != nil || got != "/home/base\nmore" {
+		t.Errorf("GetString = %q, %v", got, err)
+	}
+	want := "[Paths]\n\thome = /home/%(name)s\\nmore\n\n"
+	if got := string(c.WriteConfigBytes("", GitDialect)); !strings.HasSuffix(got, want) {
+		t.Errorf("wrote in git dialect\n%s\nwant suffix\n%s", got, want)
+	}
+	written := make(chan string)
+	for i := 0; i < 2; i++ { // writing in another dialect does not modify c
+		go func() { written <- string(c.WriteConfigBytes("", GitDialect)) }()
+	}
+	for i := 0; i < 2; i++ {
+		if got := <-written; !strings.HasSuffix(got, want) {
+			t.Errorf("wrote concurrently in git dialect\n%s", got)
+		}
+	}
+
+	d := DefaultDialect
+	d.CommentPrefixes = []string{"//"}
+	d.Delimiters = "="
+	d.Duplicates = DuplicatesError
+	d.Interpolation = NoInterpolation
+	c, err = ReadConfigBytes([]byte("// comment\n[s]\nurl = http://host:80 // kept\nref = %(url)s\n"), d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for option, want := range map[string]string{"url": "http://host:80 // kept", "ref": "%(url)s"} {
+		if got, err := c.GetString("s", option); err != nil || got != want {
+			t.Errorf("GetString(%q) = %q, %v; want %q", option, got, err, want)
+		}
+	}
+	if got := c.Dialect().Duplicates; got != DuplicatesError {
+		t.Errorf("Dialect().Duplicates = %d", got)
+	}
+	if got := string(c.WriteConfigBytes("")); !strings.Contains(got, "url=http://host:80 // kept\n") {
+		t.Errorf("wrote\n%s", got)
+	}
+
+	for input, reason := range map[string]int{
+		"[s]\na = 1\na = 2\n":    Duplicate,
+		"[s]\n[s]\n":             Duplicate,
+		"[s]\na = 1\n  more\n":   CouldNotParse,
+		"[s]\na : 1\n":           CouldNotParse,
+		"[s]\nrem comment = 1\n": -1,
+	} {
+		_, err := ReadConfigBytes([]byte(input), StrictDialect)
+		var rerr ReadError
+		if reason < 0 {
+			if err != nil {
+				t.Errorf("strict Read(%q) = %v", input, err)
+			}
+		} else if !errors.As(err, &rerr) || rerr.Reason != reason {
+			t.Errorf("strict Read(%q) = %v, want reason %d", input, err, reason)
+		}
+	}
+}
+
+func TestMerge3(t *testing.T) {
+	read := func(text string) *ConfigFile {
+		c, err := ReadConfigBytes([]byte(text))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+	base := read("[server]\nport = 80\nworkers = 4\nlog = info\nold = 1\n\n[cache]\nsize = 10\n")
+	ours := read("[server]\nport = 8080\nworkers = 4\nlog = debug\nold = 1\nmine = yes\n\n[cache]\nsize = 10\n")
+	theirs := read("[server]\nport = 80\nworkers = 8\nlog = warn\ntimeout = 30\n\n[metrics]\npath = /metrics\n")
+
+	merged, conflicts := Merge3(base, ours, theirs)
+	want := "[server]\nport=8080\nworkers=8\nlog=debug\nmine=yes\ntimeout=30\n\n[metrics]\npath=/metrics\n\n"
+	if got := string(merged.WriteConfigBytes("")); got != want {
+		t.Errorf("merged\n%s\nwant\n%s", got, want)
+	}
+	wantConflicts := []Conflict{{"server", "log", "info", "debug", "warn"}}
+	if !reflect.DeepEqual(conflicts, wantConflicts) {
+		t.Errorf("conflicts %+v, want %+v", conflicts, wantConflicts)
+	}
+	if got, _ := ours.GetString("server", "workers"); got != "4" {
+		t.Error("Merge3 modified ours")
+	}
+}
+
+func TestEqual(t *testing.T) {
+	a, err := ReadConfigBytes([]byte("[server]\nport = 80\ntls = on\nhost = %(name)s.example.com\nname = www\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ReadConfigBytes([]byte("[empty]\n[Server]\nName: www # the host\nhost = www.example.com\nTLS = true\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.SetDefault("server", "port", "80")
+
+	if !a.Equal(a.Clone()) {
+		t.Error("clone not equal")
+	}
+	if a.Equal(b) {
+		t.Error("Equal ignores differences")
+	}
+	if !a.EqualSemantic(b) || !b.EqualSemantic(a) {
+		t.Error("EqualSemantic reports differences")
+	}
+	if a.Hash() != b.Hash() || len(a.Hash()) != 64 {
+		t.Errorf("hashes %s and %s differ", a.Hash(), b.Hash())
+	}
+	b.AddOption("server", "tls", "off")
+	if a.EqualSemantic(b) || a.Hash() == b.Hash() {
+		t.Error("EqualSemantic or Hash ignores a changed bool")
+	}
+	b.AddOption("server", "tls", "yes")
+	b.SetDefault("server", "workers", "4")
+	if a.EqualSemantic(b) {
+		t.Error("EqualSemantic ignores a default of one side")
+	}
+}
+
+func TestHash(t *testing.T) {
+	c := NewConfigFile()
+	c.AddOption("server", "port", "80")
+	c.AddOption("server", "host", "example.com")
+	c.AddOption("client", "retries", "3")
+	hash := c.Hash()
+	if c.Hash() != hash {
+		t.Error("hash changed between calls")
+	}
+
+	reordered := NewConfigFile()
+	reordered.AddOption("client", "retries", "3")
+	reordered.AddOption("SERVER", "Host", "example.com")
+	reordered.AddOption("Server", "PORT", "80")
+	if reordered.Hash() != hash {
+		t.Error("hash depends on the order or case of options")
+	}
+
+	for name, modify := range map[string]func(c *ConfigFile){
+		"value":   func(c *ConfigFile) { c.AddOption("server", "port", "81") },
+		"option":  func(c *ConfigFile) { c.RemoveOption("server", "port"); c.AddOption("server", "ports", "80") },
+		"section": func(c *ConfigFile) { c.RemoveOption("client", "retries"); c.AddOption("server", "retries", "3") },
+	} {
+		changed := c.Clone()
+		modify(changed)
+		if changed.Hash() == hash {
+			t.Errorf("hash ignores a changed %s", name)
+		}
+	}
+}
+
+func TestExpiry(t *testing.T) {
+	c, err := ReadConfigBytes([]byte(confFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.SetDefault("service-1", "port", "80")
+	expired := make(chan string, 1)
+	c.SetExpiryHandler(func(section, option string) { expired <- section + " " + option })
+
+	c.SetTTL("service-1", "port", 50*time.Millisecond)
+	if port, _ := c.GetInt("service-1", "port"); port != 443 {
+		t.Errorf("port = %d before expiry; want 443", port)
+	}
+	if _, ok := c.Metadata("service-1", "port")[ExpiresKey]; !ok {
+		t.Error("expiry not kept as metadata")
+	}
+	select {
+	case got := <-expired:
+		if got != "service-1 port" {
+			t.Errorf("expiry handler called for %s", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expiry handler not called")
+	}
+	if port, _ := c.GetInt("service-1", "port"); port != 80 {
+		t.Errorf("port = %d after expiry; want default 80", port)
+	}
+
+	c.SetTTL("default", "host", time.Hour)
+	c.SetExpiry("default", "host", time.Time{})
+	if host, _ := c.GetString("default", "host"); host != "example.com" {
+		t.Errorf("host = %q after removing its expiry", host)
+	}
+}
+
+func TestWithOverrides(t *testing.T) {
+	c, err := ReadConfigBytes([]byte(confFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	view := c.WithOverrides(map[string]string{"host": "tenant.example.com", "Service-1.Port": "8443"})
+
+	if url, _ := view.GetString("service-1", "url"); url != "http://tenant.example.com/something" {
+		t.Errorf("url = %q in view", url)
+	}
+	if port, _ := view.GetInt("service-1", "port"); port != 8443 {
+		t.Errorf("port = %d in view", port)
+	}
+	if url, _ := c.GetString("service-1", "url"); url != "http://example.com/something" {
+		t.Errorf("url = %q in configuration", url)
+	}
+
+	nested := view.WithOverrides(map[string]string{"service-1.port": "9443"})
+	if host, _ := nested.GetString("", "host"); host != "tenant.example.com" {
+		t.Errorf("host = %q in nested view", host)
+	}
+	if port, _ := nested.GetInt("service-1", "port"); port != 9443 {
+		t.Errorf("port = %d in nested view", port)
+	}
+	if port, _ := view.GetInt("service-1", "port"); port != 8443 {
+		t.Errorf("port = %d in view after nesting", port)
+	}
+
+	c.AddOption("remote.origin", "url", "git://example.com/")
+	if url, _ := c.WithOverrides(map[string]string{"remote.origin.url": "git://mirror/"}).GetString("remote.origin", "url"); url != "git://mirror/" {
+		t.Errorf("url = %q in view with a dotted section", url)
+	}
+
+	urls := make(chan string)
+	for _, host := range []string{"a.example.com", "b.example.com"} { // views do not modify c
+		go func(host string) {
+			url, _ := c.WithOverrides(map[string]string{"host": host}).GetString("service-1", "url")
+			urls <- strings.TrimPrefix(url, "http://"+host)
+		}(host)
+	}
+	for i := 0; i < 2; i++ {
+		if url := <-urls; url != "/something" {
+			t.Errorf("url = %q in concurrent view", url)
+		}
+	}
+
+	c.AddOption("service-1", "retries", "3")
+	if retries, err := view.GetInt("service-1", "retries"); retries != 3 || err != nil {
+		t.Errorf("GetInt = %d, %v in view after modifying the configuration", retries, err)
+	}
+}
+
+func TestConfigStream(t *testing.T) {
+	const stream = `[tenant]
+name = alpha
+---
+[tenant]
+name = beta
+	---
+`
+	configs, err := ReadConfigStream(strings.NewReader(stream))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(configs) != 3 {
+		t.Fatalf("read %d configurations; want 3", len(configs))
+	}
+	for i, want := range []string{"alpha", "beta"} {
+		if name, _ := configs[i].GetString("tenant", "name"); name != want {
+			t.Errorf("configuration %d: name = %q; want %q", i+1, name, want)
+		}
+	}
+	if sections := configs[2].GetSections(); len(sections) != 1 {
+		t.Errorf("last configuration has sections %v", sections)
+	}
+
+	var buf bytes.Buffer
+	if err = WriteConfigStream(&buf, configs[:2]); err != nil {
+		t.Fatal(err)
+	}
+	want := "[tenant]\nname=alpha\n\n---\n[tenant]\nname=beta\n\n"
+	if buf.String() != want {
+		t.Errorf("wrote %q; want %q", buf.String(), want)
+	}
+
+	_, err = ReadConfigStream(strings.NewReader("a = 1\n---\n[broken\n"), StrictDialect)
+	if err == nil || !strings.HasPrefix(err.Error(), "configuration 2: ") {
+		t.Errorf("error %v does not name configuration 2", err)
+	}
+}
+
+func TestBytes(t *testing.T) {
+	c, err := ReadConfigBytes([]byte(confFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := c.GetBytesRaw("service-1", "url")
+	if err != nil || string(raw) != "http://%(host)s/something" {
+		t.Errorf("GetBytesRaw = %q, %v", raw, err)
+	}
+	if _, err = c.GetBytesRaw("service-1", "missing"); err == nil {
+		t.Error("GetBytesRaw found a missing option")
+	}
+
+	r, err := c.GetReader("service-1", "url")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := io.ReadAll(r); string(b) != "http://example.com/something" {
+		t.Errorf("GetReader read %q", b)
+	}
+
+	buf := []byte("url: ")
+	if buf, err = c.AppendString(buf, "service-1", "url"); err != nil || string(buf) != "url: http://example.com/something" {
+		t.Errorf("AppendString = %q, %v", buf, err)
+	}
+	if testing.AllocsPerRun(100, func() { c.AppendString(buf[:0], "service-1", "url") }) != 0 {
+		t.Error("AppendString allocates")
+	}
+}
+
+func TestPEM(t *testing.T) {
+	payload, _ := base64.StdEncoding.DecodeString(strings.Repeat("remA", 50)) // lines starting like comments
+	none := map[string]string{}
+	indented := DefaultDialect
+	indented.Continuation = ContinueIndented
+	for _, test := range []struct {
+		name    string
+		dialect Dialect
+		block   *pem.Block
+	}{
+		{"default", DefaultDialect, &pem.Block{Type: "CERTIFICATE", Headers: none, Bytes: payload}},
+		{"padded", DefaultDialect, &pem.Block{Type: "CERTIFICATE", Headers: none, Bytes: payload[:149]}},
+		{"strict", StrictDialect, &pem.Block{Type: "CERTIFICATE", Headers: none, Bytes: payload}},
+		{"indented", indented, &pem.Block{Type: "CERTIFICATE", Headers: none, Bytes: payload}},
+		{"headers", indented, &pem.Block{Type: "RSA PRIVATE KEY", Headers: map[string]string{"Proc-Type": "4,ENCRYPTED"}, Bytes: []byte("0123456789")}},
+		{"git", GitDialect, &pem.Block{Type: "CERTIFICATE", Headers: none, Bytes: payload}},
+	} {
+		c := NewConfigFile()
+		c.SetDialect(test.dialect)
+		if err := c.SetPEM("tls", "cert", test.block); err != nil {
+			t.Errorf("%s: SetPEM: %v", test.name, err)
+			continue
+		}
+		c, err := ReadConfigBytes(c.WriteConfigBytes(""), test.dialect)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		block, err := c.GetPEM("tls", "cert")
+		if err != nil || !reflect.DeepEqual(block, test.block) {
+			t.Errorf("%s: GetPEM = %v, %v; want %v", test.name, block, err, test.block)
+		}
+	}
+
+	c := NewConfigFile()
+	if err := c.SetPEM("tls", "key", &pem.Block{Type: "KEY", Headers: map[string]string{"Proc-Type": "4,ENCRYPTED"}}); err == nil {
+		t.Error("SetPEM wrote headers as continued lines")
+	}
+	c.AddOption("tls", "cert", "not a certificate")
+	if _, err := c.GetPEM("tls", "cert"); err == nil {
+		t.Error("GetPEM decoded a value without PEM block")
+	}
+}
+
+func TestGetSectionsMatching(t *testing.T) {
+	c, err := ReadConfigBytes([]byte("[service-1]\n[Service-2]\n[worker-1]\n[service-10]\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if sections := c.GetSectionsMatching("SERVICE-*"); !reflect.DeepEqual(sections, []string{"service-1", "service-2", "service-10"}) {
+		t.Errorf("GetSectionsMatching = %v", sections)
+	}
+	if sections := c.GetSectionsMatching("[sw]*-1"); !reflect.DeepEqual(sections, []string{"service-1", "worker-1"}) {
+		t.Errorf("GetSectionsMatching = %v", sections)
+	}
+	if sections := c.GetSectionsMatching("[service"); sections != nil {
+		t.Errorf("malformed pattern matched %v", sections)
+	}
+	if sections := c.GetSectionsMatchingRegexp(regexp.MustCompile(`^service-\d$`)); !reflect.DeepEqual(sections, []string{"service-1", "service-2"}) {
+		t.Errorf("GetSectionsMatchingRegexp = %v", sections)
+	}
+}
+
+func TestSetOptionNormalizer(t *testing.T) {
+	c := NewConfigFile()
+	c.SetOptionNormalizer(FoldSeparators)
+	if err := c.Read(strings.NewReader("[service-1]\nMax_Clients = 200\n")); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"max-clients", "max_clients", "MAX-CLIENTS"} {
+		if n, err := c.GetInt("service-1", name); err != nil || n != 200 {
+			t.Errorf("c.GetInt(\"service-1\", %q) = %d, %v; want 200", name, n, err)
+		}
+	}
+	if options, _ := c.GetOptions("service-1"); !reflect.DeepEqual(options, []string{"max-clients"}) {
+		t.Errorf("options stored as %v", options)
+	}
+
+	c = NewConfigFile()
+	c.SetOptionNormalizer(KeepCase)
+	c.AddOption("service-1", "MaxClients", "200")
+	if c.HasOption("service-1", "maxclients") || !c.HasOption("service-1", "MaxClients") {
+		t.Error("KeepCase folded the case of option names")
+	}
+
+	c.SetOptionNormalizer(nil)
+	c.AddOption("service-1", "Workers", "4")
+	if !c.HasOption("service-1", "WORKERS") {
+		t.Error("default normalizer not restored")
+	}
+}
+
+func TestUnicodeCaseFolding(t *testing.T) {
+	c, err := ReadConfigBytes([]byte("[ΟΔΟΣ]\nıSIK = dotless\nİzmir = dotted\nIRMAK = ascii\nKELVIN = 1\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct{ section, option, want string }{
+		{"οδος", "ıSIK", "dotless"}, // final sigma folds like Σ and σ
+		{"ΟΔΟσ", "ısik", "dotless"},
+		{"οδοσ", "İZMIR", "dotted"},
+		{"οδος", "irmak", "ascii"},
+		{"οδος", "Kelvin", "1"}, // Kelvin sign
+	} {
+		if v, err := c.GetString(tc.section, tc.option); err != nil || v != tc.want {
+			t.Errorf("c.GetString(%q, %q) = %q, %v; want %q", tc.section, tc.option, v, err, tc.want)
+		}
+	}
+
+	// letters without case equivalents do not match other letters
+	for _, option := range []string{"isik", "izmir", "ırmak"} {
+		if c.HasOption("οδος", option) {
+			t.Errorf("c.HasOption(\"οδος\", %q) = true; want false", option)
+		}
+	}
+	if sections := c.GetSectionsMatching("ΟΔΟ*"); len(sections) != 1 {
+		t.Errorf("c.GetSectionsMatching(\"ΟΔΟ*\") = %v", sections)
+	}
+}
+
+func TestSetLocaleNumbers(t *testing.T) {
+	c, err := ReadConfigBytes([]byte("price = 1.234,5\nlimit = -1 000 000,25\nratio = 0,75\nplain = 1.234\nwrong = 12.34,5\nenglish = 1,234.5\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = c.GetFloat64("", "price"); err == nil {
+		t.Error("decimal comma accepted by default")
+	}
+
+	c.SetLocaleNumbers(true)
+	for option, want := range map[string]float64{"price": 1234.5, "limit": -1000000.25, "ratio": 0.75, "plain": 1.234} {
+		if f, err := c.GetFloat64("", option); err != nil || f != want {
+			t.Errorf("c.GetFloat64(\"\", %q) = %g, %v; want %g", option, f, err, want)
+		}
+	}
+	for _, option := range []string{"wrong", "english"} {
+		if f, err := c.GetFloat64("", option); err == nil {
+			t.Errorf("c.GetFloat64(\"\", %q) = %g; want error", option, f)
+		}
+	}
+}
+
+func TestDuplicatesAppend(t *testing.T) {
+	d := DefaultDialect
+	d.Duplicates = DuplicatesAppend
+	c, err := ReadConfigBytes([]byte("[Server]\nX = 1\nx = 2\n"), d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if x, _ := c.GetString("server", "x"); x != "1\n2" {
+		t.Errorf("x = %q; want both values", x)
+	}
+}
+
+func TestDuplicatesKeepFirst(t *testing.T) {
+	d := DefaultDialect
+	d.Duplicates = DuplicatesKeepFirst
+	const input = `[service-1]
+host = first
+  continued
+port = 80
+host = second
+  ignored too
+
+[service-1]
+port = 8080
+`
+	c, err := ReadConfigBytes([]byte(input), d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if host, _ := c.GetString("service-1", "host"); host != "first\ncontinued" {
+		t.Errorf("host = %q; want the first value", host)
+	}
+	if port, _ := c.GetInt("service-1", "port"); port != 80 {
+		t.Errorf("port = %d; want 80", port)
+	}
+
+	if err = c.Read(strings.NewReader("[service-1]\nport = 443\n")); err != nil {
+		t.Fatal(err)
+	}
+	if port, _ := c.GetInt("service-1", "port"); port != 443 {
+		t.Errorf("port = %d after reading another file; want 443", port)
+	}
+
+	c = NewConfigFile()
+	c.SetDialect(d)
+	c.SetDocumentMode(true)
+	if err = c.Read(strings.NewReader(input)); err != nil {
+		t.Fatal(err)
+	}
+	if out := string(c.WriteConfigBytes("")); out != input {
+		t.Errorf("document mode wrote\n%s\nwant\n%s", out, input)
+	}
+}
+
+func TestEncryptedConfigFile(t *testing.T) {
+	c, err := ReadConfigBytes([]byte(confFile))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	key := AESKey(bytes.Repeat([]byte{7}, 32))
+
+	for _, tc := range []struct {
+		key, wrong FileKey
+	}{
+		{key, AESKey(bytes.Repeat([]byte{8}, 32))},
+		{Passphrase("correct horse"), Passphrase("battery staple")},
+	} {
+		fname := filepath.Join(t.TempDir(), "encrypted.conf")
+		if err := c.WriteConfigFileEncrypted(fname, 0600, "encrypted", tc.key); err != nil {
+			t.Fatal(err.Error())
+		}
+		data, _ := os.ReadFile(fname)
+		if bytes.Contains(data, []byte("example.com")) {
+			t.Error("encrypted file reveals its contents")
+		}
+
+		d, err := ReadConfigFileEncrypted(fname, tc.key)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if url, _ := d.GetString("service-1", "url"); url != "http://example.com/something" {
+			t.Errorf("url = %q after decryption", url)
+		}
+		if _, err = ReadConfigFileEncrypted(fname, tc.wrong); !errors.Is(err, ErrDecryption) {
+			t.Errorf("reading with the wrong key returned %v; want ErrDecryption", err)
+		}
+	}
+
+	fname := filepath.Join(t.TempDir(), "plain.conf")
+	if err = c.WriteConfigFile(fname, 0600, ""); err != nil {
+		t.Fatal(err.Error())
+	}
+	if _, err = ReadConfigFileEncrypted(fname, key); !errors.Is(err, ErrDecryption) {
+		t.Errorf("reading a plain file returned %v; want ErrDecryption", err)
+	}
+}
+
+func TestGitIncludeGlob(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"config":          "[include]\n\tpath = conf.d/*.conf\n[core]\n\teditor = vi\n",
+		"conf.d/20.conf":  "[core]\n\teditor = emacs\n",
+		"conf.d/10.conf":  "[core]\n\teditor = nano\n\tpager = less\n",
+		"conf.d/skip.txt": "[core]\n\tpager = more\n",
+		"loop":            "[include]\n\tpath = loop.d/*\n",
+		"loop.d/back":     "[include]\n\tpath = ../loop\n",
+	} {
+		os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0o700)
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c, err := ReadConfigFile(filepath.Join(dir, "config"), GitDialect)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if editor, _ := c.GetString("core", "editor"); editor != "vi" {
+		t.Errorf("editor = %q; want vi, set after the include", editor)
+	}
+	if pager, _ := c.GetString("core", "pager"); pager != "less" {
+		t.Errorf("pager = %q; want less", pager)
+	}
+	if loc, _ := c.Source("core", "pager"); loc != (Location{filepath.Join(dir, "conf.d/10.conf"), 3}) {
+		t.Errorf("pager read from %v", loc)
+	}
+	want := []string{filepath.Join(dir, "conf.d/10.conf"), filepath.Join(dir, "conf.d/20.conf")}
+	if included := c.Included(); !reflect.DeepEqual(included, want) {
+		t.Errorf("c.Included() = %v; want %v", included, want)
+	}
+
+	if _, err = ReadConfigFile(filepath.Join(dir, "loop"), GitDialect); !errors.Is(err, ErrIncludeCycle) {
+		t.Errorf("reading a file including itself returned %v; want ErrIncludeCycle", err)
+	}
+}
+
+func TestIncludeDirectives(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"main.conf":     "host = example.com\n[service-1]\ninclude conf.d/*.conf # drop-ins\ninclude-if-exists missing.conf\ninclude-env TEST_EXTRA_CONF\nport = 80\n",
+		"conf.d/a.conf": "[service-1]\nport = 8080\nurl = http://%(host)s/\n",
+		"extra.conf":    "[service-2]\nport = 443\n",
+		"broken.conf":   "include missing.conf\n",
+		"loop.conf":     "include loop.conf\n",
+	} {
+		os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0o700)
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("TEST_EXTRA_CONF", filepath.Join(dir, "extra.conf"))
+	d := DefaultDialect
+	d.Includes = true
+
+	c, err := ReadConfigFile(filepath.Join(dir, "main.conf"), d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		section, option, want string
+	}{
+		{"service-1", "port", "80"},
+		{"service-1", "url", "http://example.com/"},
+		{"service-2", "port", "443"},
+	} {
+		if v, err := c.GetString(tc.section, tc.option); err != nil || v != tc.want {
+			t.Errorf("c.GetString(%q, %q) = %q, %v; want %q", tc.section, tc.option, v, err, tc.want)
+		}
+	}
+	if included := c.Included(); len(included) != 2 {
+		t.Errorf("c.Included() = %v; want a.conf and extra.conf", included)
+	}
+
+	if _, err = ReadConfigFile(filepath.Join(dir, "broken.conf"), d); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("including a missing file returned %v; want fs.ErrNotExist", err)
+	}
+	if _, err = ReadConfigFile(filepath.Join(dir, "loop.conf"), d); !errors.Is(err, ErrIncludeCycle) {
+		t.Errorf("including a file in itself returned %v; want ErrIncludeCycle", err)
+	}
+	if _, err = ReadConfigFile(filepath.Join(dir, "main.conf")); err == nil {
+		t.Error("include directives read without Includes")
+	}
+}
+
+func TestUpdateFileSection(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "shared.conf")
+	const shared = "# shared by several tools\r\n[first]\r\nkeep = me  ; as is\r\n\r\n[agent]\r\nold = 1\r\n# gone\r\nlevel = 2\r\n\r\n# introduces last\r\n[last]\r\nx = y\r\n[AGENT]\r\nrepeated = 3\r\n"
+	if err := os.WriteFile(fname, []byte(shared), 0o640); err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewConfigFile()
+	c.AddOption("agent", "level", "5")
+	c.AddOption("agent", "mode", "fast")
+	var buf bytes.Buffer
+	if err := c.WriteSection(&buf, "Agent"); err != nil || buf.String() != "[agent]\nlevel=5\nmode=fast\n\n" {
+		t.Errorf("c.WriteSection() wrote %q, %v", buf.String(), err)
+	}
+	if err := c.WriteSection(&buf, "missing"); !errors.Is(err, ErrSectionNotFound) {
+		t.Errorf("c.WriteSection(\"missing\") = %v; want ErrSectionNotFound", err)
+	}
+
+	if err := c.UpdateFileSection(fname, "agent"); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(fname)
+	want := "# shared by several tools\r\n[first]\r\nkeep = me  ; as is\r\n\r\n[agent]\r\nlevel=5\r\nmode=fast\r\n\r\n# introduces last\r\n[last]\r\nx = y\r\n"
+	if string(data) != want {
+		t.Errorf("updated file is %q; want %q", data, want)
+	}
+	if info, err := os.Stat(fname); err != nil || info.Mode().Perm() != 0o640 {
+		t.Errorf("updated file has mode %v, %v; want 0640", info.Mode(), err)
+	}
+
+	c.AddOption("new", "a", "b")
+	c.RemoveSection("agent")
+	for _, section := range []string{"agent", "new"} {
+		if err := c.UpdateFileSection(fname, section); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, _ = os.ReadFile(fname)
+	want = "# shared by several tools\r\n[first]\r\nkeep = me  ; as is\r\n\r\n\r\n# introduces last\r\n[last]\r\nx = y\r\n\r\n[new]\r\na=b\r\n"
+	if string(data) != want {
+		t.Errorf("updated file is %q; want %q", data, want)
+	}
+}
+
+func TestCommentOut(t *testing.T) {
+	const file = "[service]\n" +
+		"host = example.com\n" +
+		"motd = Hello\n" +
+		"  World\n" +
+		"# level = 2\n" +
+		"# More about levels\n" +
+		"port = 80\n"
+	c := NewConfigFile()
+	c.SetDocumentMode(true)
+	if err := c.Read(strings.NewReader(file)); err != nil {
+		t.Fatal(err)
+	}
+
+	var err error
+	for _, option := range []string{"motd", "port"} {
+		if err = c.CommentOut("service", option); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c.SetOption("service", "host", "example.org")
+	if err = c.CommentOut("service", "host"); err != nil {
+		t.Fatal(err)
+	}
+	want := "[service]\n" +
+		"# host = example.org\n" +
+		"# motd = Hello\n" +
+		"#   World\n" +
+		"# level = 2\n" +
+		"# More about levels\n" +
+		"# port = 80\n"
+	if ans := string(c.WriteConfigBytes("")); ans != want {
+		t.Errorf("commented out: got %q, want %q", ans, want)
+	}
+	if c.HasOption("service", "motd") {
+		t.Error("option motd still set after CommentOut")
+	}
+
+	for _, option := range []string{"motd", "level", "host"} {
+		if err = c.Uncomment("service", option); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want = "[service]\n" +
+		"host = example.org\n" +
+		"motd = Hello\n" +
+		"  World\n" +
+		"level = 2\n" +
+		"# More about levels\n" +
+		"# port = 80\n"
+	if ans := string(c.WriteConfigBytes("")); ans != want {
+		t.Errorf("uncommented: got %q, want %q", ans, want)
+	}
+	if v, err := c.GetString("service", "motd"); err != nil || v != "Hello\nWorld" {
+		t.Errorf("c.GetString(\"service\", \"motd\") = %q, %v; want \"Hello\\nWorld\"", v, err)
+	}
+	if err = c.Uncomment("service", "missing"); !errors.Is(err, ErrOptionNotFound) {
+		t.Errorf("c.Uncomment(\"service\", \"missing\") = %v; want ErrOptionNotFound", err)
+	}
+	if err = c.CommentOut("service", "missing"); !errors.Is(err, ErrOptionNotFound) {
+		t.Errorf("c.CommentOut(\"service\", \"missing\") = %v; want ErrOptionNotFound", err)
+	}
+}
+
+func TestHeaderOptions(t *testing.T) {
+	header := HeaderOptions{
+		Generator: "app-setup",
+		Template:  "templates/app.conf.tmpl",
+		Time:      time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+		DoNotEdit: true,
+		Text:      "Site: example\n\nContact: ops",
+	}.String()
+
+	c := NewConfigFile()
+	c.AddOption("service-1", "port", "80")
+	want := "# DO NOT EDIT: this file is generated, changes will be overwritten.\n" +
+		"# Generated by app-setup from templates/app.conf.tmpl at 2024-05-01T12:00:00Z.\n" +
+		"# Site: example\n" +
+		"#\n" +
+		"# Contact: ops\n" +
+		"[service-1]\n" +
+		"port=80\n\n"
+	if ans := string(c.WriteConfigBytes(header)); ans != want {
+		t.Errorf("c.WriteConfigBytes() = %q; want %q", ans, want)
+	}
+	if ans := string(c.WriteConfigBytes("one\ntwo", PHPDialect)); !strings.HasPrefix(ans, "; one\n; two\n[service-1]\n") {
+		t.Errorf("c.WriteConfigBytes() in PHP mode = %q", ans)
+	}
+	if _, err := ReadConfigBytes([]byte(want)); err != nil {
+		t.Errorf("reading the file written: %v", err)
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	c := NewConfigFile()
+	c.AddOption("service-1", "host", "example.com  ")
+	c.AddOption("service-1", "motd", "Hello # world")
+	c.AddOption("service-1", "port", "80")
+	written := c.WriteConfigBytes("")
+
+	if err := c.Normalize(); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range [][3]string{
+		{"service-1", "host", "example.com"},
+		{"service-1", "motd", "Hello"},
+		{"service-1", "port", "80"},
+	} {
+		if v, _ := c.GetRawString(tc[0], tc[1]); v != tc[2] {
+			t.Errorf("normalized %s.%s is %q; want %q", tc[0], tc[1], v, tc[2])
+		}
+	}
+	if options, _ := c.GetOptions("service-1"); strings.Join(options, " ") != "host motd port" {
+		t.Errorf("normalized options are %v", options)
+	}
+	if err := CheckRoundTrip(written); err != nil {
+		t.Errorf("CheckRoundTrip() = %v", err)
+	}
+
+	strict := NewConfigFile()
+	strict.SetDialect(StrictDialect)
+	strict.AddOption("service-1", "motd", "Hello\nWorld")
+	if err := strict.Normalize(); err == nil {
+		t.Error("Normalize() of a multi-line value in StrictDialect succeeded")
+	}
+	if v, _ := strict.GetRawString("service-1", "motd"); v != "Hello\nWorld" {
+		t.Errorf("failed Normalize() changed the value to %q", v)
+	}
+}
+
+func TestGetChoice(t *testing.T) {
+	type level int
+	const (
+		debug level = iota
+		info
+	)
+	choices := map[string]any{"debug": debug, "info": info, "Quiet": -1}
+
+	c := NewConfigFile()
+	c.AddOption("log", "level", "info")
+	c.AddOption("log", "shouted", "DEBUG")
+	c.AddOption("log", "quiet", "quiet")
+	c.AddOption("log", "verbose", "trace")
+
+	for option, want := range map[string]any{"level": info, "shouted": debug, "quiet": -1} {
+		if v, err := c.GetChoice("log", option, choices); err != nil || v != want {
+			t.Errorf("c.GetChoice(\"log\", %q) = %v, %v; want %v", option, v, err, want)
+		}
+	}
+
+	_, err := c.GetChoice("log", "verbose", choices)
+	if !errors.Is(err, ErrParse) || !strings.Contains(err.Error(), "valid choices are Quiet, debug, info") {
+		t.Errorf("c.GetChoice(\"log\", \"verbose\") returned error %v", err)
+	}
+	if _, err = c.GetChoice("log", "missing", choices); !errors.Is(err, ErrOptionNotFound) {
+		t.Errorf("c.GetChoice(\"log\", \"missing\") returned error %v; want ErrOptionNotFound", err)
+	}
+}
+
+func TestOptionNames(t *testing.T) {
+	c, err := ReadConfigBytes([]byte("[ui]\ndisplay name = Foo\nGröße: 42\nurl\\: http\\://x = y\n\\remote host = r\n\\\\share = s\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for option, want := range map[string]string{
+		"display name":  "Foo",
+		"größe":         "42",
+		"url: http://x": "y",
+		"remote host":   "r",
+		`\share`:        "s",
+	} {
+		if v, err := c.GetString("ui", option); err != nil || v != want {
+			t.Errorf("c.GetString(\"ui\", %q) = %q, %v; want %q", option, v, err, want)
+		}
+	}
+
+	for _, d := range []Dialect{DefaultDialect, PythonDialect, PHPDialect, StrictDialect} {
+		c := NewConfigFile()
+		c.SetDialect(d)
+		names := []string{"a=b", "c:d", "#hash", ";semi", "[bracket]", "rem ark", `back\`, `\lead`, "x \\= y", `"quoted"`, "ünï cödé"}
+		for _, name := range names {
+			c.AddOption("s", name, "v")
+		}
+		read, err := ReadConfigBytes(c.WriteConfigBytes(""), d)
+		if err != nil {
+			t.Fatalf("reading %q: %v", c.WriteConfigBytes(""), err)
+		}
+		options, _ := read.GetOptions("s")
+		if want, _ := c.GetOptions("s"); !reflect.DeepEqual(options, want) {
+			t.Errorf("options written as %q read back as %q; want %q", c.WriteConfigBytes(""), options, want)
+		}
+	}
+}
+
+func TestEscapes(t *testing.T) {
+	d := DefaultDialect
+	d.Escapes = ASCIIEscapes
+	c, err := ReadConfigBytes([]byte("[s]\nname = \"Jos\\u00e9 \\\"\\uD83D\\uDE00\\\" \\xff\\d\"\nlone = \"\\uD800x\"\nplain = \\u00e9\nref = \"%(name)s!\"\n"), d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for option, want := range map[string]string{
+		"name":  "José \"\U0001F600\" \xff\\d",
+		"lone":  "\uFFFDx",
+		"plain": `\u00e9`,
+		"ref":   "José \"\U0001F600\" \xff\\d!",
+	} {
+		if v, err := c.GetString("s", option); err != nil || v != want {
+			t.Errorf("c.GetString(\"s\", %q) = %q, %v; want %q", option, v, err, want)
+		}
+	}
+
+	for _, d := range []Dialect{DefaultDialect, PythonDialect, GitDialect, PHPDialect} {
+		for _, escapes := range []Escapes{UnicodeEscapes, ASCIIEscapes} {
+			d.Escapes = escapes
+			c := NewConfigFile()
+			c.SetDialect(d)
+			values := []string{"Grüße, 世界 \U0001F600", "\xff\xfe raw", `"quoted" \u00e9`, "plain"}
+			for i, value := range values {
+				c.AddOption("s", "o"+strconv.Itoa(i), value)
+			}
+			written := c.WriteConfigBytes("")
+			if escapes == ASCIIEscapes && bytes.ContainsFunc(written, func(r rune) bool { return r >= utf8.RuneSelf }) {
+				t.Errorf("output not ASCII in dialect %v: %q", d, written)
+			}
+			if !utf8.Valid(written) {
+				t.Errorf("output not UTF-8 in dialect %v: %q", d, written)
+			}
+			read, err := ReadConfigBytes(written, d)
+			if err != nil {
+				t.Fatalf("reading %q: %v", written, err)
+			}
+			for i, want := range values {
+				if v, err := read.GetString("s", "o"+strconv.Itoa(i)); err != nil || v != want {
+					t.Errorf("%q written as %q read back as %q, %v", want, written, v, err)
+				}
+			}
+		}
+	}
+}
+
+func TestReasonValues(t *testing.T) {
+	// the values of the original reasons, which callers may have stored
+	for want, reason := range []int{SectionNotFound, OptionNotFound, MaxDepthReached, BlankSection, CouldNotParse} {
+		if reason != want {
+			t.Errorf("reason %d; want %d", reason, want)
+		}
+	}
+}
+
+// mapBackend is a Backend holding keys in a map.
+type mapBackend map[string]string
+
+func (b mapBackend) List(prefix string) (map[string]string, error) {
+	kvs := make(map[string]string)
+	for key, value := range b {
+		if strings.HasPrefix(key, prefix) {
+			kvs[key] = value
+		}
+	}
+	return kvs, nil
+}
+
+func (b mapBackend) Get(key string) (string, bool, error) {
+	value, ok := b[key]
+	return value, ok, nil
+}
+
+func (b mapBackend) Watch(prefix string, stop <-chan bool) error {
+	<-stop
+	return nil
+}
+
+func TestReadBackendOrder(t *testing.T) {
+	b := mapBackend{"app/zone": "z", "app/host": "h", "app/web/port": "80", "app/db/user": "u", "app/db/name": "n", "app/api/url": "x"}
+	for i := 0; i < 20; i++ {
+		c, err := ReadBackend(b, "app")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sections := c.GetSections(); !reflect.DeepEqual(sections, []string{"default", "api", "db", "web"}) {
+			t.Fatalf("sections = %q", sections)
+		}
+		if options, _ := c.GetOptions("db"); !reflect.DeepEqual(options, []string{"host", "zone", "name", "user"}) {
+			t.Fatalf("options of db = %q", options)
+		}
+		if options, _ := c.GetOptions("web"); !reflect.DeepEqual(options, []string{"host", "zone", "port"}) {
+			t.Fatalf("options of web = %q", options)
+		}
+	}
+}
+
+func TestUntrustedIncludes(t *testing.T) {
+	dir := t.TempDir()
+	secret := filepath.Join(dir, "secret.conf")
+	if err := os.WriteFile(secret, []byte("[core]\n\tpassword = hunter2\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	includes := DefaultDialect
+	includes.Includes = true
+
+	for _, test := range []struct {
+		dialect Dialect
+		input   string
+	}{
+		{GitDialect, "[include]\n\tpath = " + secret + "\n"},
+		{includes, "include " + secret + "\n"},
+	} {
+		// without includes, directives are not recognized
+		if c, err := HardenedRead(strings.NewReader(test.input), test.dialect); err == nil && (c.HasOption("core", "password") || len(c.Included()) > 0) {
+			t.Errorf("HardenedRead(%q) included %v", test.input, c.Included())
+		}
+
+		fname := filepath.Join(dir, "signed.conf")
+		if err := os.WriteFile(fname, []byte(test.input), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if c, err := ReadConfigFile(fname, test.dialect); err != nil || !c.HasOption("core", "password") {
+			t.Fatalf("ReadConfigFile(%q) did not include the file: %v", test.input, err)
+		}
+		c, err := ReadConfigDocument(fname, test.dialect) // keeping the include
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = c.WriteConfigFileSigned(fname, 0o600, "", HMACKey("secret")); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = ReadConfigFileVerified(fname, HMACKey("secret"), test.dialect); !errors.Is(err, ErrIncludeRefused) {
+			t.Errorf("ReadConfigFileVerified of %q returned %v; want ErrIncludeRefused", test.input, err)
+		}
+	}
+}
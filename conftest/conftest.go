@@ -0,0 +1,155 @@
+// Package conftest provides helpers for testing code which uses configurations:
+//
+//	c := conftest.MustParse(t, `
+//		[service-1]
+//		port = 443
+//	`)
+//	updatePort(c)
+//	conftest.AssertEqual(t, conftest.MustParse(t, "[service-1]\nport = 8443"), c)
+//	conftest.WriteAndCompare(t, c, "testdata/service.conf")
+package conftest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/akrennmair/goconf"
+)
+
+// UpdateEnv names the environment variable which makes WriteAndCompare write
+// golden files instead of comparing with them, e.g.
+//
+//	UPDATE_GOLDEN=1 go test ./...
+const UpdateEnv = "UPDATE_GOLDEN"
+
+// MustParse parses the configuration in literal, failing the test if it cannot
+// be parsed. As leading space is ignored, literal can be indented along with
+// the test.
+func MustParse(t testing.TB, literal string) *conf.ConfigFile {
+	t.Helper()
+
+	c, err := conf.ReadConfigBytes([]byte(literal))
+	if err != nil {
+		t.Fatalf("parsing configuration: %v", err)
+	}
+
+	return c
+}
+
+// AssertEqual fails the test if the configurations do not have the same
+// sections and options with the same raw values, listing every difference.
+// The order of sections and options is not compared.
+func AssertEqual(t testing.TB, want *conf.ConfigFile, got *conf.ConfigFile) {
+	t.Helper()
+
+	if diff := Diff(want, got); diff != "" {
+		t.Errorf("configurations differ:\n%s", diff)
+	}
+}
+
+// Diff returns the differences between the sections and options of the
+// configurations, one per line, or "" if there are none.
+func Diff(want *conf.ConfigFile, got *conf.ConfigFile) string {
+	w, g := options(want), options(got)
+	var lines []string
+
+	for _, section := range union(w, g) {
+		ws, wok := w[section]
+		gs, gok := g[section]
+		switch {
+		case !gok:
+			lines = append(lines, fmt.Sprintf("[%s] missing", section))
+			continue
+		case !wok:
+			lines = append(lines, fmt.Sprintf("[%s] unexpected", section))
+			continue
+		}
+
+		for _, option := range union(ws, gs) {
+			wv, wok := ws[option]
+			gv, gok := gs[option]
+			switch {
+			case !gok:
+				lines = append(lines, fmt.Sprintf("[%s] %s missing, want %q", section, option, wv))
+			case !wok:
+				lines = append(lines, fmt.Sprintf("[%s] %s = %q unexpected", section, option, gv))
+			case wv != gv:
+				lines = append(lines, fmt.Sprintf("[%s] %s = %q, want %q", section, option, gv, wv))
+			}
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// WriteAndCompare writes the configuration as Write does and compares the
+// result with the golden file, failing the test if they differ. If the
+// environment variable named by UpdateEnv is set, the golden file is written
+// instead.
+func WriteAndCompare(t testing.TB, c *conf.ConfigFile, golden string) {
+	t.Helper()
+
+	got := c.WriteConfigBytes("")
+	if os.Getenv(UpdateEnv) != "" {
+		if err := os.WriteFile(golden, got, 0644); err != nil {
+			t.Fatalf("updating golden file: %v", err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("reading golden file: %v (set %s=1 to create it)", err, UpdateEnv)
+	}
+	if bytes.Equal(got, want) {
+		return
+	}
+
+	gl, wl := strings.Split(string(got), "\n"), strings.Split(string(want), "\n")
+	for i := 0; ; i++ {
+		if i >= len(gl) || i >= len(wl) || gl[i] != wl[i] {
+			t.Errorf("written configuration differs from %s at line %d:\n got: %s\nwant: %s", golden, i+1, line(gl, i), line(wl, i))
+			return
+		}
+	}
+}
+
+// line returns the i-th line, or a marker if there are fewer lines.
+func line(lines []string, i int) string {
+	if i >= len(lines) {
+		return "(end of file)"
+	}
+	return fmt.Sprintf("%q", lines[i])
+}
+
+// options returns the raw values of the configuration by section and option.
+func options(c *conf.ConfigFile) (sections map[string]map[string]string) {
+	data, err := json.Marshal(c)
+	if err != nil {
+		panic(err) // maps of strings always marshal
+	}
+	json.Unmarshal(data, &sections)
+
+	return sections
+}
+
+// union returns the keys of a and b in sorted order.
+func union[V any](a map[string]V, b map[string]V) []string {
+	keys := make([]string, 0, len(a)+len(b))
+	for k := range a {
+		keys = append(keys, k)
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	return keys
+}
@@ -0,0 +1,77 @@
+package conftest_test
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/akrennmair/goconf/conftest"
+)
+
+// recorder records the failures of a test instead of failing it.
+type recorder struct {
+	testing.TB
+	failures []string
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...any) {
+	r.failures = append(r.failures, fmt.Sprintf(format, args...))
+}
+
+func (r *recorder) Fatalf(format string, args ...any) {
+	r.Errorf(format, args...)
+}
+
+func TestAssertEqual(t *testing.T) {
+	want := conftest.MustParse(t, `
+		host = example.com
+		[service-1]
+		port = 443
+		[service-2]
+	`)
+	got := conftest.MustParse(t, `
+		host = example.com
+		[service-1]
+		port = 8443
+		debug = on
+		[service-3]
+	`)
+
+	r := &recorder{TB: t}
+	conftest.AssertEqual(r, want, want)
+	if len(r.failures) != 0 {
+		t.Errorf("equal configurations reported as different: %v", r.failures)
+	}
+
+	diff := conftest.Diff(want, got)
+	for _, line := range []string{
+		`[service-1] debug = "on" unexpected`,
+		`[service-1] port = "8443", want "443"`,
+		`[service-2] missing`,
+		`[service-3] unexpected`,
+	} {
+		if !strings.Contains(diff, line) {
+			t.Errorf("diff lacks %q:\n%s", line, diff)
+		}
+	}
+}
+
+func TestWriteAndCompare(t *testing.T) {
+	golden := filepath.Join(t.TempDir(), "golden.conf")
+	c := conftest.MustParse(t, "[service-1]\nport = 443\n")
+
+	t.Setenv(conftest.UpdateEnv, "1")
+	conftest.WriteAndCompare(t, c, golden)
+	t.Setenv(conftest.UpdateEnv, "")
+	conftest.WriteAndCompare(t, c, golden)
+
+	c.AddOption("service-1", "port", "8443")
+	r := &recorder{TB: t}
+	conftest.WriteAndCompare(r, c, golden)
+	if len(r.failures) != 1 || !strings.Contains(r.failures[0], `"port=8443"`) {
+		t.Errorf("WriteAndCompare reported %v", r.failures)
+	}
+}
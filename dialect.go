@@ -0,0 +1,386 @@
+package conf
+
+import (
+	"bufio"
+	"bytes"
+	"slices"
+	"strings"
+)
+
+// Dialect describes the syntax of the files a configuration reads and writes:
+// how comments, options and continued values are recognized, which names are
+// case sensitive, what becomes of repeated options and which placeholders
+// GetString unfolds. Dialects are selected by SetDialect or passed to the
+// functions reading and writing files.
+//
+// With Includes, lines outside of values starting with one of the following
+// directives read other files where they are found, each starting in the
+// default section and leaving the including file in the section it was in:
+//
+//	include conf.d/*.conf           # files matching the pattern, in lexical order
+//	include site.conf               # the file, which must exist
+//	include-if-exists local.conf    # the file, if it exists
+//	include-env APP_EXTRA_CONF      # the file named by the variable, if set and existing
+//
+// Relative paths are relative to the directory of the including file. Files
+// including themselves, directly or not, are reported as a ReadError with the
+// reason IncludeCycle, and files nested more than 10 levels deep as one with
+// the reason LimitExceeded. Options read from included files are located in
+// them, see Source, and ConfigFile.Included lists the files. In document mode,
+// directives are kept as lines and no files are included. In git mode,
+// Includes follows include.path options instead of directives, see
+// GitDialect.
+//
+// Option names are everything preceding the first delimiter on their line,
+// with white space around them trimmed, so that they may contain spaces and
+// any Unicode characters, such as "display name" or "größe". Within names, a
+// backslash followed by a backslash, a delimiter or, with
+// QuotedInlineComments, a comment character stands for that character, and a
+// backslash starting the line before another character than white space is
+// dropped: it keeps names starting like comments, section headers or include
+// directives from being read as those. Other backslashes are taken literally.
+// Write escapes names accordingly, so that names read back as they were set,
+// except for white space around them. Names are compared ignoring case as
+// described for SetOptionNormalizer, unless CaseSensitiveOptions is set. The
+// rules of git, which restrict names to letters, digits and "-", take
+// precedence.
+//
+// The presets, such as DefaultDialect and PythonDialect, also carry rules
+// particular to their formats which the fields cannot express, such as the
+// subsections of git. A preset with some fields changed keeps those rules:
+//
+//	d := conf.DefaultDialect
+//	d.Delimiters = "="
+//	d.Duplicates = conf.DuplicatesError
+type Dialect struct {
+	CommentPrefixes       []string       // Prefixes of comment lines, matched ignoring case.
+	InlineComments        InlineComments // Where comments following values start.
+	Delimiters            string         // Characters separating options from values; Write uses the first.
+	SpacedDelimiter       bool           // Whether Write surrounds the delimiter with spaces.
+	CaseSensitiveSections bool           // Whether section names are kept as they are instead of lowercased.
+	CaseSensitiveOptions  bool           // Whether option names are kept as they are instead of lowercased.
+	Continuation          Continuation   // Which lines continue the value of the option before.
+	Duplicates            Duplicates     // What repeated options do.
+	Interpolation         Interpolation  // Placeholder syntax unfolded by GetString.
+	Includes              bool           // Whether include directives read other files, see below.
+	Escapes               Escapes        // Which escape sequences quoted values may contain.
+
+	syntax syntax // Rules of the preset this dialect derives from.
+}
+
+// InlineComments selects where comments following values start. Comments
+// start with those of the CommentPrefixes which are single characters.
+type InlineComments int
+
+const (
+	// NoInlineComments keeps comment characters within values.
+	NoInlineComments InlineComments = iota
+
+	// SpacedInlineComments starts comments at comment characters following
+	// a space or TAB.
+	SpacedInlineComments
+
+	// QuotedInlineComments starts comments at comment characters outside of
+	// double quotes, in which a backslash escapes the next character.
+	QuotedInlineComments
+)
+
+// Continuation selects the lines that continue the value of the option before.
+type Continuation int
+
+const (
+	// ContinueBareLines continues values on lines without a delimiter.
+	ContinueBareLines Continuation = iota
+
+	// ContinueIndented continues values on lines indented deeper than the
+	// line of their option, even if they contain a delimiter. Empty lines
+	// between them are part of the value. Write indents continued lines by
+	// a tab.
+	ContinueIndented
+
+	// ContinueBackslash continues lines ending in a backslash on the next
+	// line, the backslash being replaced by a space. Comment lines in
+	// between are left out.
+	ContinueBackslash
+
+	// NoContinuation reports lines without a delimiter as a ReadError with
+	// the reason CouldNotParse.
+	NoContinuation
+)
+
+// Duplicates selects what options repeated within a section do.
+type Duplicates int
+
+const (
+	// DuplicatesOverride takes the last value of a repeated option.
+	DuplicatesOverride Duplicates = iota
+
+	// DuplicatesAppend adds the value of each repetition as a line to the
+	// value of the option, and assigning the empty value resets it. A reset
+	// followed by assignments is kept as a leading empty line, so that
+	// configurations are written as they were read. Write writes every line
+	// of a value as an assignment of its own.
+	DuplicatesAppend
+
+	// DuplicatesError reports sections and options repeated within a file
+	// as a ReadError with the reason Duplicate, while reading several files
+	// adds to the options read before. The default section may be repeated.
+	DuplicatesError
+
+	// DuplicatesKeepFirst takes the first value of an option repeated within
+	// a file, ignoring the repetitions along with their continued lines,
+	// while reading several files overrides the options read before.
+	// Document mode keeps the lines ignored as they are.
+	DuplicatesKeepFirst
+)
+
+// syntax identifies the rules of a preset which the fields of Dialect do not
+// cover.
+type syntax int
+
+const (
+	iniSyntax syntax = iota
+	pythonSyntax
+	gitSyntax
+	phpSyntax
+)
+
+var (
+	// DefaultDialect is the dialect of new configurations: "#", ";" and
+	// "rem" start comment lines, "#" and ";" following white space also
+	// comments after values, "=" or ":" separates options from values,
+	// names are case insensitive, lines without a delimiter continue the
+	// value before, and the last value of a repeated option counts.
+	DefaultDialect = Dialect{
+		CommentPrefixes: []string{"#", ";", "rem"},
+		InlineComments:  SpacedInlineComments,
+		Delimiters:      "=:",
+		Continuation:    ContinueBareLines,
+		Duplicates:      DuplicatesOverride,
+		Interpolation:   BasicInterpolation,
+	}
+
+	// StrictDialect accepts only unambiguous files: "#" and ";" start
+	// comment lines only, "=" separates options from values, values do not
+	// continue on other lines, sections and options must not repeat, and
+	// values are taken literally, without placeholders.
+	StrictDialect = Dialect{
+		CommentPrefixes: []string{"#", ";"},
+		InlineComments:  NoInlineComments,
+		Delimiters:      "=",
+		Continuation:    NoContinuation,
+		Duplicates:      DuplicatesError,
+		Interpolation:   NoInterpolation,
+	}
+)
+
+// SetDialect selects the dialect of files read and written. It should be
+// selected before options are read or added, as names added before may be
+// folded differently. The default is DefaultDialect.
+func (c *ConfigFile) SetDialect(d Dialect) {
+	c.dialect = d
+	c.changed()
+}
+
+// Dialect returns the dialect selected by SetDialect.
+func (c *ConfigFile) Dialect() Dialect {
+	return c.dialect
+}
+
+// lazyParsing reports whether the dialect is parsed as readLazy does.
+func (d Dialect) lazyParsing() bool {
+	def := DefaultDialect
+	return slices.Equal(d.CommentPrefixes, def.CommentPrefixes) && d.InlineComments == def.InlineComments &&
+		d.Delimiters == def.Delimiters && !d.CaseSensitiveSections && !d.CaseSensitiveOptions &&
+		d.Continuation == def.Continuation && d.Duplicates == def.Duplicates && !d.Includes && d.syntax == iniSyntax
+}
+
+// isComment reports whether the trimmed line is a comment line.
+func (d Dialect) isComment(l []byte) bool {
+	for _, prefix := range d.CommentPrefixes {
+		if len(l) >= len(prefix) && bytes.EqualFold(l[:len(prefix)], []byte(prefix)) {
+			return true
+		}
+	}
+	return false
+}
+
+// escapedChars returns the characters a backslash escapes in option names.
+func (d Dialect) escapedChars() string {
+	chars := `\` + d.Delimiters
+	if d.InlineComments == QuotedInlineComments {
+		chars += d.commentChars()
+	}
+	return chars
+}
+
+// optionEnd returns the index of the delimiter ending the option name on the
+// trimmed line, or -1 if there is none, skipping escaped characters.
+func (d Dialect) optionEnd(l []byte) int {
+	escaped := d.escapedChars()
+	for i := 0; i < len(l); i++ {
+		switch {
+		case l[i] == '\\' && i+1 < len(l) && strings.IndexByte(escaped, l[i+1]) >= 0:
+			i++
+		case strings.IndexByte(d.Delimiters, l[i]) >= 0:
+			return i
+		}
+	}
+	return -1
+}
+
+// unescapeName returns the option name as read, without the backslashes
+// escaping its characters, see Dialect.
+func (d Dialect) unescapeName(name string) string {
+	if strings.IndexByte(name, '\\') < 0 {
+		return name
+	}
+
+	escaped := d.escapedChars()
+	b := make([]byte, 0, len(name))
+	for i := 0; i < len(name); i++ {
+		switch {
+		case name[i] != '\\':
+		case i+1 < len(name) && strings.IndexByte(escaped, name[i+1]) >= 0:
+			i++
+		case i == 0 && len(name) > 1 && strings.TrimSpace(name[1:]) == name[1:]:
+			continue
+		}
+		b = append(b, name[i])
+	}
+	return string(b)
+}
+
+// escapeName returns the option name as written, see Dialect.
+func (d Dialect) escapeName(name string) string {
+	escaped := d.escapedChars()
+	protect := len(name) > 0 && strings.IndexByte(escaped, name[0]) < 0 && (name[0] == '[' || d.isComment([]byte(name)))
+	if !protect && d.Includes {
+		_, _, protect = d.includeDirective([]byte(name + d.delimiter() + "x"))
+	}
+	if !protect && !strings.ContainsAny(name, escaped) {
+		return name
+	}
+
+	var b strings.Builder
+	if protect {
+		b.WriteByte('\\')
+	}
+	for i := 0; i < len(name); i++ {
+		switch {
+		case name[i] != '\\':
+			if strings.IndexByte(escaped, name[i]) >= 0 {
+				b.WriteByte('\\')
+			}
+		case i == 0 && !protect, i+1 == len(name), strings.IndexByte(escaped, name[i+1]) >= 0:
+			b.WriteByte('\\')
+		}
+		b.WriteByte(name[i])
+	}
+	return b.String()
+}
+
+// commentChars returns the characters starting inline comments.
+func (d Dialect) commentChars() string {
+	var chars string
+	for _, prefix := range d.CommentPrefixes {
+		if len(prefix) == 1 {
+			chars += prefix
+		}
+	}
+	return chars
+}
+
+// delimiter returns the delimiter written between options and values.
+func (d Dialect) delimiter() string {
+	delim := "="
+	if d.Delimiters != "" {
+		delim = d.Delimiters[:1]
+	}
+	if d.SpacedDelimiter {
+		return " " + delim + " "
+	}
+	return delim
+}
+
+// uncommentQuoted returns the line without a comment starting at one of chars
+// outside of double quotes, see QuotedInlineComments.
+func uncommentQuoted(l []byte, chars string) []byte {
+	quoted := false
+	for i := 0; i < len(l); i++ {
+		switch {
+		case l[i] == '\\':
+			i++
+		case l[i] == '"':
+			quoted = !quoted
+		case !quoted && strings.IndexByte(chars, l[i]) >= 0:
+			return bytes.TrimSpace(l[:i])
+		}
+	}
+	return l
+}
+
+// scanContinuedLines returns a bufio.SplitFunc like scanRawLines, except that
+// lines ending in a backslash are returned together with the lines continuing
+// them, including comment lines of the dialect in between, see ContinueBackslash.
+func scanContinuedLines(d Dialect) bufio.SplitFunc {
+	return func(data []byte, atEOF bool) (advance int, token []byte, err error) {
+		for start := 0; ; {
+			i := bytes.IndexByte(data[start:], '\n')
+			if i < 0 {
+				if atEOF && len(data) > 0 {
+					return len(data), data, nil
+				}
+				return 0, nil, nil
+			}
+			end := start + i + 1
+			l := bytes.TrimSpace(data[start:end])
+			comment := len(l) > 0 && d.isComment(l)
+			if (comment && start == 0) || (!comment && !bytes.HasSuffix(l, []byte(`\`))) {
+				return end, data[:end], nil
+			}
+			start = end
+		}
+	}
+}
+
+// joinContinued joins the lines of a trimmed line returned by scanContinuedLines,
+// leaving out the comment lines. It returns the number of lines joined to the
+// first one.
+func joinContinued(l []byte, d Dialect) (joined []byte, lines int) {
+	lines = bytes.Count(l, []byte("\n"))
+	if lines == 0 {
+		return bytes.TrimSuffix(l, []byte(`\`)), 0
+	}
+
+	for i, part := range bytes.Split(l, []byte("\n")) {
+		part = bytes.TrimSpace(bytes.TrimSuffix(bytes.TrimSpace(part), []byte(`\`)))
+		if i > 0 && len(part) > 0 && d.isComment(part) {
+			continue
+		}
+		if i > 0 {
+			joined = append(joined, ' ')
+		}
+		joined = append(joined, part...)
+	}
+
+	return joined, lines
+}
+
+// newConfigFile returns a new configuration using the last of the dialects
+// passed to a function reading files, if any.
+func newConfigFile(dialect []Dialect) *ConfigFile {
+	c := NewConfigFile()
+	if len(dialect) > 0 {
+		c.dialect = dialect[len(dialect)-1]
+	}
+	return c
+}
+
+// setMode implements the functions enabling a preset, such as SetGitMode.
+func (c *ConfigFile) setMode(enabled bool, d Dialect) {
+	if !enabled {
+		d = DefaultDialect
+	}
+	c.SetDialect(d)
+}
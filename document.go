@@ -0,0 +1,217 @@
+package conf
+
+import (
+	"bytes"
+	"os"
+	"strings"
+)
+
+// Kinds of document lines.
+const (
+	docOther        = iota // Blank lines, comments and lines not understood.
+	docSection             // Section headers.
+	docOption              // First lines of options.
+	docContinuation        // Continuation lines of multi-line values.
+)
+
+// docEntry is a line of a document kept by Read in document mode.
+type docEntry struct {
+	raw     string // The line as read, including its line terminator.
+	section string // The lower-case section the line belongs to.
+	option  string // The lower-case option of option and continuation lines.
+	kind    int
+	value   string // The value of option lines as read, including continuations.
+}
+
+// SetDocumentMode enables or disables document mode. In document mode, Read
+// keeps every line it reads, including comments, blank lines and lines it
+// cannot interpret instead of failing, and Write reproduces them byte for
+// byte except for the edits made since:
+//
+//   - lines of removed sections and options are left out,
+//   - lines of options with changed values are replaced, keeping the text
+//     preceding the value,
+//   - new options are written after the last option of their section, and
+//     new sections at the end.
+//
+// Existing lines keep their positions, even if sections or options are moved
+// with MoveSection or MoveOption, and the header passed to Write is ignored.
+// Document mode is meant for tools editing files owned by humans. Disabling it
+// drops the lines kept.
+func (c *ConfigFile) SetDocumentMode(enabled bool) {
+	c.document = enabled
+	if !enabled {
+		c.doc = nil
+	}
+}
+
+// ReadConfigDocument reads a file in document mode (see SetDocumentMode) and
+// returns a new configuration representation.
+func ReadConfigDocument(fname string, dialect ...Dialect) (c *ConfigFile, err error) {
+	defer wrapReadError(fname, &err)
+
+	file, err := os.Open(fname)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	c = newConfigFile(dialect)
+	c.SetDocumentMode(true)
+	if err = c.read(file, fname); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// keep records the raw line read in document mode.
+func (c *ConfigFile) keep(raw []byte, e docEntry) {
+	if !c.document {
+		return
+	}
+	e.raw = string(raw)
+	e.section, e.option = c.foldSection(e.section), c.foldOption(e.option)
+
+	switch e.kind {
+	case docOption: // earlier definitions are kept as they are
+		for i := range c.doc {
+			if c.doc[i].kind != docSection && c.doc[i].section == e.section && c.doc[i].option == e.option {
+				c.doc[i].kind = docOther
+			}
+		}
+	case docContinuation:
+		for i := len(c.doc) - 1; i >= 0; i-- {
+			if c.doc[i].kind == docOption && c.doc[i].section == e.section && c.doc[i].option == e.option {
+				c.doc[i].value = e.value
+				break
+			}
+		}
+		e.value = ""
+	}
+
+	c.doc = append(c.doc, e)
+}
+
+// valuePrefix returns the part of the raw option line preceding the value.
+func (d Dialect) valuePrefix(raw string) string {
+	n := d.optionEnd([]byte(raw)) + 1
+	for n < len(raw) && (raw[n] == ' ' || raw[n] == '\t') {
+		n++
+	}
+	return raw[:n]
+}
+
+// lineEnd returns the line terminator of the raw line.
+func lineEnd(raw string) string {
+	switch {
+	case strings.HasSuffix(raw, "\r\n"):
+		return "\r\n"
+	case strings.HasSuffix(raw, "\n"):
+		return "\n"
+	}
+	return ""
+}
+
+// docEOL returns the line terminator of the document, "\n" by default.
+func (c *ConfigFile) docEOL() string {
+	for _, e := range c.doc {
+		if end := lineEnd(e.raw); end != "" {
+			return end
+		}
+	}
+	return "\n"
+}
+
+// writeDocument implements write in document mode.
+func (c *ConfigFile) writeDocument(buf *bytes.Buffer, filter func(section, option, value string) string) {
+	eol := c.docEOL()
+
+	// find the options already in the document and where to add the others
+	known := make(map[cacheKey]bool)
+	last := make(map[string]int)
+	for i, e := range c.doc {
+		if e.kind == docOption {
+			known[cacheKey{e.section, e.option}] = true
+		}
+		if e.kind != docOther || e.option != "" {
+			last[e.section] = i
+		}
+	}
+	addOptions := func(section string) {
+		s := c.data[section]
+		for _, option := range s.keys() {
+			if known[cacheKey{section, option}] {
+				continue
+			}
+			value := s.values[option]
+			if filter != nil {
+				value = filter(section, option, value)
+			}
+			if buf.Len() > 0 && !bytes.HasSuffix(buf.Bytes(), []byte("\n")) {
+				buf.WriteString(eol)
+			}
+			buf.WriteString(c.dialect.formatOption(option, value, eol) + eol)
+		}
+	}
+	if _, ok := last[DefaultSection]; !ok {
+		addOptions(DefaultSection)
+	}
+
+	rewritten := make(map[cacheKey]bool)
+	for i, e := range c.doc {
+		s, ok := c.data[e.section]
+		if !ok {
+			continue // section removed
+		}
+		key := cacheKey{e.section, e.option}
+
+		switch e.kind {
+		case docOption:
+			value, ok := s.get(e.option)
+			if !ok {
+				break // option removed
+			}
+			out := value
+			if filter != nil {
+				out = filter(e.section, e.option, value)
+			}
+			if value == e.value && out == value {
+				buf.WriteString(e.raw)
+				break
+			}
+			rewritten[key] = true
+			prefix := c.dialect.valuePrefix(e.raw)
+			if c.dialect.syntax == gitSyntax && !strings.Contains(prefix, "=") { // boolean shorthand
+				prefix = strings.TrimRight(e.raw, " \t\r\n") + " = "
+			}
+			buf.WriteString(prefix + c.dialect.formatValue(e.option, out, eol) + lineEnd(e.raw))
+
+		case docContinuation:
+			if _, ok := s.get(e.option); ok && !rewritten[key] {
+				buf.WriteString(e.raw)
+			}
+
+		default:
+			if _, ok := s.get(e.option); ok || e.option == "" { // else an earlier definition of a removed option
+				buf.WriteString(e.raw)
+			}
+		}
+
+		if last[e.section] == i {
+			addOptions(e.section)
+		}
+	}
+
+	for _, section := range c.sections {
+		if _, ok := last[section]; ok || section == DefaultSection {
+			continue
+		}
+		if buf.Len() > 0 && !bytes.HasSuffix(buf.Bytes(), []byte("\n")) {
+			buf.WriteString(eol)
+		}
+		buf.WriteString(c.dialect.formatSection(section) + eol)
+		addOptions(section)
+		buf.WriteString(eol)
+	}
+}
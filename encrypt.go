@@ -0,0 +1,137 @@
+package conf
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"os"
+)
+
+// encryptedMagic starts files written by WriteConfigFileEncrypted, followed by
+// a random salt, the nonce and the sealed contents.
+const encryptedMagic = "goconf-aes256-gcm\n"
+
+const (
+	saltSize         = 16
+	passphraseRounds = 600000 // PBKDF2-HMAC-SHA256 iterations
+)
+
+// FileKey is the key of files encrypted by WriteConfigFileEncrypted: either
+// an AESKey or a Passphrase.
+type FileKey interface {
+	aead(salt []byte) (cipher.AEAD, error)
+}
+
+// AESKey is a 32 byte key encrypting files with AES-256 in GCM mode.
+type AESKey []byte
+
+func (k AESKey) aead(salt []byte) (cipher.AEAD, error) {
+	if len(k) != 32 {
+		return nil, errors.New("encryption key must be 32 bytes long")
+	}
+	block, err := aes.NewCipher(k)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Passphrase encrypts files with AES-256 in GCM mode, with a key derived from
+// the passphrase and a random salt stored in the file by PBKDF2-HMAC-SHA256.
+type Passphrase string
+
+func (p Passphrase) aead(salt []byte) (cipher.AEAD, error) {
+	if p == "" {
+		return nil, errors.New("empty passphrase")
+	}
+	return AESKey(pbkdf2([]byte(p), salt, passphraseRounds)).aead(salt)
+}
+
+// pbkdf2 derives a 32 byte key from the password and the salt as specified by
+// RFC 8018, with HMAC-SHA256 as the pseudorandom function.
+func pbkdf2(password []byte, salt []byte, rounds int) []byte {
+	prf := hmac.New(sha256.New, password)
+	prf.Write(salt)
+	prf.Write(binary.BigEndian.AppendUint32(nil, 1)) // the first and only block
+	u := prf.Sum(nil)
+	key := append([]byte(nil), u...)
+	for i := 1; i < rounds; i++ {
+		prf.Reset()
+		prf.Write(u)
+		u = prf.Sum(u[:0])
+		for j := range key {
+			key[j] ^= u[j]
+		}
+	}
+	return key
+}
+
+// WriteConfigFileEncrypted saves the configuration to a file as WriteConfigFile
+// does, encrypting its whole contents with the key, so that the file does not
+// reveal the configuration to whoever else can read it. Only
+// ReadConfigFileEncrypted with the same key or passphrase reads it back.
+func (c *ConfigFile) WriteConfigFileEncrypted(fname string, perm uint32, header string, key FileKey, dialect ...Dialect) (err error) {
+	defer wrapWriteError(fname, &err)
+
+	salt := make([]byte, saltSize)
+	if _, err = rand.Read(salt); err != nil {
+		return err
+	}
+	aead, err := key.aead(salt)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return err
+	}
+
+	data := append([]byte(encryptedMagic), salt...)
+	data = append(data, nonce...)
+	data = aead.Seal(data, nonce, c.WriteConfigBytes(header, dialect...), []byte(encryptedMagic))
+
+	return os.WriteFile(fname, data, os.FileMode(perm))
+}
+
+// ReadConfigFileEncrypted reads a file written by WriteConfigFileEncrypted and
+// returns a new configuration representation, as ReadConfigFile does. It
+// returns an error matching ErrDecryption if the file is not encrypted, the
+// key does not match or the file was modified.
+func ReadConfigFileEncrypted(fname string, key FileKey, dialect ...Dialect) (c *ConfigFile, err error) {
+	defer wrapReadError(fname, &err)
+
+	data, err := os.ReadFile(fname)
+	if err != nil {
+		return nil, err
+	}
+
+	sealed, ok := bytes.CutPrefix(data, []byte(encryptedMagic))
+	if !ok || len(sealed) < saltSize {
+		return nil, ReadError{DecryptionFailed, ""}
+	}
+	aead, err := key.aead(sealed[:saltSize])
+	if err != nil {
+		return nil, err
+	}
+	sealed = sealed[saltSize:]
+	if len(sealed) < aead.NonceSize() {
+		return nil, ReadError{DecryptionFailed, ""}
+	}
+	n := aead.NonceSize()
+	content, err := aead.Open(nil, sealed[:n], sealed[n:], []byte(encryptedMagic))
+	if err != nil {
+		return nil, ReadError{DecryptionFailed, ""}
+	}
+
+	c = newConfigFile(dialect)
+	if err = c.read(bytes.NewReader(content), fname); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
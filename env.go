@@ -0,0 +1,53 @@
+package conf
+
+import (
+	"os"
+	"strings"
+)
+
+// AddEnvOverrides lets environment variables override options at lookup time.
+// The variable overriding an option is named after the prefix, the section
+// and the option, upper-cased and joined by underscores, where any characters
+// other than letters and digits are left out of section and option names.
+// With the prefix "MYAPP", the variable MYAPP_SERVICE1_MAXCLIENTS overrides
+// option maxclients of section service-1, and MYAPP_DEFAULT_HOST overrides
+// option host of the default section. As GetString caches its results,
+// the environment should not change once options have been read.
+//
+// Overrides only apply to lookups of known section and option names; they
+// do not add sections or options to GetSections and GetOptions. Prefixes
+// added later take precedence over earlier ones.
+func (c *ConfigFile) AddEnvOverrides(prefix string) {
+	c.envPrefixes = append(c.envPrefixes, prefix)
+	c.changed()
+}
+
+// lookupEnv returns the value of the environment variable overriding the option in the section.
+func (c *ConfigFile) lookupEnv(section string, option string) (value string, ok bool) {
+	for i := len(c.envPrefixes) - 1; i >= 0; i-- {
+		name := envName(c.envPrefixes[i], section, option)
+		if value, ok = os.LookupEnv(name); ok {
+			if c.logger != nil {
+				c.debugf("option '%s' in section '%s' overridden by environment variable %s", option, section, name)
+			}
+			return value, true
+		}
+	}
+
+	return "", false
+}
+
+// envName returns the name of the environment variable overriding the option in the section.
+func envName(prefix string, section string, option string) string {
+	return strings.ToUpper(prefix + "_" + envWord(section) + "_" + envWord(option))
+}
+
+// envWord removes all characters except letters and digits from s.
+func envWord(s string) string {
+	return strings.Map(func(r rune) rune {
+		if 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9' {
+			return r
+		}
+		return -1
+	}, s)
+}
@@ -0,0 +1,114 @@
+package conf
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Equal reports whether the configurations have the same sections and options
+// in the same order, with the same raw values. Comments, defaults and the
+// other settings of the configurations are not compared.
+func (c *ConfigFile) Equal(other *ConfigFile) bool {
+	if !slices.Equal(c.sections, other.sections) {
+		return false
+	}
+	for _, name := range c.sections {
+		s, o := c.data[name], other.data[name]
+		if !slices.Equal(s.keys(), o.keys()) {
+			return false
+		}
+		for _, option := range s.keys() {
+			v, _ := s.get(option)
+			w, _ := o.get(option)
+			if v != w {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// EqualSemantic reports whether the configurations return the same values for
+// the same options, regardless of the order and case of their sections and
+// options, e.g. to decide whether a service must be restarted after its
+// configuration was deployed. Values are compared as GetString returns them,
+// bools by their meaning (see BoolStrings), so that "on" equals "true".
+// Options set to the value of their default, see SetDefault, equal options
+// left to their default, and sections without options equal missing ones.
+func (c *ConfigFile) EqualSemantic(other *ConfigFile) bool {
+	a, b := c.effective(), other.effective()
+	if len(a) != len(b) {
+		return false
+	}
+	for key, value := range a {
+		if v, ok := b[key]; !ok || !sameValue(value, v) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// effective returns the values of the options set or defaulted, as GetString
+// returns them, keyed by lower-case names.
+func (c *ConfigFile) effective() map[cacheKey]string {
+	values := make(map[cacheKey]string)
+	add := func(section string, option string) {
+		value, err := c.GetString(section, option)
+		if err != nil {
+			value, _ = c.GetRawString(section, option)
+		}
+		values[cacheKey{foldCase(section), foldCase(option)}] = value
+	}
+
+	for section, options := range c.defaults {
+		for option := range options {
+			add(section, option)
+		}
+	}
+	for _, section := range c.sections {
+		for _, option := range c.data[section].keys() {
+			add(section, option)
+		}
+	}
+
+	return values
+}
+
+// Hash returns a digest of the values the configuration returns, as compared
+// by EqualSemantic, e.g. to detect configurations drifting apart between
+// instances of a service. It is the hexadecimal SHA-256 hash of the options
+// set or defaulted, sorted by section and option, with their values as
+// GetString returns them and bools as "true" or "false", so that it only
+// changes with the values returned. Configurations EqualSemantic have the same
+// hash.
+func (c *ConfigFile) Hash() string {
+	values := c.effective()
+	keys := make([]cacheKey, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].section != keys[j].section {
+			return keys[i].section < keys[j].section
+		}
+		return keys[i].option < keys[j].option
+	})
+
+	h := sha256.New()
+	for _, key := range keys {
+		value := values[key]
+		if b, ok := BoolStrings[strings.ToLower(value)]; ok {
+			value = strconv.FormatBool(b)
+		}
+		fmt.Fprintf(h, "%d:%s%d:%s%d:%s", len(key.section), key.section, len(key.option), key.option, len(value), value)
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
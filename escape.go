@@ -0,0 +1,214 @@
+package conf
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Escapes selects the escape sequences standing for characters in values,
+// so that files can carry international strings while staying ASCII.
+//
+// With escapes, values in double quotes are read without the quotes, and
+// \uXXXX within them stands for the Unicode character with the hexadecimal
+// code point XXXX, a pair of UTF-16 surrogates for a single character, \xNN
+// for the byte with the hexadecimal value NN, \" for a double quote and \\
+// for a backslash. Other backslashes are taken literally, and surrogates
+// not in pairs read as U+FFFD. Sequences are decoded before placeholders
+// are unfolded, see Interpolation. In git mode, which quotes and escapes
+// values of its own, \u and \x sequences are decoded anywhere in values,
+// and malformed ones are reported as a ReadError with the reason
+// CouldNotParse.
+//
+// Write writes values which the output cannot represent in double quotes,
+// with escape sequences for the characters concerned. Other values are
+// written as they are, as are the values of options whose names leave a
+// double quote open with QuotedInlineComments.
+type Escapes int
+
+const (
+	// NoEscapes takes values literally.
+	NoEscapes Escapes = iota
+
+	// UnicodeEscapes decodes escape sequences, and writes UTF-8, escaping
+	// the bytes of values which are not valid UTF-8.
+	UnicodeEscapes
+
+	// ASCIIEscapes decodes escape sequences, and writes ASCII, escaping the
+	// other characters of values as UnicodeEscapes does invalid bytes.
+	ASCIIEscapes
+)
+
+// unquote returns the raw value without its double quotes and with its
+// escape sequences decoded, if the dialect has Escapes and the value is
+// quoted, and whether it is.
+func (d Dialect) unquote(value string) (string, bool) {
+	n := len(value)
+	if d.Escapes == NoEscapes || d.syntax == gitSyntax || n < 2 || value[0] != '"' || value[n-1] != '"' {
+		return value, false
+	}
+	return decodeEscapes(value[1 : n-1]), true
+}
+
+// escapeValue returns the raw value as written in the dialect: values the
+// output cannot represent are quoted, with escape sequences for what they
+// read as.
+func (d Dialect) escapeValue(value string) string {
+	if !d.Escapes.needed(value) {
+		return value
+	}
+	v, quoted := d.unquote(value)
+	if !quoted && d.syntax == phpSyntax {
+		v = phpValue(value)
+	}
+	return `"` + d.Escapes.encode(v, true) + `"`
+}
+
+// opensQuote reports whether the name leaves a double quote open, see
+// QuotedInlineComments.
+func opensQuote(name string) bool {
+	quoted := false
+	for i := 0; i < len(name); i++ {
+		switch name[i] {
+		case '\\':
+			i++
+		case '"':
+			quoted = !quoted
+		}
+	}
+	return quoted
+}
+
+// needed reports whether the output cannot represent the value as it is.
+func (e Escapes) needed(value string) bool {
+	switch e {
+	case UnicodeEscapes:
+		return !utf8.ValidString(value)
+	case ASCIIEscapes:
+		for i := 0; i < len(value); i++ {
+			if value[i] >= utf8.RuneSelf {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// encode returns the value with escape sequences for the bytes and, with
+// ASCIIEscapes, the characters the output cannot represent, and for
+// double quotes and the backslashes which would start a sequence if quote is
+// set. Other backslashes are kept, so that they still escape delimiters on
+// lines continuing the value.
+func (e Escapes) encode(value string, quote bool) string {
+	var b strings.Builder
+	for i := 0; i < len(value); {
+		r, size := utf8.DecodeRuneInString(value[i:])
+		switch {
+		case r == utf8.RuneError && size <= 1:
+			b.WriteString(`\x` + hexDigits(uint32(value[i]), 2))
+		case quote && (r == '"' || r == '\\' && (i+1 == len(value) || strings.IndexByte(`\"ux`, value[i+1]) >= 0)):
+			b.WriteString(`\` + string(r))
+		case e == ASCIIEscapes && r >= utf8.RuneSelf:
+			if r1, r2 := utf16.EncodeRune(r); r1 != unicode.ReplacementChar {
+				b.WriteString(`\u` + hexDigits(uint32(r1), 4) + `\u` + hexDigits(uint32(r2), 4))
+			} else {
+				b.WriteString(`\u` + hexDigits(uint32(r), 4))
+			}
+		default:
+			b.WriteString(value[i : i+size])
+		}
+		i += size
+	}
+	return b.String()
+}
+
+// hexDigits returns n in hexadecimal with at least the digits given.
+func hexDigits(n uint32, digits int) string {
+	s := strconv.FormatUint(uint64(n), 16)
+	return strings.Repeat("0", digits-len(s)) + s
+}
+
+// decodeEscapes returns the text of a quoted value with its escape sequences
+// decoded.
+func decodeEscapes(text string) string {
+	if strings.IndexByte(text, '\\') < 0 {
+		return text
+	}
+	b := make([]byte, 0, len(text))
+	for i := 0; i < len(text); i++ {
+		if text[i] != '\\' || i+1 == len(text) {
+			b = append(b, text[i])
+			continue
+		}
+		switch text[i+1] {
+		case '\\', '"':
+			b = append(b, text[i+1])
+			i++
+			continue
+		}
+		var n int
+		if b, n = appendEscape(b, text[i:]); n == 0 {
+			b = append(b, text[i])
+			continue
+		}
+		i += n - 1
+	}
+	return string(b)
+}
+
+// appendEscape appends what the \u or \x escape sequence at the start of s
+// stands for to b, and returns the length of the sequence, including a
+// second \u of a surrogate pair, or 0 if s does not start with one.
+func appendEscape(b []byte, s string) ([]byte, int) {
+	if len(s) < 2 || s[0] != '\\' {
+		return b, 0
+	}
+	switch s[1] {
+	case 'x':
+		if n, ok := parseHex(s[2:], 2); ok {
+			return append(b, byte(n)), 4
+		}
+	case 'u':
+		n, ok := parseHex(s[2:], 4)
+		if !ok {
+			break
+		}
+		r, size := rune(n), 6
+		if utf16.IsSurrogate(r) {
+			r = unicode.ReplacementChar
+			if strings.HasPrefix(s[6:], `\u`) {
+				if n2, ok := parseHex(s[8:], 4); ok {
+					if pair := utf16.DecodeRune(rune(n), rune(n2)); pair != unicode.ReplacementChar {
+						r, size = pair, 12
+					}
+				}
+			}
+		}
+		return utf8.AppendRune(b, r), size
+	}
+	return b, 0
+}
+
+// parseHex returns the number written by the first hexadecimal digits of s,
+// or false if s does not start with as many digits.
+func parseHex(s string, digits int) (uint32, bool) {
+	if len(s) < digits {
+		return 0, false
+	}
+	var n uint32
+	for _, ch := range []byte(s[:digits]) {
+		switch {
+		case '0' <= ch && ch <= '9':
+			n = n<<4 | uint32(ch-'0')
+		case 'a' <= ch && ch <= 'f':
+			n = n<<4 | uint32(ch-'a'+10)
+		case 'A' <= ch && ch <= 'F':
+			n = n<<4 | uint32(ch-'A'+10)
+		default:
+			return 0, false
+		}
+	}
+	return n, true
+}
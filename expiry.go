@@ -0,0 +1,72 @@
+package conf
+
+import (
+	"time"
+)
+
+// ExpiresKey is the metadata key holding when an option expires, see SetExpiry.
+const ExpiresKey = "expires"
+
+// SetExpiry makes the option in the section expire at the given time, e.g. a
+// temporary override which must not outlive an incident. Once it expired, the
+// getters ignore the option as if it were not set, so that they return its
+// default, see SetDefault. Write still writes it. The time is kept as the
+// metadata ExpiresKey in RFC 3339 format, see SetMetadata, which is dropped
+// with the option; setting the option again does not renew it. The zero time
+// removes the expiry. ReadBackend sets the expiry of the options stored in an
+// ExpiringBackend.
+func (c *ConfigFile) SetExpiry(section string, option string, expires time.Time) {
+	if section == "" {
+		section = "default"
+	}
+	key := cacheKey{c.foldSection(section), c.foldOption(option)}
+
+	if t := c.timers[key]; t != nil {
+		t.Stop()
+		delete(c.timers, key)
+	}
+	if expires.IsZero() {
+		delete(c.metadata[key], ExpiresKey)
+		c.changed()
+		return
+	}
+	c.SetMetadata(section, option, ExpiresKey, expires.Format(time.RFC3339Nano))
+	c.changed()
+
+	if c.timers == nil {
+		c.timers = make(map[cacheKey]*time.Timer)
+	}
+	onExpire := c.onExpire
+	c.timers[key] = time.AfterFunc(time.Until(expires), func() {
+		c.mu.Lock()
+		c.cache = nil
+		c.mu.Unlock()
+		if onExpire != nil {
+			onExpire(key.section, key.option)
+		}
+	})
+}
+
+// SetTTL makes the option in the section expire after ttl, see SetExpiry.
+func (c *ConfigFile) SetTTL(section string, option string, ttl time.Duration) {
+	c.SetExpiry(section, option, time.Now().Add(ttl))
+}
+
+// SetExpiryHandler sets a function which is called with the section and option
+// when an option set to expire afterwards expires, see SetExpiry, e.g. to log
+// that an override was reverted. It is called from a goroutine of its own, so
+// it must not modify the configuration without synchronizing with its users.
+func (c *ConfigFile) SetExpiryHandler(fn func(section string, option string)) {
+	c.onExpire = fn
+}
+
+// expired reports whether the option in the section, both given in lower case,
+// has expired.
+func (c *ConfigFile) expired(section string, option string) bool {
+	s, ok := c.metadata[cacheKey{section, option}][ExpiresKey]
+	if !ok {
+		return false
+	}
+	expires, err := time.Parse(time.RFC3339Nano, s)
+	return err == nil && !time.Now().Before(expires)
+}
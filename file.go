@@ -0,0 +1,39 @@
+package conf
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// filePrefix marks values to be read from a file by GetFileContents.
+const filePrefix = "@file:"
+
+// GetFileContents has the same behaviour as GetString, except for values of the form
+//
+//	password = @file:/run/secrets/db-password
+//
+// for which it returns the contents of the named file, with surrounding white
+// space removed. Relative paths are resolved against the directory of the file
+// the option was read from (see Source), or else the working directory.
+// It returns an error if the file cannot be read.
+func (c *ConfigFile) GetFileContents(section string, option string) (value string, err error) {
+	sv, err := c.GetString(section, option)
+	if err != nil || !strings.HasPrefix(sv, filePrefix) {
+		return sv, err
+	}
+
+	path := strings.TrimSpace(sv[len(filePrefix):])
+	if !filepath.IsAbs(path) {
+		if loc, ok := c.Source(section, option); ok && loc.File != "" && !strings.HasPrefix(loc.File, "env:") {
+			path = filepath.Join(filepath.Dir(loc.File), path)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", GetError{ReadFailed, "", path, section, option, err}
+	}
+
+	return strings.TrimSpace(string(data)), nil
+}
@@ -0,0 +1,84 @@
+package conf
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"sort"
+)
+
+// BindFlags connects command-line flags to configuration options. The mapping
+// associates flag names with option keys of the form "section.option" (a key
+// without a dot names an option of the default section, and the option name
+// follows the last dot). It must be called after fs has been parsed.
+//
+// Flags given on the command line override the option in c. Flags which were
+// not given are set from the value GetString returns for the option, and keep
+// their defaults if the section or the option does not exist.
+func BindFlags(c *ConfigFile, fs *flag.FlagSet, mapping map[string]string) error {
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	for name, key := range mapping {
+		f := fs.Lookup(name)
+		if f == nil {
+			return fmt.Errorf("flag -%s is not defined", name)
+		}
+		section, option := splitKey(key)
+
+		if set[name] {
+			if err := c.SetOption(section, option, f.Value.String()); err != nil {
+				return err
+			}
+			c.debugf("option '%s' in section '%s' overridden by flag -%s", option, section, name)
+			continue
+		}
+		value, err := c.GetString(section, option)
+		if errors.Is(err, ErrSectionNotFound) || errors.Is(err, ErrOptionNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err = fs.Set(name, value); err != nil {
+			return fmt.Errorf("option %s: %v", key, err)
+		}
+	}
+
+	return nil
+}
+
+// RegisterFlags defines a string flag on fs for every option in c, using the
+// option's value as the flag's default. Options of the default section are
+// named after the option, all others "section.option". It returns the mapping
+// to pass to BindFlags once fs has been parsed.
+func RegisterFlags(c *ConfigFile, fs *flag.FlagSet) (mapping map[string]string) {
+	mapping = make(map[string]string)
+
+	sections := c.GetSections()
+	sort.Strings(sections)
+	for _, section := range sections {
+		options := append([]string(nil), c.data[section].keys()...)
+		sort.Strings(options)
+
+		for _, option := range options {
+			key := section + "." + option
+			name := key
+			if section == DefaultSection {
+				name = option
+			}
+			if fs.Lookup(name) != nil {
+				continue // already defined by the application
+			}
+
+			value, err := c.GetString(section, option)
+			if err != nil {
+				value, _ = c.data[section].get(option)
+			}
+			fs.String(name, value, "option "+option+" of section "+section)
+			mapping[name] = key
+		}
+	}
+
+	return mapping
+}
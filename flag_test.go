@@ -0,0 +1,111 @@
+package conf_test
+
+import (
+	"flag"
+	"testing"
+
+	. "github.com/akrennmair/goconf"
+)
+
+func TestBindFlags(t *testing.T) {
+	c, err := ReadConfigBytes([]byte(confFile))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	port := fs.Int("port", 1, "")
+	host := fs.String("host", "localhost", "")
+	user := fs.String("user", "nobody", "")
+	if err = fs.Parse([]string{"-host", "example.org"}); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	err = BindFlags(c, fs, map[string]string{"port": "service-1.port", "host": "host", "user": "service-1.user"})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if *port != 443 {
+		t.Errorf("unset flag -port = %d; want 443 from config", *port)
+	}
+	if *user != "nobody" {
+		t.Errorf("unset flag -user = %q; want flag default", *user)
+	}
+	if *host != "example.org" {
+		t.Errorf("flag -host = %q; want example.org", *host)
+	}
+	if ans, _ := c.GetString("service-1", "url"); ans != "http://example.org/something" {
+		t.Error("flag did not override config: " + ans)
+	}
+}
+
+func TestRegisterFlags(t *testing.T) {
+	c, err := ReadConfigBytes([]byte(confFile))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	mapping := RegisterFlags(c, fs)
+	if err = fs.Parse([]string{"-service-1.port", "8443"}); err != nil {
+		t.Fatal(err.Error())
+	}
+	if err = BindFlags(c, fs, mapping); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if ans, _ := c.GetInt("service-1", "port"); ans != 8443 {
+		t.Errorf("c.GetInt(\"service-1\",\"port\") = %d; want 8443", ans)
+	}
+	if f := fs.Lookup("compression"); f == nil || f.DefValue != "on" {
+		t.Error("no flag -compression defaulting to the config value")
+	}
+}
+
+func TestBindFlagsDefaultSection(t *testing.T) {
+	c, err := ReadConfigBytes([]byte("host = a\n[svc]\nport = 1\n"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	host := fs.String("host", "localhost", "")
+	port := fs.Int("port", 0, "")
+	if err = fs.Parse(nil); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	// GetString does not fall back to host of the default section
+	if err = BindFlags(c, fs, map[string]string{"host": "svc.host", "port": "svc.port"}); err != nil {
+		t.Fatal(err.Error())
+	}
+	if *host != "localhost" {
+		t.Errorf("unset flag -host = %q; want flag default", *host)
+	}
+	if *port != 1 {
+		t.Errorf("unset flag -port = %d; want 1 from config", *port)
+	}
+}
+
+func TestRegisterFlagsDottedSection(t *testing.T) {
+	c, err := ReadConfigBytes([]byte("[remote.origin]\nurl = a\n"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	mapping := RegisterFlags(c, fs)
+	if err = fs.Parse([]string{"-remote.origin.url", "b"}); err != nil {
+		t.Fatal(err.Error())
+	}
+	if err = BindFlags(c, fs, mapping); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if ans, _ := c.GetString("remote.origin", "url"); ans != "b" {
+		t.Errorf("c.GetString(\"remote.origin\",\"url\") = %q; want b", ans)
+	}
+	if c.HasSection("remote") {
+		t.Error("flag -remote.origin.url added section remote")
+	}
+}
@@ -0,0 +1,105 @@
+package conf_test
+
+import (
+	"bytes"
+	"testing"
+
+	. "github.com/akrennmair/goconf"
+)
+
+func FuzzRead(f *testing.F) {
+	f.Add([]byte(confFile))
+	f.Add([]byte("[a]\nb = %(c)s\nc = ${a:b}\n  continued ; comment\nrem x\n"))
+	f.Add([]byte("[]\n=\n:x\n[a]\r\nb:c\r\n"))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		for _, lazy := range []bool{false, true} {
+			c := NewConfigFile()
+			c.SetLimits(HardenedLimits)
+			c.SetLazy(lazy)
+			if err := c.Read(bytes.NewReader(data)); err != nil {
+				continue
+			}
+			for _, section := range c.GetSections() {
+				options, _ := c.GetOptions(section)
+				for _, option := range options {
+					c.GetString(section, option)
+				}
+			}
+
+			// what was read must read back the same
+			written := c.WriteConfigBytes("")
+			d, err := ReadConfigBytes(written)
+			if err != nil {
+				t.Fatalf("reading written configuration %q: %v", written, err)
+			}
+			if again := d.WriteConfigBytes(""); !bytes.Equal(again, written) {
+				t.Fatalf("configuration %q written as %q", written, again)
+			}
+		}
+	})
+}
+
+func FuzzRoundTrip(f *testing.F) {
+	f.Add([]byte(confFile), uint8(0))
+	f.Add([]byte("[a]\nb = x\n  continued\n\n  more\nc = \"quoted\" ; comment\n"), uint8(1))
+	f.Add([]byte("[remote \"origin\"]\n\turl = \"a;b\" \\\n  c\n\tbare\n"), uint8(2))
+	f.Add([]byte("[.0]#0"), uint8(2))
+	f.Add([]byte("[0\"\\\n\"]"), uint8(2))
+	f.Add([]byte("[0]\n\"=#"), uint8(2))
+	f.Add([]byte("0=\n[] #"), uint8(0))
+	f.Add([]byte("\\ 0000000="), uint8(0))
+	f.Add([]byte("[0]\nA=\"0\r0\""), uint8(2))
+	f.Add([]byte("\"=;"), uint8(3))
+	f.Add([]byte("[.\"\"]"), uint8(2))
+	f.Add([]byte("[0 .0]#0"), uint8(2))
+	f.Add([]byte("[a]\nb = \"Gr\\u00fc\\xff\\\"\"\nc = \xc3\xa9 \\\n"), uint8(5))
+	f.Add([]byte("[a]\n\tb = \\uD83D\\uDE00\xff\n"), uint8(6))
+	f.Add([]byte("0=\n\x9a\\="), uint8(5))
+	f.Add([]byte("\"=\xf7;"), uint8(7))
+
+	ascii := func(d Dialect) Dialect {
+		d.Escapes = ASCIIEscapes
+		return d
+	}
+	dialects := []Dialect{DefaultDialect, PythonDialect, GitDialect, PHPDialect, StrictDialect, ascii(DefaultDialect), ascii(GitDialect), ascii(PHPDialect)}
+	f.Fuzz(func(t *testing.T, data []byte, dialect uint8) {
+		d := dialects[int(dialect)%len(dialects)]
+		c, err := ReadConfigBytes(data, d)
+		if err != nil {
+			return
+		}
+		if err = CheckRoundTrip(data, d); err != nil {
+			t.Fatalf("CheckRoundTrip(%q) in dialect %d: %v", data, dialect, err)
+		}
+		if err = c.Normalize(); err != nil {
+			t.Fatalf("Normalize() of %q: %v", data, err)
+		}
+	})
+}
+
+func FuzzUnfold(f *testing.F) {
+	f.Add("http://%(host)s:%(port)s/%(path)s", false)
+	f.Add("${host}$$${default:port}${${}", true)
+	f.Add("%(a)s%(a)s%(a)s%(a)s", false)
+
+	f.Fuzz(func(t *testing.T, value string, extended bool) {
+		c := NewConfigFile()
+		c.SetLimits(HardenedLimits)
+		if extended {
+			c.SetInterpolation(ExtendedInterpolation)
+		}
+		c.AddOption("default", "host", "example.com")
+		c.AddOption("default", "a", value+value)
+		c.AddOption("default", "port", value)
+		c.AddOption("service-1", "path", value)
+		c.AddOption("service-1", "value", value)
+
+		for _, option := range []string{"a", "port"} {
+			c.GetString("default", option)
+		}
+		for _, option := range []string{"path", "value"} {
+			c.GetString("service-1", option)
+		}
+	})
+}
@@ -1,6 +1,11 @@
 package conf
 
 import (
+	"errors"
+	"math"
+	"os/exec"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 )
@@ -8,12 +13,41 @@ import (
 // GetSections returns the list of sections in the configuration.
 // (The default section always exists.)
 func (c *ConfigFile) GetSections() (sections []string) {
-	sections = make([]string, len(c.data))
+	sections = make([]string, len(c.sections))
+	copy(sections, c.sections)
 
-	i := 0
-	for s, _ := range c.data {
-		sections[i] = s
-		i++
+	return sections
+}
+
+// GetSectionsMatching returns the sections whose names match the pattern, which
+// has the syntax of path.Match and is case insensitive, in the order of the
+// configuration, e.g. the sections of all instances of a service:
+//
+//	for _, section := range c.GetSectionsMatching("service-*") {
+//		port, err := c.GetInt(section, "port")
+//		...
+//	}
+//
+// A malformed pattern matches no section.
+func (c *ConfigFile) GetSectionsMatching(pattern string) (sections []string) {
+	pattern = c.foldSection(pattern)
+	for _, section := range c.sections {
+		if matchAny([]string{pattern}, section) {
+			sections = append(sections, section)
+		}
+	}
+
+	return sections
+}
+
+// GetSectionsMatchingRegexp returns the sections whose names, as returned by
+// GetSections, contain a match of the regular expression, in the order of the
+// configuration.
+func (c *ConfigFile) GetSectionsMatchingRegexp(re *regexp.Regexp) (sections []string) {
+	for _, section := range c.sections {
+		if re.MatchString(section) {
+			sections = append(sections, section)
+		}
 	}
 
 	return sections
@@ -25,7 +59,7 @@ func (c *ConfigFile) HasSection(section string) bool {
 	if section == "" {
 		section = "default"
 	}
-	_, ok := c.data[strings.ToLower(section)]
+	_, ok := c.data[c.foldSection(section)]
 
 	return ok
 }
@@ -37,22 +71,15 @@ func (c *ConfigFile) GetOptions(section string) (options []string, err error) {
 	if section == "" {
 		section = "default"
 	}
-	section = strings.ToLower(section)
+	section = c.foldSection(section)
 
 	if _, ok := c.data[section]; !ok {
-		return nil, GetError{SectionNotFound, "", "", section, ""}
+		return nil, GetError{SectionNotFound, "", "", section, "", nil}
 	}
 
-	options = make([]string, len(c.data[DefaultSection])+len(c.data[section]))
-	i := 0
-	for s, _ := range c.data[DefaultSection] {
-		options[i] = s
-		i++
-	}
-	for s, _ := range c.data[section] {
-		options[i] = s
-		i++
-	}
+	options = make([]string, 0, c.data[DefaultSection].len()+c.data[section].len())
+	options = append(options, c.data[DefaultSection].keys()...)
+	options = append(options, c.data[section].keys()...)
 
 	return options, nil
 }
@@ -63,17 +90,18 @@ func (c *ConfigFile) HasOption(section string, option string) bool {
 	if section == "" {
 		section = "default"
 	}
-	section = strings.ToLower(section)
-	option = strings.ToLower(option)
+	section = c.foldSection(section)
+	option = c.foldOption(option)
 
+	if _, ok := c.lookup(section, option); ok {
+		return true
+	}
 	if _, ok := c.data[section]; !ok {
 		return false
 	}
+	_, ok := c.lookup(DefaultSection, option)
 
-	_, okd := c.data[DefaultSection][option]
-	_, oknd := c.data[section][option]
-
-	return okd || oknd
+	return ok
 }
 
 // GetRawString gets the (raw) string value for the given option in the section.
@@ -84,84 +112,437 @@ func (c *ConfigFile) GetRawString(section string, option string) (value string,
 		section = "default"
 	}
 
-	section = strings.ToLower(section)
-	option = strings.ToLower(option)
+	return c.rawString(c.foldSection(section), c.foldOption(option))
+}
 
+// rawString implements GetRawString for a lower-case section and option.
+func (c *ConfigFile) rawString(section string, option string) (value string, err error) {
+	if value, ok := c.lookup(section, option); ok {
+		return value, nil
+	}
 	if _, ok := c.data[section]; ok {
-		if value, ok = c.data[section][option]; ok {
-			return value, nil
+		return "", GetError{OptionNotFound, "", "", section, option, nil}
+	}
+	return "", GetError{SectionNotFound, "", "", section, option, nil}
+}
+
+// IsSet checks if the option is explicitly configured in the section, either
+// in the configuration itself, in the section of the current profile or by an
+// environment override, as opposed to
+// falling back to a default registered with SetDefault.
+func (c *ConfigFile) IsSet(section string, option string) bool {
+	if section == "" {
+		section = "default"
+	}
+	section = c.foldSection(section)
+	option = c.foldOption(option)
+
+	_, ok := c.lookupSet(section, option)
+
+	return ok
+}
+
+// lookup returns the value of the option in the section, both given in lower case,
+// falling back to defaults registered with SetDefault if it is not explicitly set.
+// Unlike HasOption, it does not fall back to the default section, except in
+// Python mode; in PHP mode, the default section falls back to the other sections.
+func (c *ConfigFile) lookup(section string, option string) (value string, ok bool) {
+	if value, ok = c.lookupSet(section, option); ok {
+		return value, true
+	}
+	if value, ok = c.defaults[section][option]; ok {
+		return value, true
+	}
+	if _, exists := c.data[section]; exists && c.dialect.syntax == pythonSyntax && section != DefaultSection {
+		return c.lookup(DefaultSection, option)
+	}
+	if c.dialect.syntax == phpSyntax && section == DefaultSection {
+		for i := len(c.sections) - 1; i >= 0; i-- {
+			if c.sections[i] == DefaultSection {
+				continue
+			}
+			if value, ok = c.lookupSet(c.sections[i], option); ok {
+				return value, true
+			}
 		}
-		return "", GetError{OptionNotFound, "", "", section, option}
 	}
-	return "", GetError{SectionNotFound, "", "", section, option}
+
+	return "", false
+}
+
+// lookupSet returns the explicitly set value of the option in the section.
+// Environment overrides take precedence over the profile's section, which takes
+// precedence over the section itself.
+func (c *ConfigFile) lookupSet(section string, option string) (value string, ok bool) {
+	if value, ok = c.lookupEnv(section, option); ok {
+		return value, true
+	}
+	if c.profile != "" {
+		if value, ok = c.lookupData(section+"@"+c.profile, option); ok {
+			return value, true
+		}
+	}
+
+	return c.lookupData(section, option)
+}
+
+// lookupData returns the value of the option in the section of the configuration,
+// preferring values for the current host or operating system (see lookupConditional)
+// and also looking the option up under its old names registered with AddAlias.
+func (c *ConfigFile) lookupData(section string, option string) (value string, ok bool) {
+	if value, ok = c.lookupConditional(section, option); ok {
+		return value, true
+	}
+	if value, ok = c.data[section].get(option); ok && !c.expired(section, option) {
+		c.markUsed(section, option)
+		return value, true
+	}
+
+	return c.lookupAlias(section, option)
 }
 
 // GetString gets the string value for the given option in the section.
 // If the value needs to be unfolded (see e.g. %(host)s example in the beginning of this documentation),
 // then GetString does this unfolding automatically, up to DepthValues number of iterations.
+// The placeholder syntax is selected with SetInterpolation.
+// Encrypted values are decrypted if a key has been set with SetEncryptionKey.
+// Unfolded values are cached until the configuration is next modified.
 // It returns an error if either the section or the option do not exist, or the unfolding cycled.
 func (c *ConfigFile) GetString(section string, option string) (value string, err error) {
-	value, err = c.GetRawString(section, option)
+	if section == "" {
+		section = "default"
+	}
+	return c.getString(cacheKey{c.foldSection(section), c.foldOption(option)})
+}
+
+// getString implements GetString for a lower-case section and option.
+// Values found in the cache are returned without allocating.
+func (c *ConfigFile) getString(key cacheKey) (value string, err error) {
+	c.mu.Lock()
+	value, ok := c.cache[key]
+	c.mu.Unlock()
+	metrics.CacheLookup(ok)
+	if ok {
+		return value, nil
+	}
+
+	value, err = c.unfolded(key, c.resolve)
 	if err != nil {
 		return "", err
 	}
 
-	section = strings.ToLower(section)
+	if c.logger != nil {
+		c.logValue(key.section, key.option, value)
+	}
 
-	var i int
+	c.mu.Lock()
+	if c.cache == nil {
+		c.cache = make(map[cacheKey]string)
+	}
+	c.cache[key] = value
+	c.mu.Unlock()
 
-	for i = 0; i < DepthValues; i++ { // keep a sane depth
-		vr := varRegExp.FindString(value)
-		if len(vr) == 0 {
-			break
+	return value, nil
+}
+
+// resolver returns the value of the option referenced by a placeholder in the
+// section, see ConfigFile.resolve and Stack.resolve.
+type resolver func(section string, ref string) (nsection string, noption string, nvalue string, err error)
+
+// unfolded returns the value of the option, given in lower case, decrypted or
+// with its placeholders unfolded, looking up the options they refer to with
+// resolve.
+func (c *ConfigFile) unfolded(key cacheKey, resolve resolver) (value string, err error) {
+	value, err = c.rawString(key.section, key.option)
+	if err != nil {
+		return "", err
+	}
+
+	return c.unfoldValue(key, value, resolve)
+}
+
+// unfoldValue returns the raw value of the option, given in lower case,
+// decrypted or with its placeholders unfolded, see unfolded.
+func (c *ConfigFile) unfoldValue(key cacheKey, value string, resolve resolver) (string, error) {
+	var err error
+	quoted := false
+	if c.isSecret(value) {
+		value, err = c.decrypt(key.section, key.option, value)
+	} else {
+		value, quoted = c.dialect.unquote(value)
+		value, err = c.unfold(key.section, key.option, value, 0, resolve, new(map[cacheKey]string))
+	}
+	if c.dialect.syntax == phpSyntax && err == nil && !quoted {
+		value = phpValue(value)
+	}
+
+	return value, err
+}
+
+// unfold substitutes the placeholders found in value, which belongs to the given option,
+// looking up the options they refer to with resolve.
+// Substituted values are unfolded recursively; depth counts the levels already descended.
+// Values unfolded for placeholders are memoized in *memo, which is allocated when needed,
+// so that options referenced several times are unfolded once.
+func (c *ConfigFile) unfold(section string, option string, value string, depth int, resolve resolver, memo *map[cacheKey]string) (string, error) {
+	p, ok := c.nextPlaceholder(value, 0)
+	if !ok {
+		return value, nil
+	}
+	if depth == DepthValues || (c.dialect.syntax == pythonSyntax && depth == pythonDepth) {
+		return "", GetError{MaxDepthReached, "", "", section, option, nil}
+	}
+
+	var buf []byte
+	last := 0
+	for ; ok; p, ok = c.nextPlaceholder(value, p.end) {
+		if max := c.limits.MaxValueLength; max > 0 && len(buf) > max {
+			return "", GetError{LimitExceeded, "MaxValueLength", "", section, option, nil}
+		}
+		buf = append(buf, value[last:p.start]...)
+		last = p.end
+
+		switch p.kind {
+		case placeholderCommand:
+			out, err := runCommand(p.name)
+			if err != nil {
+				return "", GetError{CommandFailed, "", p.name, section, option, err}
+			}
+			if c.logger != nil {
+				c.debugf("option '%s' in section '%s': ran command '%s'", option, section, p.name)
+			}
+			buf = append(buf, out...)
+			continue
+		case placeholderEscape:
+			buf = append(buf, value[p.start])
+			continue
+		case placeholderInvalid:
+			return "", GetError{CouldNotParse, "interpolated", value, section, option, nil}
 		}
 
-		noption := value[vr[2]:vr[3]]
-		noption = strings.ToLower(noption)
+		// placeholders with an argument can only name builtins,
+		// others name builtins unless they name an option
+		if p.hasArg {
+			if b, ok := c.builtin(p.name); ok {
+				c.logBuiltin(section, option, value[p.start:p.end])
+				buf = append(buf, b...)
+			} else {
+				buf = append(buf, value[p.start:p.end]...)
+			}
+			continue
+		}
+		nsection, noption, nvalue, err := resolve(section, p.name)
+		if err != nil {
+			b, ok := c.builtin(p.name)
+			if !ok {
+				return "", err
+			}
+			c.logBuiltin(section, option, value[p.start:p.end])
+			buf = append(buf, b...)
+			continue
+		}
 
-		nvalue, _ := c.data[DefaultSection][noption] // search variable in default section
-		if _, ok := c.data[section][noption]; ok {
-			nvalue = c.data[section][noption]
+		if c.logger != nil {
+			c.debugf("option '%s' in section '%s': %s refers to option '%s' in section '%s'", option, section, value[p.start:p.end], noption, nsection)
+		}
+		key := cacheKey{nsection, noption}
+		if v, ok := (*memo)[key]; ok {
+			buf = append(buf, v...)
+			continue
+		}
+		if c.isSecret(nvalue) {
+			nvalue, err = c.decrypt(nsection, noption, nvalue)
+		} else {
+			nvalue, _ = c.dialect.unquote(nvalue)
+			nvalue, err = c.unfold(nsection, noption, nvalue, depth+1, resolve, memo)
 		}
-		if nvalue == "" {
-			return "", GetError{OptionNotFound, "", "", section, option}
+		if err != nil {
+			return "", err
+		}
+		if *memo == nil {
+			*memo = make(map[cacheKey]string)
+		}
+		(*memo)[key] = nvalue
+		buf = append(buf, nvalue...)
+	}
+	buf = append(buf, value[last:]...)
+	if max := c.limits.MaxValueLength; max > 0 && len(buf) > max {
+		return "", GetError{LimitExceeded, "MaxValueLength", "", section, option, nil}
+	}
+
+	return string(buf), nil
+}
+
+// resolve returns the value of the option referenced by a placeholder in the
+// section. Basic placeholders are resolved in the requesting section,
+// extended ones in the section they name; both fall back to the default section.
+func (c *ConfigFile) resolve(section string, ref string) (nsection string, noption string, nvalue string, err error) {
+	return c.resolveWith(section, ref, c.lookup)
+}
+
+// resolveWith implements resolve, looking options up with lookup.
+func (c *ConfigFile) resolveWith(section string, ref string, lookup func(section, option string) (string, bool)) (nsection string, noption string, nvalue string, err error) {
+	nsection, noption = section, c.foldOption(ref)
+	if c.dialect.Interpolation == ExtendedInterpolation {
+		if i := strings.Index(noption, ":"); i >= 0 {
+			nsection, noption = noption[:i], noption[i+1:]
+			if _, ok := c.data[nsection]; !ok {
+				return "", "", "", GetError{SectionNotFound, "", "", nsection, noption, nil}
+			}
 		}
+	}
 
-		// substitute by new value and take off leading '%(' and trailing ')s'
-		value = value[0:vr[2]-2] + nvalue + value[vr[3]+2:]
+	nvalue, ok := lookup(nsection, noption)
+	if !ok {
+		nvalue, ok = lookup(DefaultSection, noption) // search variable in default section
+	}
+	if !ok {
+		return "", "", "", GetError{OptionNotFound, "", "", nsection, noption, nil}
 	}
 
-	if i == DepthValues {
-		return "", GetError{MaxDepthReached, "", "", section, option}
+	return nsection, noption, nvalue, nil
+}
+
+// runCommand runs the command line and returns its standard output without
+// trailing newlines.
+func runCommand(command string) (string, error) {
+	args := strings.Fields(command)
+	if len(args) == 0 {
+		return "", exec.ErrNotFound
 	}
 
-	return value, nil
+	out, err := exec.Command(args[0], args[1:]...).Output()
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimRight(string(out), "\r\n"), nil
 }
 
 // GetInt has the same behaviour as GetString but converts the response to int.
+// See SetIntLiterals for the accepted syntax; values of options with a unit are
+// converted to the unit, see Unit.
 func (c *ConfigFile) GetInt(section string, option string) (value int, err error) {
 	sv, err := c.GetString(section, option)
-	if err == nil {
-		value, err = strconv.Atoi(sv)
-		if err != nil {
-			err = GetError{CouldNotParse, "int", sv, section, option}
+	if err != nil {
+		return 0, err
+	}
+
+	return c.parseInt(sv, section, option)
+}
+
+// parseInt converts the value of the option to int.
+func (c *ConfigFile) parseInt(sv string, section string, option string) (value int, err error) {
+	if unit := c.unit(section, option); unit != NoUnit {
+		f, err := unit.parse(sv)
+		if err != nil || f != math.Trunc(f) {
+			return 0, GetError{CouldNotParse, "int", sv, section, option, err}
 		}
+		return int(f), nil
+	}
+	if c.intLiterals {
+		var n int64
+		n, err = strconv.ParseInt(sv, 0, strconv.IntSize)
+		value = int(n)
+	} else {
+		value, err = strconv.Atoi(sv)
+	}
+	if err != nil {
+		return 0, GetError{CouldNotParse, "int", sv, section, option, err}
 	}
 
-	return value, err
+	return value, nil
 }
 
 // GetFloat has the same behaviour as GetString but converts the response to float.
+// See SetLocaleNumbers for the accepted syntax; values of options with a unit
+// are converted to the unit, see Unit.
 func (c *ConfigFile) GetFloat64(section string, option string) (value float64, err error) {
 	sv, err := c.GetString(section, option)
-	if err == nil {
+	if err != nil {
+		return 0, err
+	}
+
+	return c.parseFloat(sv, section, option)
+}
+
+// parseFloat converts the value of the option to float64.
+func (c *ConfigFile) parseFloat(sv string, section string, option string) (value float64, err error) {
+	num := sv
+	if c.localeNumbers {
+		num = delocalize(sv)
+	}
+	value, err = c.unit(section, option).parse(num)
+	if err != nil {
+		return 0, GetError{CouldNotParse, "float64", sv, section, option, err}
+	}
+
+	return value, nil
+}
+
+// GetRatio has the same behaviour as GetString but converts the response to a
+// ratio between 0 and 1, given either as a fraction, e.g. 0.75, or as a
+// percentage, e.g. 75%. It returns an error if the ratio is out of range.
+func (c *ConfigFile) GetRatio(section string, option string) (value float64, err error) {
+	sv, err := c.GetString(section, option)
+	if err != nil {
+		return 0, err
+	}
+
+	if s, ok := strings.CutSuffix(sv, "%"); ok {
+		value, err = strconv.ParseFloat(strings.TrimSpace(s), 64)
+		value /= 100
+	} else {
 		value, err = strconv.ParseFloat(sv, 64)
-		if err != nil {
-			err = GetError{CouldNotParse, "float64", sv, section, option}
+	}
+	if err != nil {
+		return 0, GetError{CouldNotParse, "ratio", sv, section, option, err}
+	}
+	if !(value >= 0 && value <= 1) {
+		return 0, GetError{OutOfRange, "ratio", sv, section, option, nil}
+	}
+
+	return value, nil
+}
+
+// GetChoice has the same behaviour as GetString but maps the response to one
+// of the choices, e.g. to the constants of an enumeration:
+//
+//	level, err := c.GetChoice("log", "level", map[string]any{
+//		"debug": slog.LevelDebug,
+//		"info":  slog.LevelInfo,
+//		"warn":  slog.LevelWarn,
+//	})
+//
+// Values match the keys of choices exactly or, failing that, ignoring case if
+// only one key matches. It returns an error listing the valid choices if the
+// value matches none.
+func (c *ConfigFile) GetChoice(section string, option string, choices map[string]any) (value any, err error) {
+	sv, err := c.GetString(section, option)
+	if err != nil {
+		return nil, err
+	}
+
+	if value, ok := choices[sv]; ok {
+		return value, nil
+	}
+	matches := 0
+	for key, v := range choices {
+		if strings.EqualFold(key, sv) {
+			value = v
+			matches++
 		}
 	}
+	if matches == 1 {
+		return value, nil
+	}
 
-	return value, err
+	keys := make([]string, 0, len(choices))
+	for key := range choices {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return nil, GetError{CouldNotParse, "choice", sv, section, option, errors.New("valid choices are " + strings.Join(keys, ", "))}
 }
 
 // GetBool has the same behaviour as GetString but converts the response to bool.
@@ -172,10 +553,52 @@ func (c *ConfigFile) GetBool(section string, option string) (value bool, err err
 		return false, err
 	}
 
+	return c.boolValue(sv, section, option)
+}
+
+// boolValue converts the value of the option to bool, taking empty values
+// for false in git and PHP mode.
+func (c *ConfigFile) boolValue(sv string, section string, option string) (value bool, err error) {
+	if (c.dialect.syntax == gitSyntax || c.dialect.syntax == phpSyntax) && sv == "" {
+		return false, nil
+	}
+
+	return parseBool(sv, section, option)
+}
+
+// parseBool converts the value of the option to bool.
+func parseBool(sv string, section string, option string) (value bool, err error) {
 	value, ok := BoolStrings[strings.ToLower(sv)]
 	if !ok {
-		return false, GetError{CouldNotParse, "bool", sv, section, option}
+		return false, GetError{CouldNotParse, "bool", sv, section, option, nil}
+	}
+
+	return value, nil
+}
+
+// GetBoolStrict has the same behaviour as GetBool but only accepts the strings
+// of StrictBoolStrings, with their exact case.
+func (c *ConfigFile) GetBoolStrict(section string, option string) (value bool, err error) {
+	sv, err := c.GetString(section, option)
+	if err != nil {
+		return false, err
+	}
+
+	value, ok := StrictBoolStrings[sv]
+	if !ok {
+		return false, GetError{CouldNotParse, "bool", sv, section, option, nil}
 	}
 
 	return value, nil
 }
+
+// GetBoolOk has the same behaviour as GetBool, but reports a missing section or
+// option by returning false for set instead of an error.
+func (c *ConfigFile) GetBoolOk(section string, option string) (value bool, set bool, err error) {
+	value, err = c.GetBool(section, option)
+	if errors.Is(err, ErrSectionNotFound) || errors.Is(err, ErrOptionNotFound) {
+		return false, false, nil
+	}
+
+	return value, true, err
+}
@@ -0,0 +1,216 @@
+package conf
+
+import (
+	"bytes"
+	"strings"
+)
+
+// GitDialect handles the syntax of git's configuration files, such as
+// .gitconfig and .git/config:
+//
+//   - a header [remote "origin"] starts the section "remote.origin". Section
+//     names are case insensitive, subsection names are not; the deprecated
+//     form [remote.origin] lowercases both. Section names consist of letters,
+//     digits, "-" and ".",
+//   - options must follow a section header, and only "=" separates options
+//     from values. An option without "=" is set to "true". Option names are
+//     case insensitive and consist of letters, digits and "-", starting with
+//     a letter,
+//   - "#" and ";" start comments anywhere outside of double quotes. Quotes are
+//     removed from values, as are the backslashes of the escape sequences \",
+//     \\, \n, \t and \b, and white space outside of quotes is trimmed,
+//   - a line ending in a backslash continues on the next line,
+//   - the value of a repeated option is the last one,
+//   - with Includes, which GitDialect sets, the file named by the option path
+//     of the section [include] is read where the option is found, relative to the directory of the including file.
+//     A path with the wildcards of filepath.Match, such as conf.d/*.conf,
+//     includes the files matching it in lexical order. Missing files are
+//     ignored, files including themselves, directly or not, are reported as a
+//     ReadError with the reason IncludeCycle, and files nested more than 10
+//     levels deep as one with the reason LimitExceeded. Options read from
+//     included files are located in them, see Source, and Included lists the
+//     files. As by git config --file, included files are not read in document
+//     mode, which is meant for editing the file itself,
+//   - GetString does not unfold placeholders, and GetBool takes empty values
+//     for false,
+//   - Write writes subsections as [remote "origin"] and options indented by a
+//     tab, quoting and escaping values as needed.
+//
+// Read does not defer parsing in this dialect, even if SetLazy is enabled.
+var GitDialect = Dialect{
+	CommentPrefixes: []string{"#", ";"},
+	InlineComments:  QuotedInlineComments,
+	Delimiters:      "=",
+	SpacedDelimiter: true,
+	Continuation:    ContinueBackslash,
+	Duplicates:      DuplicatesOverride,
+	Interpolation:   NoInterpolation,
+	Includes:        true,
+	syntax:          gitSyntax,
+}
+
+// SetGitMode selects GitDialect if enabled, and DefaultDialect otherwise, see
+// SetDialect.
+func (c *ConfigFile) SetGitMode(enabled bool) {
+	c.setMode(enabled, GitDialect)
+}
+
+// scanGitLines is a bufio.SplitFunc like scanRawLines, except that lines
+// ending in an unescaped backslash are returned together with the lines
+// continuing them.
+func scanGitLines(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	for start := 0; ; {
+		i := bytes.IndexByte(data[start:], '\n')
+		if i < 0 {
+			if atEOF && len(data) > 0 {
+				return len(data), data, nil
+			}
+			return 0, nil, nil
+		}
+		end := start + i + 1
+		l := bytes.TrimRight(data[start:end], "\r\n")
+		if (len(l)-len(bytes.TrimRight(l, `\`)))%2 == 0 {
+			return end, data[:end], nil
+		}
+		start = end
+	}
+}
+
+// gitSection returns the name of the section whose header has the text between
+// the brackets, with the subsection, if any, appended after a dot.
+func gitSection(header []byte) (string, error) {
+	i := bytes.IndexByte(header, '"')
+	if i < 0 {
+		name := bytes.TrimSpace(header)
+		if bytes.HasPrefix(name, []byte(".")) || !isGitSectionName(name) {
+			return "", ReadError{CouldNotParse, "[" + string(header) + "]"}
+		}
+		return foldCase(string(name)), nil
+	}
+
+	name, quoted := bytes.TrimSpace(header[:i]), header[i:]
+	if len(name) == 0 || bytes.IndexByte(name, '.') >= 0 || !isGitSectionName(name) || len(quoted) < 2 || quoted[len(quoted)-1] != '"' {
+		return "", ReadError{CouldNotParse, "[" + string(header) + "]"}
+	}
+	var sub []byte
+	for j := 1; j < len(quoted)-1; j++ {
+		if quoted[j] == '\\' && j+1 < len(quoted)-1 {
+			j++
+		}
+		if quoted[j] == '\n' {
+			return "", ReadError{CouldNotParse, "[" + string(header) + "]"}
+		}
+		sub = append(sub, quoted[j])
+	}
+
+	return foldCase(string(name)) + "." + string(sub), nil
+}
+
+// isGitName reports whether the option name is valid in git mode: letters,
+// digits and "-", starting with a letter.
+func isGitName(name string) bool {
+	for i := 0; i < len(name); i++ {
+		switch ch := name[i]; {
+		case 'a' <= ch && ch <= 'z', 'A' <= ch && ch <= 'Z':
+		case i > 0 && ('0' <= ch && ch <= '9' || ch == '-'):
+		default:
+			return false
+		}
+	}
+	return name != ""
+}
+
+// isGitSectionName reports whether the section name is valid in git mode:
+// letters, digits, "-" and ".".
+func isGitSectionName(name []byte) bool {
+	for _, ch := range name {
+		if !('a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || '0' <= ch && ch <= '9' || ch == '-' || ch == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+// gitValue returns the value following "=" on an option line, with quotes and
+// escape sequences removed, continued lines joined and white space outside of
+// quotes trimmed and turned into spaces, as git does. With escapes, \u and \x
+// sequences are decoded as well.
+func gitValue(text []byte, escapes Escapes) (string, error) {
+	var value []byte
+	quoted := false
+	end := 0 // length of the value without trailing white space outside of quotes
+	for i := 0; i < len(text); i++ {
+		switch ch := text[i]; {
+		case ch == '\\':
+			i++
+			if i == len(text) {
+				return "", ReadError{CouldNotParse, string(text)}
+			}
+			switch text[i] {
+			case '\n':
+				continue
+			case '\r':
+				if i+1 < len(text) && text[i+1] == '\n' {
+					i++
+					continue
+				}
+				return "", ReadError{CouldNotParse, string(text)}
+			case 'n':
+				value = append(value, '\n')
+			case 't':
+				value = append(value, '\t')
+			case 'b':
+				value = append(value, '\b')
+			case '\\', '"':
+				value = append(value, text[i])
+			default:
+				n := 0
+				if escapes != NoEscapes {
+					value, n = appendEscape(value, string(text[i-1:min(len(text), i+11)]))
+				}
+				if n == 0 {
+					return "", ReadError{CouldNotParse, string(text)}
+				}
+				i += n - 2
+			}
+			end = len(value)
+		case ch == '"':
+			quoted = !quoted
+		case !quoted && (ch == ' ' || ch == '\t' || ch == '\r' || ch == '\n'):
+			if len(value) > 0 {
+				value = append(value, ' ')
+			}
+		default:
+			value = append(value, ch)
+			end = len(value)
+		}
+	}
+	if quoted {
+		return "", ReadError{CouldNotParse, string(text)}
+	}
+
+	return string(value[:end]), nil
+}
+
+// gitQuote returns the value as written in git mode with the escapes.
+func gitQuote(value string, escapes Escapes) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\t", `\t`, "\b", `\b`)
+	quoted := r.Replace(value)
+	if escapes.needed(quoted) {
+		quoted = escapes.encode(quoted, false)
+	}
+	if value != strings.TrimSpace(value) || strings.ContainsAny(value, "#;\r") {
+		quoted = `"` + quoted + `"`
+	}
+	return quoted
+}
+
+// gitHeader returns the header of the section as written in git mode.
+func gitHeader(section string) string {
+	i := strings.IndexByte(section, '.')
+	if i < 0 {
+		return "[" + section + "]"
+	}
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+	return "[" + section[:i] + ` "` + r.Replace(section[i+1:]) + `"]`
+}
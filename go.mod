@@ -0,0 +1,3 @@
+module github.com/akrennmair/goconf
+
+go 1.21
@@ -0,0 +1,136 @@
+package conf
+
+import (
+	"encoding/json"
+	"io"
+	"maps"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Handler serves a configuration over HTTP, for operators to inspect the
+// configuration a process is actually running with, similar to expvar:
+//
+//	http.Handle("/debug/config", conf.NewHandler(c))
+//
+// GET requests are answered with the configuration in its file format, or as
+// a JSON object mapping sections to options to their raw values, including
+// defaults, if the request has the parameter format=json or accepts
+// application/json. Values are neither unfolded nor decrypted, and options are
+// not marked as used, see UnusedOptions. Values of options matching the
+// redaction patterns are masked as by StringRedacted, as are encrypted values.
+//
+// If Authorize and Replace are set, PUT requests with the parameters section
+// and option set the option to the request body, provided that Authorize
+// approves the request. The option is set in a clone of the configuration,
+// see Clone, which is passed to Replace, so that the configuration served
+// until then is not modified under its other users.
+type Handler struct {
+	Config    func() *ConfigFile       // Returns the configuration to serve.
+	Replace   func(*ConfigFile)        // Installs the configuration modified by a PUT request.
+	Redact    []string                 // Redaction patterns; RedactPatterns if nil.
+	Authorize func(*http.Request) bool // Approves PUT requests; if nil, they are refused.
+
+	mu sync.Mutex // Serializes PUT requests, so that none of them is lost.
+}
+
+// NewHandler returns a handler serving c, and the modified clones of c
+// installed by PUT requests from then on, see Handler. Its Config returns the
+// configuration served.
+func NewHandler(c *ConfigFile) *Handler {
+	var current atomic.Pointer[ConfigFile]
+	current.Store(c)
+	return &Handler{Config: current.Load, Replace: current.Store}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET", "HEAD":
+		h.serveConfig(w, r)
+	case "PUT":
+		h.updateOption(w, r)
+	default:
+		w.Header().Set("Allow", "GET, HEAD, PUT")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *Handler) serveConfig(w http.ResponseWriter, r *http.Request) {
+	patterns := h.Redact
+	if patterns == nil {
+		patterns = RedactPatterns
+	}
+
+	c := h.Config()
+
+	if r.FormValue("format") != "json" && !strings.Contains(r.Header.Get("Accept"), "application/json") {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		io.WriteString(w, c.StringRedacted(patterns...))
+		return
+	}
+
+	sections := c.rawValues()
+	for _, options := range sections {
+		for option, value := range options {
+			if matchAny(patterns, option) || c.isSecret(value) {
+				options[option] = "********"
+			}
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sections)
+}
+
+func (h *Handler) updateOption(w http.ResponseWriter, r *http.Request) {
+	if h.Authorize == nil || h.Replace == nil {
+		http.Error(w, "updates not enabled", http.StatusMethodNotAllowed)
+		return
+	}
+	if !h.Authorize(r) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	section, option := r.URL.Query().Get("section"), r.URL.Query().Get("option")
+	if option == "" {
+		http.Error(w, "missing option parameter", http.StatusBadRequest)
+		return
+	}
+	value, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	c := h.Config().Clone()
+	if err = c.SetOption(section, option, strings.TrimSpace(string(value))); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	h.Replace(c)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// rawValues returns the raw values of the options of the configuration by
+// section, including defaults.
+func (c *ConfigFile) rawValues() map[string]map[string]string {
+	sections := make(map[string]map[string]string, len(c.data))
+	for section, defaults := range c.defaults {
+		sections[section] = maps.Clone(defaults)
+	}
+	for section, sectionmap := range c.data {
+		if sections[section] == nil {
+			sections[section] = make(map[string]string, sectionmap.len())
+		}
+		for _, option := range sectionmap.keys() {
+			sections[section][option], _ = sectionmap.get(option)
+		}
+	}
+
+	return sections
+}
@@ -0,0 +1,74 @@
+package conf
+
+import (
+	"strings"
+	"time"
+)
+
+// HeaderOptions composes the header of generated files, which WriteConfigFile
+// and the other functions writing files take as a string:
+//
+//	header := conf.HeaderOptions{
+//		Generator: "app-setup",
+//		Template:  "templates/app.conf.tmpl",
+//		Time:      time.Now(),
+//		DoNotEdit: true,
+//	}.String()
+//	err := c.WriteConfigFile("/etc/app.conf", 0644, header)
+//
+// writes
+//
+//	# DO NOT EDIT: this file is generated, changes will be overwritten.
+//	# Generated by app-setup from templates/app.conf.tmpl at 2006-01-02T15:04:05Z.
+type HeaderOptions struct {
+	Generator string    // Name of the program generating the file, if any.
+	Template  string    // Source the file is generated from, if any.
+	Time      time.Time // When the file is generated; the zero time leaves it out.
+	DoNotEdit bool      // Whether to warn that changes to the file will be lost.
+	Text      string    // Further text, which may span several lines.
+}
+
+// String returns the text of the header, whose lines are written as comments.
+func (h HeaderOptions) String() string {
+	var lines []string
+	if h.DoNotEdit {
+		lines = append(lines, "DO NOT EDIT: this file is generated, changes will be overwritten.")
+	}
+	if h.Generator != "" || h.Template != "" || !h.Time.IsZero() {
+		generated := "Generated"
+		if h.Generator != "" {
+			generated += " by " + h.Generator
+		}
+		if h.Template != "" {
+			generated += " from " + h.Template
+		}
+		if !h.Time.IsZero() {
+			generated += " at " + h.Time.Format(time.RFC3339)
+		}
+		lines = append(lines, generated+".")
+	}
+	if h.Text != "" {
+		lines = append(lines, h.Text)
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// formatHeader returns the header as written before the sections, every line
+// commented out by the first of the CommentPrefixes of the dialect.
+func (d Dialect) formatHeader(header string) string {
+	prefix := "#"
+	if len(d.CommentPrefixes) > 0 {
+		prefix = d.CommentPrefixes[0]
+	}
+
+	var b strings.Builder
+	for _, line := range strings.Split(strings.TrimRight(header, "\r\n"), "\n") {
+		if line = strings.TrimRight(line, " \t\r"); line == "" {
+			b.WriteString(prefix + "\n")
+		} else {
+			b.WriteString(prefix + " " + line + "\n")
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,170 @@
+package conf
+
+import (
+	"bytes"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// Keys returns the keys of the options of the schema, of the form
+// "section.option" as BindFlags and RegisterFlags use them, those of the
+// default section without "section.", in the order of their sections.
+func (s *Schema) Keys() []string {
+	var keys []string
+	names, specs := s.sections()
+	for _, section := range names {
+		for _, spec := range specs[section] {
+			keys = append(keys, specKey(section, spec))
+		}
+	}
+	return keys
+}
+
+// specKey returns the key of the option declared by spec in the lower-case section.
+func specKey(section string, spec OptionSpec) string {
+	if section == DefaultSection {
+		return foldCase(spec.Option)
+	}
+	return section + "." + foldCase(spec.Option)
+}
+
+// specValues returns the values the option declared by spec may take, if
+// they are known.
+func specValues(spec OptionSpec) []string {
+	switch {
+	case len(spec.Allowed) > 0:
+		return spec.Allowed
+	case spec.Type == BoolType:
+		return []string{"true", "false"}
+	}
+	return nil
+}
+
+// WriteHelp writes a listing of the options of the schema by key, see Keys,
+// with their types, descriptions and constraints, in the format of
+// flag.PrintDefaults, e.g. for the usage message of a program accepting
+// options as "-set key=value":
+//
+//	service-1.port int
+//	  	Port to listen on.
+//	  	(required; range 1 to 65535)
+func (s *Schema) WriteHelp(w io.Writer) error {
+	buf := bytes.NewBuffer(nil)
+
+	names, specs := s.sections()
+	for _, section := range names {
+		for _, spec := range specs[section] {
+			buf.WriteString("  " + specKey(section, spec) + " " + spec.Type.String() + "\n")
+			for _, line := range strings.Split(spec.Description, "\n") {
+				if line != "" {
+					buf.WriteString("    \t" + line + "\n")
+				}
+			}
+			if phrases := spec.constraints()[1:]; len(phrases) > 0 { // without the type
+				buf.WriteString("    \t(" + strings.Join(phrases, "; ") + ")\n")
+			}
+		}
+	}
+
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+// WriteBashCompletion writes a bash script completing arguments of the command
+// of the form "key=value" with the keys of the schema, see Keys, and the values
+// of options with Allowed values or of type bool. The script is meant to be
+// sourced, e.g. from /etc/bash_completion.d; other arguments complete as file
+// names.
+func (s *Schema) WriteBashCompletion(w io.Writer, command string) error {
+	buf := bytes.NewBuffer(nil)
+	fn := "_" + shellName(command) + "_conf"
+
+	buf.WriteString("# bash completion for " + command + ", generated from its configuration schema\n")
+	buf.WriteString(fn + "() {\n")
+	buf.WriteString("\tlocal cur=${COMP_LINE:0:COMP_POINT}\n")
+	buf.WriteString("\tcur=${cur##*[[:space:]]}\n")
+	buf.WriteString("\tlocal key=${cur%%=*} prefix=\n")
+	buf.WriteString("\t[[ $COMP_WORDBREAKS == *=* ]] || prefix=$key=\n")
+	buf.WriteString("\tcase $cur in\n")
+	buf.WriteString("\t*=*)\n")
+	buf.WriteString("\t\tcase $key in\n")
+	names, specs := s.sections()
+	for _, section := range names {
+		for _, spec := range specs[section] {
+			if values := specValues(spec); values != nil {
+				buf.WriteString("\t\t" + shellQuote(specKey(section, spec)) + `) COMPREPLY=($(compgen -P "$prefix" -W ` +
+					shellQuote(strings.Join(values, " ")) + ` -- "${cur#*=}")) ;;` + "\n")
+			}
+		}
+	}
+	buf.WriteString("\t\t*) COMPREPLY=() ;;\n")
+	buf.WriteString("\t\tesac ;;\n")
+	buf.WriteString("\t*)\n")
+	buf.WriteString("\t\tcompopt -o nospace 2>/dev/null\n")
+	buf.WriteString("\t\tCOMPREPLY=($(compgen -S = -W " + shellQuote(strings.Join(s.Keys(), " ")) + ` -- "$cur")) ;;` + "\n")
+	buf.WriteString("\tesac\n")
+	buf.WriteString("}\n")
+	buf.WriteString("complete -o default -F " + fn + " " + shellQuote(command) + "\n")
+
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+// WriteZshCompletion writes a zsh completion function for the command, as
+// WriteBashCompletion does for bash, offering the first lines of the
+// descriptions of the options along with their keys. The script is meant to
+// be saved as _command in a directory of $fpath.
+func (s *Schema) WriteZshCompletion(w io.Writer, command string) error {
+	buf := bytes.NewBuffer(nil)
+
+	buf.WriteString("#compdef " + command + "\n")
+	buf.WriteString("# zsh completion for " + command + ", generated from its configuration schema\n\n")
+	buf.WriteString("local -a keys\n")
+	buf.WriteString("keys=(\n")
+	names, specs := s.sections()
+	for _, section := range names {
+		for _, spec := range specs[section] {
+			item := strings.ReplaceAll(specKey(section, spec), ":", `\:`)
+			if description, _, _ := strings.Cut(spec.Description, "\n"); description != "" {
+				item += ":" + description
+			}
+			buf.WriteString("\t" + shellQuote(item) + "\n")
+		}
+	}
+	buf.WriteString(")\n")
+	buf.WriteString("if compset -P 1 '*='; then\n")
+	buf.WriteString("\tcase ${IPREFIX%=} in\n")
+	for _, section := range names {
+		for _, spec := range specs[section] {
+			if values := specValues(spec); values != nil {
+				quoted := make([]string, len(values))
+				for i, value := range values {
+					quoted[i] = shellQuote(value)
+				}
+				buf.WriteString("\t" + shellQuote(specKey(section, spec)) + ") compadd -- " + strings.Join(quoted, " ") + " ;;\n")
+			}
+		}
+	}
+	buf.WriteString("\t*) _files ;;\n")
+	buf.WriteString("\tesac\n")
+	buf.WriteString("else\n")
+	buf.WriteString("\t_describe -t keys 'configuration option' keys -S = || _files\n")
+	buf.WriteString("fi\n")
+
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+// nonShellName matches the characters not allowed in the names of shell functions.
+var nonShellName = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// shellName returns the name of the command usable in the names of shell functions.
+func shellName(command string) string {
+	return nonShellName.ReplaceAllString(command, "_")
+}
+
+// shellQuote returns the string quoted for the shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,97 @@
+package conf
+
+import (
+	"reflect"
+)
+
+// history holds the states of a configuration for Undo and Redo.
+type history struct {
+	depth     int         // Maximum number of states kept for Undo.
+	current   *Snapshot   // The state after the last modification.
+	undo      []*Snapshot // Earlier states, oldest first.
+	redo      []*Snapshot // Undone states, most recently undone last.
+	restoring bool        // Whether Undo or Redo is modifying the configuration.
+}
+
+// SetHistory enables an edit history of the given depth, so that up to depth
+// modifications of the sections and options of the configuration can be
+// reverted with Undo. Modifications made by Read or a committed transaction
+// are reverted at once. A depth of 0 disables the history and drops it.
+//
+// Every modification saves a copy of the configuration, so the history is
+// best suited to interactive editing of configurations of moderate size.
+func (c *ConfigFile) SetHistory(depth int) {
+	if depth <= 0 {
+		c.history = nil
+		return
+	}
+
+	if c.history == nil {
+		c.history = &history{current: c.Snapshot()}
+	}
+	c.history.depth = depth
+	c.history.trim()
+}
+
+// Undo reverts the last modification not undone yet.
+// It returns false if there is none, or the history is disabled.
+func (c *ConfigFile) Undo() bool {
+	h := c.history
+	if h == nil || len(h.undo) == 0 {
+		return false
+	}
+
+	h.redo = append(h.redo, h.current)
+	h.current = h.undo[len(h.undo)-1]
+	h.undo = h.undo[:len(h.undo)-1]
+	c.restoreHistory()
+
+	return true
+}
+
+// Redo repeats the last modification reverted by Undo, unless the
+// configuration has been modified since. It returns false if there is none.
+func (c *ConfigFile) Redo() bool {
+	h := c.history
+	if h == nil || len(h.redo) == 0 {
+		return false
+	}
+
+	h.undo = append(h.undo, h.current)
+	h.current = h.redo[len(h.redo)-1]
+	h.redo = h.redo[:len(h.redo)-1]
+	c.restoreHistory()
+
+	return true
+}
+
+// restoreHistory restores the current state of the history.
+func (c *ConfigFile) restoreHistory() {
+	c.history.restoring = true
+	c.Restore(c.history.current)
+	c.history.restoring = false
+}
+
+// record adds the state after a modification to the history.
+func (c *ConfigFile) record() {
+	h := c.history
+	if h == nil || h.restoring {
+		return
+	}
+
+	s := c.Snapshot()
+	if reflect.DeepEqual(s, h.current) {
+		return // e.g. a setting changed, but no option
+	}
+	h.undo = append(h.undo, h.current)
+	h.current = s
+	h.redo = nil
+	h.trim()
+}
+
+// trim drops the oldest states beyond the depth of the history.
+func (h *history) trim() {
+	if n := len(h.undo) - h.depth; n > 0 {
+		h.undo = append(h.undo[:0], h.undo[n:]...)
+	}
+}
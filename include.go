@@ -0,0 +1,136 @@
+package conf
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// maxIncludeDepth is the depth of included files at which reading gives up, as
+// git does.
+const maxIncludeDepth = 10
+
+// includeDirective returns the name and argument of an include directive on
+// the trimmed line, see Dialect.Includes, or false if the line is none.
+func (d Dialect) includeDirective(l []byte) (name string, arg string, ok bool) {
+	i := bytes.IndexAny(l, " \t")
+	if i < 0 {
+		return "", "", false
+	}
+	rest := l[i:]
+	if d.InlineComments == SpacedInlineComments {
+		rest = stripComments(rest, d.commentChars())
+	}
+	name, arg = string(l[:i]), string(bytes.TrimSpace(rest))
+	if name != "include" && name != "include-if-exists" && name != "include-env" {
+		return "", "", false
+	}
+	if arg == "" || strings.IndexByte(d.Delimiters, arg[0]) >= 0 {
+		return "", "", false // an option named like a directive
+	}
+	return name, arg, true
+}
+
+// includeDirective reads the files an include directive read from fname names.
+func (c *ConfigFile) includeDirective(name string, arg string, fname string) error {
+	switch name {
+	case "include-if-exists":
+		return c.include(arg, fname, true)
+	case "include-env":
+		if path := os.Getenv(arg); path != "" {
+			return c.include(path, fname, true)
+		}
+		return nil
+	}
+	return c.include(arg, fname, false)
+}
+
+// Included returns the files included by include directives, see
+// Dialect.Includes, and by include.path options in git mode, in the order they
+// were read.
+func (c *ConfigFile) Included() []string {
+	return append([]string(nil), c.included...)
+}
+
+// include reads the files named by the path of an include directive or an
+// include.path option read from fname. Unless optional, a missing file is an
+// error, while a pattern matching no file is not.
+func (c *ConfigFile) include(path string, fname string, optional bool) error {
+	if c.noIncludes {
+		return ReadError{IncludeRefused, path}
+	}
+	if strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			path = filepath.Join(home, path[2:])
+		}
+	} else if !filepath.IsAbs(path) {
+		path = filepath.Join(filepath.Dir(fname), path)
+	}
+
+	paths := []string{path}
+	if strings.ContainsAny(path, "*?[") {
+		var err error
+		if paths, err = filepath.Glob(path); err != nil {
+			return ReadError{CouldNotParse, path}
+		}
+		sort.Strings(paths)
+		optional = true
+	}
+
+	for _, path := range paths {
+		if err := c.includeFile(path, fname, optional); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// includeFile reads an included file, starting in the default section except
+// in Python and git mode, as Read does.
+func (c *ConfigFile) includeFile(path string, fname string, optional bool) (err error) {
+	chain := c.including
+	if len(chain) == 0 {
+		chain = []string{absPath(fname)} // the file including the others
+	}
+	if len(chain) > maxIncludeDepth {
+		return ReadError{LimitExceeded, "10 levels of included files"}
+	}
+	if slices.Contains(chain, absPath(path)) {
+		return ReadError{IncludeCycle, path}
+	}
+
+	file, err := os.Open(path)
+	if optional && errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	defer wrapReadError(path, &err)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	c.included = append(c.included, path)
+	saved := c.including
+	c.including = append(chain, absPath(path))
+	defer func() { c.including = saved }()
+
+	section := "default"
+	if c.dialect.syntax == pythonSyntax || c.dialect.syntax == gitSyntax {
+		section = ""
+	}
+	return c.parse(file, path, section, 0)
+}
+
+// absPath returns the absolute form of the path, or the path itself if it has none.
+func absPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
@@ -0,0 +1,136 @@
+package conf
+
+import (
+	"strings"
+)
+
+// Kinds of placeholders.
+const (
+	placeholderRef     = iota // References an option or builtin.
+	placeholderCommand        // A command to substitute.
+	placeholderEscape         // $$ or %%, an escaped dollar or percent sign.
+	placeholderInvalid        // A percent sign starting no placeholder, in Python mode.
+)
+
+// placeholder is a placeholder found in a value by nextPlaceholder.
+type placeholder struct {
+	start, end int    // The placeholder is value[start:end].
+	kind       int    // One of the placeholder kinds.
+	name       string // The reference, including any argument, or the command.
+	hasArg     bool   // Whether the reference continues with a builtin's argument.
+}
+
+// nextPlaceholder returns the first placeholder of value starting at or after
+// from, in the syntax selected with SetInterpolation and SetCommandSubstitution:
+//
+//	%(option)s %(builtin:arg)s                      BasicInterpolation
+//	${option} ${section:option} ${builtin:arg} $$   ExtendedInterpolation
+//	$(command args)                                 with command substitution
+//
+// Option names consist of letters, digits and the characters "_", "." and "-".
+// In Python mode, %% is an escaped percent sign and other percent signs are
+// invalid. It returns false if there are no more placeholders.
+func (c *ConfigFile) nextPlaceholder(value string, from int) (p placeholder, ok bool) {
+	for i := from; i < len(value); i++ {
+		switch value[i] {
+		case '%':
+			if c.dialect.Interpolation == BasicInterpolation {
+				if p, ok = scanBasic(value, i); ok {
+					return p, true
+				}
+				if c.dialect.syntax == pythonSyntax && strings.HasPrefix(value[i+1:], "%") {
+					return placeholder{i, i + 2, placeholderEscape, "", false}, true
+				}
+				if c.dialect.syntax == pythonSyntax {
+					return placeholder{i, i + 1, placeholderInvalid, "", false}, true
+				}
+			}
+		case '$':
+			if c.dialect.Interpolation == ExtendedInterpolation {
+				if p, ok = scanExtended(value, i); ok {
+					return p, true
+				}
+			}
+			if c.commands {
+				if p, ok = scanCommand(value, i); ok {
+					return p, true
+				}
+			}
+		}
+	}
+
+	return placeholder{}, false
+}
+
+// scanBasic scans %(name)s or %(name:arg)s at value[i].
+func scanBasic(value string, i int) (p placeholder, ok bool) {
+	if !strings.HasPrefix(value[i+1:], "(") {
+		return p, false
+	}
+	start := i + 2
+	end := scanName(value, start)
+	if end == start {
+		return p, false
+	}
+	hasArg := end < len(value) && value[end] == ':'
+	if hasArg {
+		n := strings.IndexByte(value[end:], ')')
+		if n < 0 {
+			return p, false
+		}
+		end += n
+	}
+	if !strings.HasPrefix(value[end:], ")s") {
+		return p, false
+	}
+
+	return placeholder{i, end + 2, placeholderRef, value[start:end], hasArg}, true
+}
+
+// scanExtended scans ${name}, ${section:name}, ${name:arg} or $$ at value[i].
+func scanExtended(value string, i int) (p placeholder, ok bool) {
+	switch {
+	case strings.HasPrefix(value[i+1:], "$"):
+		return placeholder{i, i + 2, placeholderEscape, "", false}, true
+	case !strings.HasPrefix(value[i+1:], "{"):
+		return p, false
+	}
+
+	start := i + 2
+	ref := scanName(value, start)
+	if ref < len(value) && value[ref] == ':' {
+		ref = scanName(value, ref+1)
+	}
+	n := strings.IndexByte(value[ref:], '}')
+	if n < 0 {
+		return p, false
+	}
+	end := ref + n
+
+	return placeholder{i, end + 1, placeholderRef, value[start:end], end > ref}, true
+}
+
+// scanCommand scans $(command) at value[i].
+func scanCommand(value string, i int) (p placeholder, ok bool) {
+	if !strings.HasPrefix(value[i+1:], "(") {
+		return p, false
+	}
+	n := strings.IndexByte(value[i+2:], ')')
+	if n < 0 {
+		return p, false
+	}
+
+	return placeholder{i, i + 2 + n + 1, placeholderCommand, value[i+2 : i+2+n], false}, true
+}
+
+// scanName returns the end of the option name starting at value[i].
+func scanName(value string, i int) int {
+	for i < len(value) && isNameChar(value[i]) {
+		i++
+	}
+	return i
+}
+
+func isNameChar(b byte) bool {
+	return 'a' <= b && b <= 'z' || 'A' <= b && b <= 'Z' || '0' <= b && b <= '9' || b == '_' || b == '.' || b == '-'
+}
@@ -0,0 +1,56 @@
+package conf
+
+import (
+	"encoding/json"
+	"sort"
+)
+
+// MarshalJSON encodes the configuration as a JSON object mapping section names
+// to objects mapping option names to raw values.
+func (c *ConfigFile) MarshalJSON() ([]byte, error) {
+	sections := make(map[string]map[string]string, len(c.data))
+	for section, sectionmap := range c.data {
+		sections[section] = make(map[string]string, sectionmap.len())
+		for _, option := range sectionmap.keys() {
+			sections[section][option] = sectionmap.values[option]
+		}
+	}
+
+	return json.Marshal(sections)
+}
+
+// UnmarshalJSON adds the sections and options of a JSON object as produced by
+// MarshalJSON to the configuration.
+func (c *ConfigFile) UnmarshalJSON(data []byte) error {
+	var sections map[string]map[string]string
+	if err := json.Unmarshal(data, &sections); err != nil {
+		return err
+	}
+
+	if c.data == nil { // zero ConfigFile, e.g. a field of a struct being decoded
+		c.data = make(map[string]*section)
+		c.AddSection(DefaultSection)
+	}
+	c.beginBatch()
+	defer c.endBatch()
+	names := make([]string, 0, len(sections))
+	for section := range sections {
+		names = append(names, section)
+	}
+	sort.Strings(names) // JSON objects are unordered
+	for _, section := range names {
+		c.AddSection(section)
+		options := make([]string, 0, len(sections[section]))
+		for option := range sections[section] {
+			options = append(options, option)
+		}
+		sort.Strings(options)
+		for _, option := range options {
+			if err := c.SetOption(section, option, sections[section][option]); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,45 @@
+package conf
+
+// Key is a handle on an option, for reading it on hot paths such as request
+// handlers. Its section and option names are normalized once by ConfigFile.Key;
+// reading a value already unfolded by an earlier read neither lowercases the
+// names nor allocates. A key always reads the current value of the option,
+// following modifications of the configuration.
+type Key struct {
+	c   *ConfigFile
+	key cacheKey
+}
+
+// Key returns a handle on the option in the section. The option need not exist yet.
+func (c *ConfigFile) Key(section string, option string) Key {
+	if section == "" {
+		section = "default"
+	}
+
+	return Key{c, cacheKey{c.foldSection(section), c.foldOption(option)}}
+}
+
+// String has the same behaviour as GetString.
+func (k Key) String() (value string, err error) {
+	return k.c.getString(k.key)
+}
+
+// Int has the same behaviour as GetInt.
+func (k Key) Int() (value int, err error) {
+	sv, err := k.c.getString(k.key)
+	if err != nil {
+		return 0, err
+	}
+
+	return k.c.parseInt(sv, k.key.section, k.key.option)
+}
+
+// Bool has the same behaviour as GetBool.
+func (k Key) Bool() (value bool, err error) {
+	sv, err := k.c.getString(k.key)
+	if err != nil {
+		return false, err
+	}
+
+	return parseBool(sv, k.key.section, k.key.option)
+}
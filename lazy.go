@@ -0,0 +1,160 @@
+package conf
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// SetLazy enables or disables the lazy reading of sections by Read, for large
+// machine-generated configurations of which a process only uses a few sections.
+// Read then only checks the syntax of its input and indexes the sections; the
+// options of a section are parsed when the section is first accessed. The input
+// is read into memory at once and kept until all its sections are parsed.
+//
+// Options read lazily are neither checked by validators nor by protections, and
+// Lint does not report their redefinitions. Lazy reading is disabled by default,
+// and in document mode.
+func (c *ConfigFile) SetLazy(enabled bool) {
+	c.lazy = enabled
+}
+
+// pending holds the text of a section read lazily until it is parsed.
+type pending struct {
+	once      sync.Once
+	section   string              // Lower-case name of the section.
+	fname     string              // Name of the file read, if any.
+	interning bool                // Whether to intern names and values, see SetInterning.
+	normalize func(string) string // Folds option names, see SetOptionNormalizer.
+	bodies    []pendingBody       // Text following each header of the section.
+}
+
+type pendingBody struct {
+	text []byte
+	line int // Line of the header, or 0 for the text before the first header.
+}
+
+// readLazy implements read in lazy mode, see SetLazy.
+func (c *ConfigFile) readLazy(reader io.Reader, fname string) error {
+	data, err := io.ReadAll(c.limits.limitReader(reader))
+	if err != nil {
+		return err
+	}
+	if err = exceeded(len(data), c.limits.MaxSize, "MaxSize"); err != nil {
+		return err
+	}
+
+	c.beginBatch()
+	defer c.endBatch()
+
+	pendings := make(map[string]*pending)
+	err = splitSections(data, c.limits, func(section string, text []byte, line int) {
+		c.AddSection(section)
+		p := pendings[section]
+		if p == nil {
+			p = &pending{section: section, fname: fname, interning: c.interning, normalize: c.normalize}
+			pendings[section] = p
+		}
+		p.bodies = append(p.bodies, pendingBody{text, line})
+	})
+	if err != nil {
+		return err
+	}
+
+	for name, p := range pendings {
+		c.mutableSection(name).pending = p // parses what an earlier Read left pending
+	}
+	c.debugf("%s: indexed %d sections for lazy parsing", Location{fname, 0}, len(pendings))
+
+	return nil
+}
+
+// splitSections checks the syntax of data and the limits of lines, sections and
+// options as parse does, and calls fn in order with the lower-case name and the
+// text of each section, starting with the text before the first header, which
+// belongs to the default section. line is the line of the header, or 0 for the
+// default section.
+func splitSections(data []byte, limits Limits, fn func(section string, text []byte, line int)) error {
+	section, start, header := DefaultSection, 0, 0
+	option := false // whether a line can continue the value of an option
+	line, sections, options := 0, 0, 0
+	for off := 0; off < len(data); {
+		next := len(data)
+		if i := bytes.IndexByte(data[off:], '\n'); i >= 0 {
+			next = off + i + 1
+		}
+		l := bytes.TrimSpace(data[off:next])
+		line++
+		if err := exceeded(len(bytes.TrimRight(data[off:next], "\r\n")), limits.MaxLineLength, "MaxLineLength"); err != nil {
+			return err
+		}
+
+		// the same syntax as accepted by parse
+		switch {
+		case len(l) == 0 || l[0] == '#' || l[0] == ';':
+		case len(l) >= 3 && bytes.EqualFold(l[0:3], []byte("rem")):
+		case l[0] == '[' && l[len(l)-1] == ']':
+			sections++
+			if err := exceeded(sections, limits.MaxSections, "MaxSections"); err != nil {
+				return err
+			}
+			fn(section, data[start:off], header)
+			section = foldCase(string(bytes.TrimSpace(l[1 : len(l)-1])))
+			start, header, option = next, line, false
+		case section == "":
+			return ReadError{BlankSection, string(l)}
+		case DefaultDialect.optionEnd(l) > 0:
+			options++
+			if err := exceeded(options, limits.MaxOptions, "MaxOptions"); err != nil {
+				return err
+			}
+			option = true
+		case !option:
+			return ReadError{CouldNotParse, string(l)}
+		}
+		off = next
+	}
+	fn(section, data[start:], header)
+
+	return nil
+}
+
+// load parses the text of a section read lazily, unless it has been parsed.
+// It is safe to call concurrently, as the lookups of a configuration are.
+func (s *section) load() {
+	if s == nil || s.pending == nil {
+		return
+	}
+
+	p := s.pending
+	p.once.Do(func() {
+		parsed, _ := parseSection(p.section, p.bodies, p.fname, p.interning, p.normalize)
+		for _, option := range parsed.keys() {
+			if _, ok := s.values[option]; !ok {
+				s.options = append(s.options, option)
+			}
+			s.values[option] = parsed.values[option]
+			if loc, ok := parsed.location(option); ok {
+				if s.locations == nil {
+					s.locations = make(map[string]Location)
+				}
+				s.locations[option] = loc
+			}
+		}
+		p.bodies = nil
+	})
+}
+
+// parseSection parses the text of the section, whose syntax has been checked by
+// splitSections, folding option names with normalize if it is not nil. It also
+// returns where options were redefined.
+func parseSection(name string, bodies []pendingBody, fname string, interning bool, normalize func(string) string) (s *section, redefined []Location) {
+	t := NewConfigFile()
+	t.interning = interning
+	t.normalize = normalize
+	for _, b := range bodies {
+		t.parse(bytes.NewReader(b.text), fname, name, b.line)
+	}
+
+	return t.data[name], t.redefined
+}
@@ -0,0 +1,68 @@
+package conf
+
+import (
+	"io"
+)
+
+// Limits restricts the input accepted by Read and the values unfolded by
+// GetString, for configurations read from untrusted sources. Zero fields
+// impose no limit. Exceeding a limit is reported as a ReadError or GetError
+// with the reason LimitExceeded.
+type Limits struct {
+	MaxSize        int // Most bytes Read reads.
+	MaxLineLength  int // Longest line Read accepts, in bytes, without its terminator.
+	MaxSections    int // Most section headers Read accepts.
+	MaxOptions     int // Most option definitions Read accepts.
+	MaxValueLength int // Longest value GetString unfolds, in bytes.
+}
+
+// HardenedLimits are the limits set by HardenedRead, generous for configurations
+// written by hand but preventing untrusted input from exhausting memory.
+var HardenedLimits = Limits{
+	MaxSize:        16 << 20,
+	MaxLineLength:  64 << 10,
+	MaxSections:    10000,
+	MaxOptions:     100000,
+	MaxValueLength: 1 << 20,
+}
+
+// SetLimits sets the limits of the input read and the values unfolded from now on.
+func (c *ConfigFile) SetLimits(limits Limits) {
+	c.limits = limits
+	c.changed()
+}
+
+// HardenedRead reads a configuration from an untrusted source with
+// HardenedLimits, which the configuration keeps for GetString. Includes of
+// the dialect is disabled, so that the input cannot read local files: include
+// directives and include.path options are read as in dialects without it.
+// Other features
+// unsafe for untrusted input, such as command substitution, are disabled by
+// default and must stay so.
+func HardenedRead(reader io.Reader, dialect ...Dialect) (*ConfigFile, error) {
+	c := newConfigFile(dialect)
+	c.dialect.Includes = false
+	c.SetLimits(HardenedLimits)
+	if err := c.Read(reader); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// limitReader returns reader, limited to one byte more than MaxSize so that
+// exceeding it can be detected by exceeded.
+func (l Limits) limitReader(reader io.Reader) io.Reader {
+	if l.MaxSize <= 0 {
+		return reader
+	}
+	return io.LimitReader(reader, int64(l.MaxSize)+1)
+}
+
+// exceeded returns a ReadError if n exceeds max, naming the limit, unless max is 0.
+func exceeded(n int, max int, limit string) error {
+	if max > 0 && n > max {
+		return ReadError{LimitExceeded, limit}
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package conf
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// LintRule selects a check made by Lint. Rules can be combined with |.
+type LintRule int
+
+const (
+	// LintDuplicates flags options defined more than once in a section, including
+	// names which differ only by case. Only the last definition takes effect.
+	LintDuplicates LintRule = 1 << iota
+
+	// LintEmptyValues flags options with empty values.
+	LintEmptyValues
+
+	// LintSimilarNames flags options of a section whose names differ only by
+	// hyphens and underscores, such as max-clients and max_clients.
+	LintSimilarNames
+
+	// LintEmptySections flags sections without options.
+	LintEmptySections
+
+	// LintUnreferencedDefaults flags options of the default section which are
+	// not referenced by any placeholder.
+	LintUnreferencedDefaults
+
+	LintAll = LintDuplicates | LintEmptyValues | LintSimilarNames | LintEmptySections | LintUnreferencedDefaults
+)
+
+// Finding is a problem found by Lint.
+type Finding struct {
+	Rule     LintRule
+	Section  string
+	Option   string   // "" for findings about a section.
+	Location Location // Where the option was read from; Line is 0 if unknown.
+	Message  string
+}
+
+func (f Finding) String() string {
+	if f.Location.Line == 0 {
+		return f.Message
+	}
+	return f.Location.String() + ": " + f.Message
+}
+
+// Lint checks the configuration for the smells selected by rules and returns its
+// findings, ordered by location. Findings without a location come last.
+func Lint(c *ConfigFile, rules LintRule) (findings []Finding) {
+	add := func(rule LintRule, section, option, format string, args ...interface{}) {
+		loc, _ := c.data[section].location(option)
+		findings = append(findings, Finding{rule, section, option, loc, fmt.Sprintf(format, args...)})
+	}
+
+	if rules&LintDuplicates != 0 {
+		for _, loc := range c.redefined {
+			findings = append(findings, Finding{LintDuplicates, "", "", loc, "option redefined, earlier definitions are ignored"})
+		}
+	}
+
+	referenced := make(map[string]bool)
+	for _, section := range c.sections {
+		sectionmap := c.data[section]
+		if rules&LintEmptySections != 0 && sectionmap.len() == 0 && section != DefaultSection {
+			add(LintEmptySections, section, "", "section '%s' has no options", section)
+		}
+
+		similar := make(map[string][]string)
+		for _, option := range sectionmap.keys() {
+			value := sectionmap.values[option]
+			if rules&LintEmptyValues != 0 && value == "" {
+				add(LintEmptyValues, section, option, "option '%s' in section '%s' is empty", option, section)
+			}
+			key := strings.Replace(option, "_", "-", -1)
+			similar[key] = append(similar[key], option)
+
+			for _, ref := range c.references(value) {
+				referenced[ref] = true
+			}
+		}
+
+		if rules&LintSimilarNames != 0 {
+			for _, options := range similar {
+				sort.Strings(options)
+				for _, option := range options[1:] {
+					add(LintSimilarNames, section, option, "option '%s' in section '%s' is easily confused with '%s'", option, section, options[0])
+				}
+			}
+		}
+	}
+
+	if rules&LintUnreferencedDefaults != 0 {
+		for _, option := range c.data[DefaultSection].keys() {
+			if !referenced[option] {
+				add(LintUnreferencedDefaults, DefaultSection, option, "option '%s' in the default section is never referenced", option)
+			}
+		}
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool {
+		a, b := findings[i], findings[j]
+		if (a.Location.Line == 0) != (b.Location.Line == 0) {
+			return b.Location.Line == 0 // findings without location last
+		}
+		if a.Location != b.Location {
+			return a.Location.File < b.Location.File || a.Location.File == b.Location.File && a.Location.Line < b.Location.Line
+		}
+		return a.Section+"."+a.Option < b.Section+"."+b.Option
+	})
+
+	return findings
+}
+
+// references returns the lower-case names of the options referenced by
+// placeholders in the value which may refer to the default section.
+func (c *ConfigFile) references(value string) (options []string) {
+	for p, ok := c.nextPlaceholder(value, 0); ok; p, ok = c.nextPlaceholder(value, p.end) {
+		if p.kind != placeholderRef || p.hasArg {
+			continue
+		}
+		name := c.foldOption(p.name)
+		if i := strings.Index(name, ":"); i >= 0 {
+			name = name[i+1:]
+		}
+		options = append(options, name)
+	}
+
+	return options
+}
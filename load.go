@@ -0,0 +1,56 @@
+package conf
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// loaded caches the configurations read by Load, keyed by absolute path.
+var loaded = struct {
+	sync.Mutex
+	entries map[string]loadedEntry
+}{entries: make(map[string]loadedEntry)}
+
+type loadedEntry struct {
+	modTime time.Time
+	size    int64
+	config  *Snapshot
+}
+
+// Load reads a configuration file as ReadConfigFile does, but caches the result,
+// keyed by the file's absolute path. As long as the file's modification time and
+// size are unchanged, later calls return a copy of the cached configuration instead
+// of parsing the file again. Every call returns a separate copy, which the caller
+// may modify.
+func Load(path string) (*ConfigFile, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := os.Stat(abs)
+	if err != nil {
+		return nil, err
+	}
+
+	loaded.Lock()
+	e, ok := loaded.entries[abs]
+	loaded.Unlock()
+	if ok && e.modTime.Equal(fi.ModTime()) && e.size == fi.Size() {
+		c := NewConfigFile()
+		c.Restore(e.config)
+		return c, nil
+	}
+
+	c, err := ReadConfigFile(abs)
+	if err != nil {
+		return nil, err
+	}
+
+	loaded.Lock()
+	loaded.entries[abs] = loadedEntry{fi.ModTime(), fi.Size(), c.Snapshot()}
+	loaded.Unlock()
+
+	return c, nil
+}
@@ -0,0 +1,69 @@
+package conf
+
+import (
+	"strings"
+)
+
+// SetLocaleNumbers enables or disables the parsing of numbers by GetFloat64 as
+// they are written in many European locales, with a comma as the decimal
+// separator and dots, spaces or apostrophes separating groups of thousands:
+//
+//	price = 1.234,5
+//	limit = 1 000 000,25
+//	ratio = 0,75
+//
+// Values without a comma are parsed as before, so 1.234 remains 1.234, and
+// grouping separators must separate groups of three digits. It is disabled by
+// default, and only numbers as accepted by strconv.ParseFloat are.
+func (c *ConfigFile) SetLocaleNumbers(enabled bool) {
+	c.localeNumbers = enabled
+}
+
+// groupSeparators lists the characters accepted between groups of thousands,
+// including the no-break and narrow no-break spaces.
+const groupSeparators = ". '\u00a0\u202f"
+
+// delocalize returns the number written with a decimal comma as written by
+// strconv.FormatFloat, see SetLocaleNumbers, or sv itself if it is not one.
+func delocalize(sv string) string {
+	i := strings.LastIndexByte(sv, ',')
+	if i < 0 {
+		return sv
+	}
+	integer, fraction := sv[:i], sv[i+1:]
+	sign := ""
+	if len(integer) > 0 && (integer[0] == '-' || integer[0] == '+') {
+		sign, integer = integer[:1], integer[1:]
+	}
+
+	var digits strings.Builder
+	group := -1 // length of the current group after a separator, -1 before the first one
+	for _, r := range integer {
+		switch {
+		case '0' <= r && r <= '9':
+			digits.WriteRune(r)
+			if group >= 0 {
+				group++
+			}
+		case strings.ContainsRune(groupSeparators, r) && digits.Len() > 0 && (group < 0 && digits.Len() <= 3 || group == 3):
+			group = 0
+		default:
+			return sv
+		}
+	}
+	if digits.Len() == 0 || group >= 0 && group != 3 || !isDigits(fraction) {
+		return sv
+	}
+
+	return sign + digits.String() + "." + fraction
+}
+
+// isDigits reports whether s consists of decimal digits only.
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
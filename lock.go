@@ -0,0 +1,96 @@
+package conf
+
+import (
+	"os"
+)
+
+// FileLock is an advisory lock on a configuration file, held across a
+// read-modify-write cycle:
+//
+//	l, err := conf.LockFile("/etc/app.conf")
+//	c, err := conf.ReadConfigFile("/etc/app.conf")
+//	c.AddOption("service-1", "maxclients", "300")
+//	err = c.WriteConfigFile("/etc/app.conf", 0644, "")
+//	l.Unlock()
+//
+// Advisory locks only exclude processes which lock the file as well, such as
+// other users of LockFile, ReadConfigFileLocked and WriteConfigFileLocked.
+type FileLock struct {
+	file *os.File
+}
+
+// LockFile takes an exclusive lock on the file fname, creating it if it does not
+// exist, and blocks until the lock is acquired. While the lock is held, the calling
+// process must not use ReadConfigFileLocked or WriteConfigFileLocked on the file.
+func LockFile(fname string) (*FileLock, error) {
+	file, err := os.OpenFile(fname, os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		return nil, err
+	}
+	if err = lockFile(file, true); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return &FileLock{file}, nil
+}
+
+// Unlock releases the lock.
+func (l *FileLock) Unlock() error {
+	err := unlockFile(l.file)
+	if cerr := l.file.Close(); err == nil {
+		err = cerr
+	}
+
+	return err
+}
+
+// ReadConfigFileLocked reads a file as ReadConfigFile does, while holding a shared
+// lock on it, so that it is not read while another process writes it.
+func ReadConfigFileLocked(fname string, dialect ...Dialect) (c *ConfigFile, err error) {
+	defer wrapReadError(fname, &err)
+
+	file, err := os.Open(fname)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	if err = lockFile(file, false); err != nil {
+		return nil, err
+	}
+	defer unlockFile(file)
+
+	c = newConfigFile(dialect)
+	if err = c.read(file, fname); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// WriteConfigFileLocked saves the configuration to a file as WriteConfigFile does,
+// while holding an exclusive lock on it, so that concurrent writers don't interleave.
+func (c *ConfigFile) WriteConfigFileLocked(fname string, perm uint32, header string, dialect ...Dialect) (err error) {
+	defer wrapWriteError(fname, &err)
+
+	file, err := os.OpenFile(fname, os.O_RDWR|os.O_CREATE, os.FileMode(perm))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err = lockFile(file, true); err != nil {
+		return err
+	}
+	defer unlockFile(file)
+
+	if err = file.Truncate(0); err != nil { // only truncate once the lock is held
+		return err
+	}
+	if err = c.Write(file, header, dialect...); err != nil {
+		return err
+	}
+
+	return file.Sync()
+}
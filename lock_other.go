@@ -0,0 +1,18 @@
+//go:build !unix && !windows
+
+package conf
+
+import (
+	"errors"
+	"os"
+)
+
+var errLockUnsupported = errors.New("file locking is not supported on this platform")
+
+func lockFile(file *os.File, exclusive bool) error {
+	return errLockUnsupported
+}
+
+func unlockFile(file *os.File) error {
+	return errLockUnsupported
+}
@@ -0,0 +1,55 @@
+package conf
+
+// Logger receives debug messages about how a configuration is read and how its
+// values are resolved, see SetLogger. Many logging packages provide loggers
+// with a Debugf method; others can be adapted with LoggerFunc.
+type Logger interface {
+	Debugf(format string, args ...any)
+}
+
+// LoggerFunc adapts a printf-like function to a Logger, e.g.
+//
+//	c.SetLogger(conf.LoggerFunc(log.Printf))
+type LoggerFunc func(format string, args ...any)
+
+func (f LoggerFunc) Debugf(format string, args ...any) {
+	f(format, args...)
+}
+
+// SetLogger sets a logger receiving debug messages reporting the sections and
+// options Read finds, the environment variables and flags overriding options,
+// the placeholders GetString unfolds, and where the values it returns come
+// from, to answer questions such as "why is this value X?". Messages are only
+// formatted if a logger is set; a nil logger disables them.
+func (c *ConfigFile) SetLogger(logger Logger) {
+	c.logger = logger
+}
+
+// debugf passes a message to the logger, if any.
+func (c *ConfigFile) debugf(format string, args ...any) {
+	if c.logger != nil {
+		c.logger.Debugf(format, args...)
+	}
+}
+
+// logBuiltin logs the unfolding of a builtin placeholder.
+func (c *ConfigFile) logBuiltin(section string, option string, placeholder string) {
+	if c.logger != nil {
+		c.debugf("option '%s' in section '%s': %s unfolded as builtin", option, section, placeholder)
+	}
+}
+
+// logValue logs the value GetString returns for the option and where it comes
+// from. Encrypted values and values of options matching RedactPatterns are masked.
+func (c *ConfigFile) logValue(section string, option string, value string) {
+	if raw, _ := c.rawString(section, option); c.isSecret(raw) || matchAny(RedactPatterns, option) {
+		value = "********"
+	}
+	source := "a default"
+	if loc, ok := c.Source(section, option); ok {
+		source = loc.String()
+	} else if _, ok := c.defaults[section][option]; !ok {
+		source = "an unknown location"
+	}
+	c.debugf("option '%s' in section '%s' is %q, from %s", option, section, value, source)
+}
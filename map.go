@@ -0,0 +1,69 @@
+package conf
+
+import (
+	"errors"
+	"sort"
+)
+
+// GetIntMap converts all options of the section to int as GetInt does and
+// returns them keyed by option name, e.g. for a lookup table like
+//
+//	[quotas]
+//	alice = 100
+//	bob = 250
+//
+// Options of the default section are not included. If any option cannot be
+// converted, it returns an error joining the errors of all such options.
+func (c *ConfigFile) GetIntMap(section string) (values map[string]int, err error) {
+	values = make(map[string]int)
+	err = c.forEachOption(section, func(option string) (err error) {
+		values[option], err = c.GetInt(section, option)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return values, nil
+}
+
+// GetBoolMap converts all options of the section to bool as GetBool does and
+// returns them keyed by option name. Options of the default section are not
+// included. If any option cannot be converted, it returns an error joining the
+// errors of all such options.
+func (c *ConfigFile) GetBoolMap(section string) (values map[string]bool, err error) {
+	values = make(map[string]bool)
+	err = c.forEachOption(section, func(option string) (err error) {
+		values[option], err = c.GetBool(section, option)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return values, nil
+}
+
+// forEachOption calls fn with every option of the section in sorted order and
+// returns the errors it returned joined.
+func (c *ConfigFile) forEachOption(section string, fn func(option string) error) error {
+	if section == "" {
+		section = "default"
+	}
+	options, ok := c.data[c.foldSection(section)]
+	if !ok {
+		return GetError{SectionNotFound, "", "", c.foldSection(section), "", nil}
+	}
+
+	names := append([]string(nil), options.keys()...)
+	sort.Strings(names)
+
+	var errs []error
+	for _, option := range names {
+		if err := fn(option); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
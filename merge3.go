@@ -0,0 +1,96 @@
+package conf
+
+// Conflict describes an option which both sides of Merge3 changed differently.
+type Conflict struct {
+	Section string
+	Option  string
+	Base    string // Raw value of the old default, "" if it lacks the option.
+	Ours    string // Raw value of the edited configuration, which Merge3 keeps.
+	Theirs  string // Raw value of the new default, "" if it lacks the option.
+}
+
+// Merge3 merges ours, a configuration edited from the old default base, with
+// theirs, the new default, as package upgrades do with configuration files
+// edited by their users. Options only one side changed, added or removed take
+// the value of that side; options both sides changed differently keep the
+// value of ours and are reported as conflicts, in the order of the sections
+// and options of ours followed by those new in theirs. Sections are added and
+// removed in the same way. The merged configuration is a clone of ours, see
+// Clone, so it keeps its order of sections and options, and in document mode
+// its comments; new options and sections are appended.
+func Merge3(base, ours, theirs *ConfigFile) (merged *ConfigFile, conflicts []Conflict) {
+	merged = ours.Clone()
+	merged.beginBatch()
+	defer merged.endBatch()
+
+	for _, section := range unionSections(ours, theirs, base) {
+		b, inBase := base.data[section]
+		o, inOurs := ours.data[section]
+		t, inTheirs := theirs.data[section]
+		keep := inOurs
+		if inOurs == inBase {
+			keep = inTheirs
+		}
+		if keep && !inOurs {
+			merged.AddSection(section)
+		}
+
+		for _, option := range unionOptions(o, t, b) {
+			bv, bok := b.get(option)
+			ov, ook := o.get(option)
+			tv, tok := t.get(option)
+			switch {
+			case ook == tok && ov == tv, tok == bok && tv == bv:
+				continue // ours already has the result
+			case ook == bok && ov == bv && !tok:
+				merged.RemoveOption(section, option)
+				continue
+			case ook == bok && ov == bv:
+				if merged.SetOption(section, option, tv) == nil {
+					continue
+				}
+			}
+			conflicts = append(conflicts, Conflict{section, option, bv, ov, tv})
+			keep = true
+		}
+
+		if !keep && inOurs {
+			merged.RemoveSection(section)
+		}
+	}
+
+	return merged, conflicts
+}
+
+// unionSections returns the names of the sections of the configurations, in
+// the order of the first configuration having them.
+func unionSections(configs ...*ConfigFile) (names []string) {
+	seen := make(map[string]bool)
+	for _, c := range configs {
+		for _, section := range c.sections {
+			if !seen[section] {
+				seen[section] = true
+				names = append(names, section)
+			}
+		}
+	}
+	return names
+}
+
+// unionOptions returns the names of the options of the sections, any of which
+// may be nil, in the order of the first section having them.
+func unionOptions(sections ...*section) (names []string) {
+	seen := make(map[string]bool)
+	for _, s := range sections {
+		if s == nil {
+			continue
+		}
+		for _, option := range s.keys() {
+			if !seen[option] {
+				seen[option] = true
+				names = append(names, option)
+			}
+		}
+	}
+	return names
+}
@@ -0,0 +1,39 @@
+package conf
+
+// SetMetadata attaches the metadata key and value to the option in the section,
+// or to the section itself if option is empty, e.g. to mark an option as
+// validated or sensitive. Metadata is kept in memory only: it is not read or
+// written, and it is dropped when its section or option is removed.
+func (c *ConfigFile) SetMetadata(section string, option string, key string, value string) {
+	if section == "" {
+		section = "default"
+	}
+	k := cacheKey{c.foldSection(section), c.foldOption(option)}
+
+	if c.metadata == nil {
+		c.metadata = make(map[cacheKey]map[string]string)
+	}
+	if c.metadata[k] == nil {
+		c.metadata[k] = make(map[string]string)
+	}
+	c.metadata[k][key] = value
+}
+
+// Metadata returns a copy of the metadata attached to the option in the section,
+// or to the section itself if option is empty. It returns nil if there is none.
+func (c *ConfigFile) Metadata(section string, option string) map[string]string {
+	if section == "" {
+		section = "default"
+	}
+	m := c.metadata[cacheKey{c.foldSection(section), c.foldOption(option)}]
+	if m == nil {
+		return nil
+	}
+
+	dup := make(map[string]string, len(m))
+	for key, value := range m {
+		dup[key] = value
+	}
+
+	return dup
+}
@@ -0,0 +1,43 @@
+package conf
+
+// Metrics receives events of configuration operations, to be counted e.g. as
+// Prometheus counters, see SetMetrics. Its methods may be called concurrently.
+type Metrics interface {
+	// ConfigRead is called after every configuration read, from a file, a
+	// reader, a URL or a backend, with the error if reading failed.
+	ConfigRead(err error)
+
+	// CacheLookup is called on every GetString, reporting whether the value
+	// was found in the cache of unfolded values.
+	CacheLookup(hit bool)
+
+	// ConfigReloaded is called after every reload by a Watcher, Reloader or
+	// poller, with the error if the new configuration could not be read or was
+	// rejected.
+	ConfigReloaded(err error)
+
+	// ValidationFailed is called when a validator set with SetValidator rejects
+	// a value for the option, or with empty names when a reloaded configuration
+	// is rejected by the Validate function of a Watcher or Reloader.
+	ValidationFailed(section string, option string)
+}
+
+// metrics receives the events of all configurations.
+var metrics Metrics = nopMetrics{}
+
+// SetMetrics sets the receiver of the events of all configurations. It should
+// be called during initialization, before configurations are used. A nil
+// receiver disables the events.
+func SetMetrics(m Metrics) {
+	if m == nil {
+		m = nopMetrics{}
+	}
+	metrics = m
+}
+
+type nopMetrics struct{}
+
+func (nopMetrics) ConfigRead(error)                {}
+func (nopMetrics) CacheLookup(bool)                {}
+func (nopMetrics) ConfigReloaded(error)            {}
+func (nopMetrics) ValidationFailed(string, string) {}
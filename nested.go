@@ -0,0 +1,232 @@
+package conf
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// NestedStyle selects the syntax read by ReadNested.
+type NestedStyle int
+
+const (
+	// ApacheStyle reads directives one per line, continued by a trailing
+	// backslash, in blocks opened by <Name args> and closed by </Name>.
+	ApacheStyle NestedStyle = iota
+
+	// NginxStyle reads directives terminated by semicolons, which may span
+	// lines, in blocks of braces following their name and arguments.
+	NginxStyle
+)
+
+// ReadNested imports a configuration of nested blocks, such as those of Apache
+// httpd or nginx, and returns a new configuration representation. Every block
+// becomes a section named by its name and arguments, prefixed by the sections
+// of the blocks enclosing it separated by slashes, as sections are named by
+// ReadBackend:
+//
+//	server {                          [server]
+//	    listen 80;                    listen = 80
+//	    location /api {               [server/location /api]
+//	        proxy_pass http://api;    proxy_pass = http://api
+//	    }
+//	}
+//
+// Directives outside of blocks belong to the default section. The arguments
+// of a directive are its value, quotes included; the arguments of a directive
+// repeated within a block are added as lines of its value. Blocks repeated
+// within the same block are numbered from the second on, as in
+// [server#2]. Comments are dropped.
+func ReadNested(reader io.Reader, style NestedStyle) (*ConfigFile, error) {
+	return readNested(reader, "", style)
+}
+
+// ReadNestedFile imports a file as ReadNested does.
+func ReadNestedFile(fname string, style NestedStyle) (c *ConfigFile, err error) {
+	defer wrapReadError(fname, &err)
+
+	file, err := os.Open(fname)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return readNested(file, fname, style)
+}
+
+// nestedReader builds a configuration from the blocks and directives of a nested configuration.
+type nestedReader struct {
+	c      *ConfigFile
+	fname  string
+	blocks []nestedBlock  // Open blocks, innermost last.
+	counts map[string]int // Number of blocks read per section name.
+}
+
+type nestedBlock struct {
+	name    string // Name of the block, without arguments.
+	section string
+}
+
+func readNested(reader io.Reader, fname string, style NestedStyle) (*ConfigFile, error) {
+	r := &nestedReader{c: NewConfigFile(), fname: fname, counts: make(map[string]int)}
+	r.c.beginBatch()
+	defer r.c.endBatch()
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineLength)
+
+	var stmt []byte // statement continued from earlier lines
+	var stmtLine, line int
+	var quote byte
+	for scanner.Scan() {
+		line++
+		l := bytes.TrimSpace(scanner.Bytes())
+		if len(bytes.TrimSpace(stmt)) == 0 {
+			stmtLine = line
+		}
+
+		if style == ApacheStyle {
+			l = append(stmt, l...)
+			if bytes.HasSuffix(l, []byte(`\`)) {
+				l = bytes.TrimSpace(l[:len(l)-1])
+				stmt = append(l[:len(l):len(l)], ' ')
+				continue
+			}
+			stmt = nil
+			if err := r.apacheLine(l, stmtLine); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		for i := 0; i < len(l); i++ {
+			ch := l[i]
+			switch {
+			case quote != 0:
+				if ch == quote && (i == 0 || l[i-1] != '\\') {
+					quote = 0
+				}
+				stmt = append(stmt, ch)
+			case ch == '"' || ch == '\'':
+				quote = ch
+				stmt = append(stmt, ch)
+			case ch == '#': // comment until the end of the line
+				i = len(l)
+			case ch == ';':
+				if err := r.directive(stmt, stmtLine); err != nil {
+					return nil, err
+				}
+				stmt = stmt[:0]
+			case ch == '{':
+				if len(bytes.TrimSpace(stmt)) == 0 {
+					return nil, ReadError{CouldNotParse, string(l)}
+				}
+				r.open(stmt)
+				stmt = stmt[:0]
+			case ch == '}':
+				if len(bytes.TrimSpace(stmt)) > 0 || !r.close("") {
+					return nil, ReadError{CouldNotParse, string(l)}
+				}
+			default:
+				if len(bytes.TrimSpace(stmt)) == 0 {
+					stmtLine = line
+				}
+				stmt = append(stmt, ch)
+			}
+		}
+		stmt = append(stmt, ' ') // statements continue on the next line
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(bytes.TrimSpace(stmt)) > 0 || quote != 0 {
+		return nil, ReadError{CouldNotParse, string(bytes.TrimSpace(stmt))}
+	}
+	if len(r.blocks) > 0 {
+		return nil, ReadError{CouldNotParse, "unclosed block [" + r.blocks[len(r.blocks)-1].section + "]"}
+	}
+
+	return r.c, nil
+}
+
+// apacheLine reads a line of an Apache-style configuration.
+func (r *nestedReader) apacheLine(l []byte, line int) error {
+	switch {
+	case len(l) == 0 || l[0] == '#':
+		return nil
+
+	case bytes.HasPrefix(l, []byte("</")):
+		if !bytes.HasSuffix(l, []byte(">")) || !r.close(string(bytes.TrimSpace(l[2:len(l)-1]))) {
+			return ReadError{CouldNotParse, string(l)}
+		}
+		return nil
+
+	case l[0] == '<':
+		if !bytes.HasSuffix(l, []byte(">")) || len(bytes.TrimSpace(l[1:len(l)-1])) == 0 {
+			return ReadError{CouldNotParse, string(l)}
+		}
+		r.open(l[1 : len(l)-1])
+		return nil
+	}
+
+	return r.directive(l, line)
+}
+
+// open opens a block with the given name and arguments.
+func (r *nestedReader) open(header []byte) {
+	fields := strings.Fields(string(header))
+	section := strings.Join(fields, " ")
+	if len(r.blocks) > 0 {
+		section = r.blocks[len(r.blocks)-1].section + "/" + section
+	}
+	section = r.c.foldSection(section)
+	r.counts[section]++
+	if n := r.counts[section]; n > 1 {
+		section += "#" + strconv.Itoa(n)
+	}
+
+	r.c.AddSection(section)
+	r.blocks = append(r.blocks, nestedBlock{fields[0], section})
+}
+
+// close closes the innermost block, which must have the given name unless it
+// is empty. It returns false if there is no such block.
+func (r *nestedReader) close(name string) bool {
+	if len(r.blocks) == 0 {
+		return false
+	}
+	if name != "" && !strings.EqualFold(r.blocks[len(r.blocks)-1].name, name) {
+		return false
+	}
+
+	r.blocks = r.blocks[:len(r.blocks)-1]
+	return true
+}
+
+// directive adds the directive to the section of the innermost block.
+func (r *nestedReader) directive(stmt []byte, line int) error {
+	fields := strings.Fields(string(stmt))
+	if len(fields) == 0 {
+		return nil
+	}
+	option := fields[0]
+	value := strings.TrimSpace(strings.TrimSpace(string(stmt))[len(option):])
+
+	section := DefaultSection
+	if len(r.blocks) > 0 {
+		section = r.blocks[len(r.blocks)-1].section
+	}
+	if prev, ok := r.c.data[section].get(r.c.foldOption(option)); ok {
+		value = prev + "\n" + value
+	}
+	if _, err := r.c.addOption(section, option, value); err != nil {
+		return err
+	}
+	r.c.setLocation(section, option, Location{r.fname, line})
+
+	return nil
+}
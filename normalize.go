@@ -0,0 +1,30 @@
+package conf
+
+import (
+	"strings"
+)
+
+// SetOptionNormalizer sets the function turning option names into the names
+// they are stored and looked up under, so that names it maps to the same name
+// refer to the same option. By default, names are lowercased, unless the
+// dialect has case sensitive options. FoldSeparators also treats max_clients
+// and max-clients as the same option, and KeepCase disables normalization
+// entirely; a nil function restores the default. The normalizer should be set
+// before options are read or added, as names added before keep their form.
+// Options are written under their normalized names.
+func (c *ConfigFile) SetOptionNormalizer(fn func(name string) string) {
+	c.normalize = fn
+	c.changed()
+}
+
+// FoldSeparators is an option normalizer, see SetOptionNormalizer, which
+// folds the case of names as by default and replaces underscores by dashes.
+func FoldSeparators(name string) string {
+	return strings.ReplaceAll(foldCase(name), "_", "-")
+}
+
+// KeepCase is an option normalizer, see SetOptionNormalizer, which keeps names
+// as they are.
+func KeepCase(name string) string {
+	return name
+}
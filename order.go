@@ -0,0 +1,185 @@
+package conf
+
+// section holds the options of a section in the order they were added.
+// The methods of a nil *section behave as those of an empty one. Those of a
+// section read lazily parse it first, see SetLazy.
+type section struct {
+	options   []string            // Option names in order.
+	values    map[string]string   // Maps option names to values.
+	locations map[string]Location // Where options were read from, if known.
+	pending   *pending            // Text not parsed yet, see SetLazy.
+}
+
+// newSection returns an empty section with room for the given number of options.
+func newSection(capacity int) *section {
+	return &section{options: make([]string, 0, capacity), values: make(map[string]string, capacity)}
+}
+
+// get returns the value of the option.
+func (s *section) get(option string) (value string, ok bool) {
+	if s == nil {
+		return "", false
+	}
+	s.load()
+	value, ok = s.values[option]
+	return value, ok
+}
+
+// location returns where the option was read from.
+func (s *section) location(option string) (loc Location, ok bool) {
+	if s == nil {
+		return Location{}, false
+	}
+	s.load()
+	loc, ok = s.locations[option]
+	return loc, ok
+}
+
+// keys returns the option names in order. The slice must not be modified.
+func (s *section) keys() []string {
+	if s == nil {
+		return nil
+	}
+	s.load()
+	return s.options
+}
+
+func (s *section) len() int {
+	if s == nil {
+		return 0
+	}
+	s.load()
+	return len(s.options)
+}
+
+// set sets the value of the option, appending the option if it is new, and
+// forgets where it was read from. It returns true if the option is new.
+func (s *section) set(option string, value string) bool {
+	s.load()
+	_, ok := s.values[option]
+	if !ok {
+		s.options = append(s.options, option)
+	}
+	s.values[option] = value
+	delete(s.locations, option)
+	return !ok
+}
+
+// remove removes the option. It returns true if the option existed.
+func (s *section) remove(option string) bool {
+	s.load()
+	if _, ok := s.values[option]; !ok {
+		return false
+	}
+	delete(s.values, option)
+	delete(s.locations, option)
+	s.options = removeName(s.options, option)
+	return true
+}
+
+func (s *section) copy() *section {
+	s.load()
+	dup := &section{options: make([]string, len(s.options)), values: make(map[string]string, len(s.values))}
+	copy(dup.options, s.options)
+	for option, value := range s.values {
+		dup.values[option] = value
+	}
+	if s.locations != nil {
+		dup.locations = make(map[string]Location, len(s.locations))
+		for option, loc := range s.locations {
+			dup.locations[option] = loc
+		}
+	}
+	return dup
+}
+
+// indexOf returns the index of name in names, or -1.
+func indexOf(names []string, name string) int {
+	for i, n := range names {
+		if n == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// removeName returns names without name, reusing its storage.
+func removeName(names []string, name string) []string {
+	if i := indexOf(names, name); i >= 0 {
+		names = append(names[:i], names[i+1:]...)
+	}
+	return names
+}
+
+// moveName moves name to index i of names. It returns false if name is not
+// in names or i is out of range.
+func moveName(names []string, name string, i int) bool {
+	j := indexOf(names, name)
+	if j < 0 || i < 0 || i >= len(names) {
+		return false
+	}
+	if j < i {
+		copy(names[j:i], names[j+1:i+1])
+	} else {
+		copy(names[i+1:j+1], names[i:j])
+	}
+	names[i] = name
+	return true
+}
+
+// SectionIndex returns the position of the section among the sections of the
+// configuration, which are kept in the order they were added and written in
+// that order, or -1 if the section does not exist.
+func (c *ConfigFile) SectionIndex(section string) int {
+	if section == "" {
+		section = "default"
+	}
+	return indexOf(c.sections, c.foldSection(section))
+}
+
+// OptionIndex returns the position of the option among the options of the
+// section, which are kept in the order they were added and written in that
+// order, or -1 if the section or option does not exist.
+func (c *ConfigFile) OptionIndex(section string, option string) int {
+	if section == "" {
+		section = "default"
+	}
+	return indexOf(c.data[c.foldSection(section)].keys(), c.foldOption(option))
+}
+
+// MoveSection moves the section to the given position, shifting the sections
+// in between. It returns false if the section does not exist or the position
+// is out of range.
+func (c *ConfigFile) MoveSection(section string, index int) bool {
+	if section == "" {
+		section = "default"
+	}
+	if !moveName(c.sections, c.foldSection(section), index) {
+		return false
+	}
+	c.changed()
+
+	return true
+}
+
+// MoveOption moves the option to the given position within its section,
+// shifting the options in between, e.g. to place a new option next to a
+// related one:
+//
+//	c.AddOption("service-1", "port", "443")
+//	c.MoveOption("service-1", "port", c.OptionIndex("service-1", "host")+1)
+//
+// It returns false if the section or option does not exist or the position is
+// out of range.
+func (c *ConfigFile) MoveOption(section string, option string, index int) bool {
+	if section == "" {
+		section = "default"
+	}
+	s := c.mutableSection(c.foldSection(section))
+	if s == nil || !moveName(s.options, c.foldOption(option), index) {
+		return false
+	}
+	c.changed()
+
+	return true
+}
@@ -0,0 +1,145 @@
+package conf
+
+import (
+	"maps"
+)
+
+// View is a read-only view of a configuration in which some options are
+// overridden, see WithOverrides.
+type View struct {
+	c         *ConfigFile
+	overrides map[cacheKey]string // Raw values by lower-case section and option.
+}
+
+// WithOverrides returns a view of the configuration in which the options named
+// by the keys of overrides, "section.option" or just "option" for the default
+// section, have the values mapped to, e.g. to serve a tenant or run a test with
+// a few options changed. A section name may contain dots, as the option name
+// follows the last one.
+//
+// The view looks options up in its overrides first and then in the
+// configuration, which it neither copies nor modifies, so that views can be
+// taken and used concurrently with lookups of the configuration; they see its
+// later modifications. Overrides take precedence over every other value of
+// their options, including environment overrides, and placeholders referring
+// to them are unfolded with their values. They only apply to lookups: they do
+// not add sections or options to GetSections and GetOptions.
+func (c *ConfigFile) WithOverrides(overrides map[string]string) *View {
+	v := &View{c: c}
+	return v.WithOverrides(overrides)
+}
+
+// WithOverrides returns a view of the same configuration with the overrides of
+// v and those passed, which take precedence, see ConfigFile.WithOverrides.
+func (v *View) WithOverrides(overrides map[string]string) *View {
+	nested := &View{c: v.c, overrides: maps.Clone(v.overrides)}
+	if nested.overrides == nil {
+		nested.overrides = make(map[cacheKey]string, len(overrides))
+	}
+	for name, value := range overrides {
+		section, option := splitKey(name)
+		if section == "" {
+			section = DefaultSection
+		}
+		nested.overrides[cacheKey{v.c.foldSection(section), v.c.foldOption(option)}] = value
+	}
+
+	return nested
+}
+
+// key returns the option in the section as the configuration stores it.
+func (v *View) key(section string, option string) cacheKey {
+	if section == "" {
+		section = "default"
+	}
+	return cacheKey{v.c.foldSection(section), v.c.foldOption(option)}
+}
+
+// lookup returns the raw value of the option, given in lower case, from the
+// overrides or else the configuration.
+func (v *View) lookup(section string, option string) (string, bool) {
+	if value, ok := v.overrides[cacheKey{section, option}]; ok {
+		return value, true
+	}
+	return v.c.lookup(section, option)
+}
+
+// resolve returns the value of the option referenced by a placeholder in the
+// section, like ConfigFile.resolve with the overrides of the view.
+func (v *View) resolve(section string, ref string) (nsection string, noption string, nvalue string, err error) {
+	return v.c.resolveWith(section, ref, v.lookup)
+}
+
+// GetSections returns the list of sections of the configuration.
+func (v *View) GetSections() []string {
+	return v.c.GetSections()
+}
+
+// HasSection checks if the configuration has the given section.
+func (v *View) HasSection(section string) bool {
+	return v.c.HasSection(section)
+}
+
+// GetOptions returns the list of options of the configuration in the section.
+func (v *View) GetOptions(section string) ([]string, error) {
+	return v.c.GetOptions(section)
+}
+
+// HasOption checks if the option is overridden or the configuration has it.
+func (v *View) HasOption(section string, option string) bool {
+	if _, ok := v.overrides[v.key(section, option)]; ok {
+		return true
+	}
+	return v.c.HasOption(section, option)
+}
+
+// GetRawString gets the raw string value of the option, overridden or from the
+// configuration.
+func (v *View) GetRawString(section string, option string) (string, error) {
+	if value, ok := v.overrides[v.key(section, option)]; ok {
+		return value, nil
+	}
+	return v.c.GetRawString(section, option)
+}
+
+// GetString gets the string value of the option like ConfigFile.GetString,
+// overridden or from the configuration. Values are not cached.
+func (v *View) GetString(section string, option string) (string, error) {
+	key := v.key(section, option)
+	value, ok := v.overrides[key]
+	if !ok {
+		return v.c.unfolded(key, v.resolve)
+	}
+
+	return v.c.unfoldValue(key, value, v.resolve)
+}
+
+// GetInt has the same behaviour as GetString but converts the response to int.
+func (v *View) GetInt(section string, option string) (int, error) {
+	sv, err := v.GetString(section, option)
+	if err != nil {
+		return 0, err
+	}
+
+	return v.c.parseInt(sv, section, option)
+}
+
+// GetFloat64 has the same behaviour as GetString but converts the response to float64.
+func (v *View) GetFloat64(section string, option string) (float64, error) {
+	sv, err := v.GetString(section, option)
+	if err != nil {
+		return 0, err
+	}
+
+	return v.c.parseFloat(sv, section, option)
+}
+
+// GetBool has the same behaviour as GetString but converts the response to bool.
+func (v *View) GetBool(section string, option string) (bool, error) {
+	sv, err := v.GetString(section, option)
+	if err != nil {
+		return false, err
+	}
+
+	return v.c.boolValue(sv, section, option)
+}
@@ -0,0 +1,183 @@
+package conf
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// WriteSection writes the header and the options of a single section to the
+// io.Writer as Write writes them in the dialect of the configuration,
+// followed by a blank line, so that the output can be appended to a file or
+// spliced into one. The header is written even for the default section in
+// PHP mode. It returns an error if the section does not exist.
+func (c *ConfigFile) WriteSection(writer io.Writer, section string) error {
+	buf := bytes.NewBuffer(nil)
+	if err := c.formatWholeSection(buf, section, "\n"); err != nil {
+		return err
+	}
+	_, err := buf.WriteTo(writer)
+	return err
+}
+
+// UpdateFileSection rewrites the named section of an existing file with the
+// options the configuration has in it, leaving every byte outside of the
+// section untouched, e.g. for a tool owning one section of a file shared with
+// others. The section spans from its header to the last line preceding the
+// next header which is neither blank nor a comment, so that comments
+// introducing the next section stay with it, while comments within the
+// section are lost. Repetitions of the section in the file are removed, and a
+// section missing from the file is appended to it. If the configuration lacks
+// the section, it is removed from the file. Options preceding the first header
+// are not part of any section and left alone.
+//
+// The file is read and written in the dialect of the configuration, keeping
+// its line terminators and permissions, and replaced atomically: other
+// processes either find the old file or the new one.
+func (c *ConfigFile) UpdateFileSection(fname string, section string) (err error) {
+	defer wrapWriteError(fname, &err)
+
+	if section == "" {
+		section = DefaultSection
+	}
+	section = c.foldSection(section)
+
+	info, err := os.Stat(fname)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(fname)
+	if err != nil {
+		return err
+	}
+
+	eol := "\n"
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		eol = lineEnd(string(data[:i+1]))
+	}
+	replacement := bytes.NewBuffer(nil)
+	if _, ok := c.data[section]; ok {
+		c.formatWholeSection(replacement, section, eol)
+		replacement.Truncate(replacement.Len() - len(eol)) // without the blank line
+	}
+
+	return replaceFile(fname, info.Mode().Perm(), spliceSection(data, c.sectionSpans(data, section), replacement.Bytes(), eol))
+}
+
+// formatWholeSection writes the header and the options of the section, lines
+// terminated by eol, followed by a blank line.
+func (c *ConfigFile) formatWholeSection(buf *bytes.Buffer, section string, eol string) error {
+	if section == "" {
+		section = DefaultSection
+	}
+	section = c.foldSection(section)
+	if _, ok := c.data[section]; !ok {
+		return GetError{SectionNotFound, "", "", section, "", nil}
+	}
+
+	buf.WriteString(c.dialect.formatSection(section) + eol)
+	c.formatOptions(buf, c.dialect, section, eol, nil)
+	buf.WriteString(eol)
+	return nil
+}
+
+// sectionSpans returns the start and end offsets of the occurrences of the
+// section in the file, see UpdateFileSection.
+func (c *ConfigFile) sectionSpans(data []byte, section string) (spans [][2]int) {
+	d := c.dialect
+	chars := d.commentChars()
+	open := false
+	var start, end int
+	for pos := 0; pos < len(data); {
+		next := len(data)
+		if i := bytes.IndexByte(data[pos:], '\n'); i >= 0 {
+			next = pos + i + 1
+		}
+		l := bytes.TrimSpace(data[pos:next])
+		if d.InlineComments == QuotedInlineComments {
+			l = uncommentQuoted(l, chars)
+		}
+
+		switch {
+		case len(l) == 0 || d.isComment(l):
+		case l[0] == '[' && l[len(l)-1] == ']':
+			if open {
+				spans = append(spans, [2]int{start, end})
+			}
+			name := string(bytes.TrimSpace(l[1 : len(l)-1]))
+			switch d.syntax {
+			case pythonSyntax:
+				name = string(l[1 : len(l)-1])
+			case gitSyntax:
+				name, _ = gitSection(l[1 : len(l)-1])
+			}
+			open = c.foldSection(name) == section
+			start, end = pos, next
+		case open:
+			end = next
+		}
+		pos = next
+	}
+	if open {
+		spans = append(spans, [2]int{start, end})
+	}
+
+	return spans
+}
+
+// spliceSection returns the file with the first of the spans replaced by the
+// replacement and the others removed, or the replacement appended after a
+// blank line if there are no spans.
+func spliceSection(data []byte, spans [][2]int, replacement []byte, eol string) []byte {
+	out := make([]byte, 0, len(data)+len(replacement)+2*len(eol))
+	if len(spans) == 0 {
+		out = append(out, data...)
+		if len(replacement) == 0 {
+			return out
+		}
+		if len(data) > 0 {
+			if data[len(data)-1] != '\n' {
+				out = append(out, eol...)
+			}
+			out = append(out, eol...)
+		}
+		return append(out, replacement...)
+	}
+
+	pos := 0
+	for i, span := range spans {
+		out = append(out, data[pos:span[0]]...)
+		if i == 0 {
+			out = append(out, replacement...)
+			if span[1] == len(data) && data[len(data)-1] != '\n' {
+				out = bytes.TrimSuffix(out, []byte(eol)) // as the file ended
+			}
+		}
+		pos = span[1]
+	}
+	return append(out, data[pos:]...)
+}
+
+// replaceFile atomically replaces the file by one with the data and the
+// permissions given.
+func replaceFile(fname string, perm os.FileMode, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(fname), "."+filepath.Base(fname)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), fname)
+}
@@ -0,0 +1,58 @@
+package conf
+
+import (
+	"fmt"
+)
+
+// Patch is a list of edits of a configuration, applied by ApplyPatch. Patches
+// are meant to be shipped by configuration management tools instead of whole
+// files, e.g. as JSON:
+//
+//	[
+//		{"op": "set", "section": "server", "option": "port", "value": "8080"},
+//		{"op": "rename", "section": "server", "option": "timeout", "to": "read-timeout"},
+//		{"op": "delete", "section": "legacy"}
+//	]
+type Patch []PatchOp
+
+// PatchOp is an edit of a Patch.
+type PatchOp struct {
+	Op      string `json:"op"`               // "set", "delete" or "rename".
+	Section string `json:"section"`          // Section edited; "" means the default section.
+	Option  string `json:"option,omitempty"` // Option edited; "" deletes or renames the whole section.
+	Value   string `json:"value,omitempty"`  // Value set by "set".
+	To      string `json:"to,omitempty"`     // New name given by "rename".
+}
+
+// ApplyPatch applies the edits of the patch to the configuration in a single
+// transaction, see Tx: either all of them are applied, or, if one of them
+// fails, none. Setting adds or replaces an option. Deleting and renaming
+// options or sections which are missing does nothing, so that patches can be
+// applied repeatedly; renaming an option replaces one already named to.
+func ApplyPatch(c *ConfigFile, patch Patch) error {
+	tx := c.Begin()
+	for i, op := range patch {
+		section := op.Section
+		if section == "" {
+			section = DefaultSection
+		}
+
+		switch {
+		case op.Op == "set" && op.Option != "":
+			tx.AddOption(section, op.Option, op.Value)
+		case op.Op == "delete" && op.Option == "":
+			tx.RemoveSection(section)
+		case op.Op == "delete":
+			tx.RemoveOption(section, op.Option)
+		case op.Op == "rename" && op.To != "" && op.Option == "":
+			tx.RenameSection(section, op.To)
+		case op.Op == "rename" && op.To != "":
+			tx.RenameOption(section, op.Option, op.To)
+		default:
+			tx.Rollback()
+			return fmt.Errorf("patch operation %d: invalid op '%s' of section '%s' and option '%s'", i, op.Op, op.Section, op.Option)
+		}
+	}
+
+	return tx.Commit()
+}
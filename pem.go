@@ -0,0 +1,109 @@
+package conf
+
+import (
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"strings"
+)
+
+// pemLineLength is the number of base64 characters per line written by SetPEM.
+const pemLineLength = 64
+
+// GetPEM has the same behaviour as GetString but decodes the response as a PEM
+// block, such as a certificate or a key, e.g.
+//
+//	cert = -----BEGIN CERTIFICATE-----
+//	       MIIBhTCCASugAwIBAgIQIRi6zePL6mKjOipn+dNuaTAKBggqhkjOPQQDAjASMRAw
+//	       ...
+//	       -----END CERTIFICATE-----
+//
+// Besides the lines of PEM, it accepts the forms written by SetPEM: the lines
+// may be joined by spaces instead of newlines, and the base64 padding may be
+// left out. It returns an error if the value does not hold a PEM block.
+func (c *ConfigFile) GetPEM(section string, option string) (block *pem.Block, err error) {
+	sv, err := c.GetString(section, option)
+	if err != nil {
+		return nil, err
+	}
+
+	if block, err = decodePEM(sv); err != nil {
+		return nil, GetError{CouldNotParse, "PEM", sv, section, option, err}
+	}
+	return block, nil
+}
+
+// SetPEM sets the option to the PEM encoding of the block, as SetOption does,
+// so that GetPEM decodes it once the configuration is written and read back.
+// The lines of the block are broken so that none starts like a comment. In
+// dialects continuing values on indented lines and in git mode, the value is
+// otherwise the PEM encoding itself. Other dialects continue values on lines
+// without a delimiter, which the base64 padding and the headers of the block
+// would have, so the padding is left out and blocks with headers are rejected;
+// dialects not continuing values get the lines joined by spaces. SetPEM returns
+// a SetError if the block has headers it cannot write, or if the data of a
+// block with headers starts like a comment.
+func (c *ConfigFile) SetPEM(section string, option string, block *pem.Block) error {
+	d := c.dialect
+	verbatim := d.Continuation == ContinueIndented || d.syntax == gitSyntax // lines may have delimiters
+	if len(block.Headers) > 0 && !verbatim {
+		return SetError{InvalidValue, "", section, option, errors.New("PEM headers cannot be written in this dialect")}
+	}
+
+	// the header lines of the encoding of the block without bytes
+	head := strings.Split(string(pem.EncodeToMemory(&pem.Block{Type: block.Type, Headers: block.Headers})), "\n")
+	lines := head[:len(head)-2]
+	enc := base64.RawStdEncoding
+	if verbatim {
+		enc = base64.StdEncoding
+	}
+	body := enc.EncodeToString(block.Bytes)
+	for len(body) > 0 {
+		n := min(pemLineLength, len(body))
+		for n > 1 && n < len(body) && d.isComment([]byte(body[n:])) {
+			n-- // start the next line elsewhere
+		}
+		switch {
+		case len(lines) > 1 && d.isComment([]byte(body)):
+			return SetError{InvalidValue, "", section, option, errors.New("PEM data following headers starts like a comment")}
+		case len(lines) == 1 && d.isComment([]byte(body)):
+			lines[0] += " " + body[:n] // a line of its own would be a comment
+		default:
+			lines = append(lines, body[:n])
+		}
+		body = body[n:]
+	}
+	lines = append(lines, "-----END "+block.Type+"-----")
+
+	sep := "\n"
+	if !verbatim && d.Continuation != ContinueBareLines && d.Duplicates != DuplicatesAppend {
+		sep = " "
+	}
+	return c.SetOption(section, option, strings.Join(lines, sep))
+}
+
+// decodePEM decodes the PEM block in value, accepting the forms written by SetPEM.
+func decodePEM(value string) (*pem.Block, error) {
+	if block, _ := pem.Decode([]byte(value)); block != nil {
+		return block, nil
+	}
+
+	_, rest, ok := strings.Cut(value, "-----BEGIN ")
+	if !ok {
+		return nil, errors.New("no PEM block found")
+	}
+	typ, rest, ok := strings.Cut(rest, "-----")
+	if !ok {
+		return nil, errors.New("malformed PEM header")
+	}
+	body, _, ok := strings.Cut(rest, "-----END "+typ+"-----")
+	if !ok {
+		return nil, errors.New("missing PEM trailer")
+	}
+	b, err := base64.RawStdEncoding.DecodeString(strings.TrimRight(strings.Join(strings.Fields(body), ""), "="))
+	if err != nil {
+		return nil, err
+	}
+
+	return &pem.Block{Type: typ, Headers: map[string]string{}, Bytes: b}, nil
+}
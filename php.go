@@ -0,0 +1,182 @@
+package conf
+
+import (
+	"strconv"
+	"strings"
+)
+
+// PHPConstants maps the names of constants to their values, which GetString
+// substitutes in PHP mode. It holds the error level constants used by php.ini;
+// constants of extensions may be added.
+var PHPConstants = map[string]string{
+	"E_ERROR":             "1",
+	"E_WARNING":           "2",
+	"E_PARSE":             "4",
+	"E_NOTICE":            "8",
+	"E_CORE_ERROR":        "16",
+	"E_CORE_WARNING":      "32",
+	"E_COMPILE_ERROR":     "64",
+	"E_COMPILE_WARNING":   "128",
+	"E_USER_ERROR":        "256",
+	"E_USER_WARNING":      "512",
+	"E_USER_NOTICE":       "1024",
+	"E_STRICT":            "2048",
+	"E_RECOVERABLE_ERROR": "4096",
+	"E_DEPRECATED":        "8192",
+	"E_USER_DEPRECATED":   "16384",
+	"E_ALL":               "32767",
+}
+
+// PHPDialect handles php.ini files as PHP does:
+//
+//   - section and option names are case sensitive,
+//   - only ";" starts comments, anywhere outside of double quotes, and only
+//     "=" separates options from values. Values do not continue on other
+//     lines,
+//   - sections such as [PHP] only structure the file: options before the first
+//     section belong to the default section, and looking an option up in the
+//     default section finds it in any section, the last one read taking
+//     precedence,
+//   - GetString removes the quotes around values in double or single quotes,
+//     returns "1" for the unquoted keywords on, yes and true and the empty
+//     string for off, no, false, none and null, substitutes PHPConstants and
+//     evaluates expressions combining integers and constants by the operators
+//     |, &, ^, ~ and !, such as E_ALL & ~E_NOTICE. Placeholders are not
+//     unfolded, and GetBool takes empty values for false. GetRawString
+//     returns values as written,
+//   - Write writes options as "option = value", and the options of the default
+//     section before the first section header, without one of their own.
+//
+// Read does not defer parsing in this dialect, even if SetLazy is enabled.
+var PHPDialect = Dialect{
+	CommentPrefixes:       []string{";"},
+	InlineComments:        QuotedInlineComments,
+	Delimiters:            "=",
+	SpacedDelimiter:       true,
+	CaseSensitiveSections: true,
+	CaseSensitiveOptions:  true,
+	Continuation:          NoContinuation,
+	Duplicates:            DuplicatesOverride,
+	Interpolation:         NoInterpolation,
+	syntax:                phpSyntax,
+}
+
+// SetPHPMode selects PHPDialect if enabled, and DefaultDialect otherwise, see
+// SetDialect.
+func (c *ConfigFile) SetPHPMode(enabled bool) {
+	c.setMode(enabled, PHPDialect)
+}
+
+// phpValue returns the value of a raw value as PHP reads it, see SetPHPMode.
+func phpValue(value string) string {
+	if n := len(value); n >= 2 && (value[0] == '"' || value[0] == '\'') && value[n-1] == value[0] {
+		if value[0] == '"' {
+			return strings.ReplaceAll(value[1:n-1], `\"`, `"`)
+		}
+		return value[1 : n-1]
+	}
+
+	switch strings.ToLower(value) {
+	case "on", "yes", "true":
+		return "1"
+	case "off", "no", "false", "none", "null":
+		return ""
+	}
+	if constant, ok := PHPConstants[value]; ok {
+		return constant
+	}
+	if strings.ContainsAny(value, "|&^~!()") {
+		p := phpParser{s: value}
+		if n, ok := p.expr(); ok && p.skipSpace() == len(value) {
+			return strconv.FormatInt(n, 10)
+		}
+	}
+
+	return value
+}
+
+// phpParser evaluates the expressions of php.ini, whose binary operators are
+// left-associative and of equal precedence, binding less than ~ and !.
+type phpParser struct {
+	s   string
+	pos int
+}
+
+// skipSpace skips white space and returns the position following it.
+func (p *phpParser) skipSpace() int {
+	for p.pos < len(p.s) && (p.s[p.pos] == ' ' || p.s[p.pos] == '\t') {
+		p.pos++
+	}
+	return p.pos
+}
+
+// expr evaluates operands combined by |, & and ^. It returns false if the
+// expression is not one of integers and constants.
+func (p *phpParser) expr() (int64, bool) {
+	n, ok := p.operand()
+	for ok && p.skipSpace() < len(p.s) {
+		op := p.s[p.pos]
+		if op != '|' && op != '&' && op != '^' {
+			break
+		}
+		p.pos++
+		var m int64
+		if m, ok = p.operand(); ok {
+			switch op {
+			case '|':
+				n |= m
+			case '&':
+				n &= m
+			case '^':
+				n ^= m
+			}
+		}
+	}
+	return n, ok
+}
+
+// operand evaluates an integer, a constant, a parenthesized expression or an
+// operand negated by ~ or !.
+func (p *phpParser) operand() (int64, bool) {
+	if p.skipSpace() == len(p.s) {
+		return 0, false
+	}
+
+	switch p.s[p.pos] {
+	case '~':
+		p.pos++
+		n, ok := p.operand()
+		return ^n, ok
+	case '!':
+		p.pos++
+		n, ok := p.operand()
+		if n == 0 {
+			return 1, ok
+		}
+		return 0, ok
+	case '(':
+		p.pos++
+		n, ok := p.expr()
+		if !ok || p.skipSpace() == len(p.s) || p.s[p.pos] != ')' {
+			return 0, false
+		}
+		p.pos++
+		return n, true
+	}
+
+	start := p.pos
+	for p.pos < len(p.s) && isConstantChar(p.s[p.pos]) {
+		p.pos++
+	}
+	word := p.s[start:p.pos]
+	if constant, ok := PHPConstants[word]; ok {
+		word = constant
+	}
+	n, err := strconv.ParseInt(word, 10, 64)
+	return n, err == nil
+}
+
+// isConstantChar reports whether ch may be part of an integer or a constant name.
+func isConstantChar(ch byte) bool {
+	return ch == '_' || '0' <= ch && ch <= '9' || 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z'
+}
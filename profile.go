@@ -0,0 +1,19 @@
+package conf
+
+// SetProfile selects the profile whose sections override the others. With the
+// profile "production", options in section [service-1@production] take
+// precedence over the same options in [service-1]:
+//
+//	[service-1]
+//	host = localhost
+//	maxclients = 10
+//
+//	[service-1@production]
+//	host = s1.example.com
+//
+// This lets one file hold the settings of several environments. An empty
+// profile disables the overrides.
+func (c *ConfigFile) SetProfile(profile string) {
+	c.profile = foldCase(profile)
+	c.changed()
+}
@@ -0,0 +1,39 @@
+package conf
+
+// ProtectSection makes the section and all of its options read-only, so that
+// attempts to add, change or remove them fail, SetOption and Tx.Commit returning
+// a SetError with reason Protected. Protection cannot be lifted; it is meant to
+// fence off core settings before handing the configuration to e.g. plugins.
+func (c *ConfigFile) ProtectSection(section string) {
+	c.protect(section, "")
+}
+
+// ProtectOption makes the option in the section read-only, see ProtectSection.
+func (c *ConfigFile) ProtectOption(section string, option string) {
+	c.protect(section, option)
+}
+
+func (c *ConfigFile) protect(section string, option string) {
+	if section == "" {
+		section = "default"
+	}
+	if c.protected == nil {
+		c.protected = make(map[cacheKey]bool)
+	}
+	c.protected[cacheKey{c.foldSection(section), c.foldOption(option)}] = true
+}
+
+// checkProtected returns a SetError if the option in the section, or the
+// section itself if option is empty, is protected.
+func (c *ConfigFile) checkProtected(section string, option string) error {
+	if c.protected == nil {
+		return nil
+	}
+	section, option = c.foldSection(section), c.foldOption(option)
+
+	if c.protected[cacheKey{section, ""}] || option != "" && c.protected[cacheKey{section, option}] {
+		return SetError{Protected, "", section, option, nil}
+	}
+
+	return nil
+}
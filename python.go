@@ -0,0 +1,47 @@
+package conf
+
+// pythonDepth is the depth of placeholders at which configparser gives up
+// unfolding, its MAX_INTERPOLATION_DEPTH.
+const pythonDepth = 10
+
+// PythonDialect behaves as the ConfigParser of Python's configparser module
+// with its default settings, so that files can be shared between Go and Python
+// programs:
+//
+//   - the default section is written [DEFAULT]; a [default] section is the
+//     same section. Its options are those of every other section, unless
+//     they set them. Section names are otherwise case sensitive, option names
+//     are not,
+//   - options must follow a section header,
+//   - lines starting with "#" or ";" are comments; "#" and ";" within values
+//     are kept,
+//   - lines indented deeper than the line of their option continue its value,
+//     even if they contain "=" or ":". Empty lines between them are part of
+//     the value,
+//   - a section or option repeated within a file is reported as a ReadError
+//     with the reason Duplicate, while reading several files adds to the
+//     options read before,
+//   - %% unfolds to a percent sign, other percent signs not starting a
+//     placeholder make GetString fail, and placeholders are unfolded at most
+//     10 levels deep,
+//   - Write writes options as "option = value", continuing multi-line values
+//     on lines indented by a tab.
+//
+// Read does not defer parsing in this dialect, even if SetLazy is enabled.
+var PythonDialect = Dialect{
+	CommentPrefixes:       []string{"#", ";"},
+	InlineComments:        NoInlineComments,
+	Delimiters:            "=:",
+	SpacedDelimiter:       true,
+	CaseSensitiveSections: true,
+	Continuation:          ContinueIndented,
+	Duplicates:            DuplicatesError,
+	Interpolation:         BasicInterpolation,
+	syntax:                pythonSyntax,
+}
+
+// SetPythonMode selects PythonDialect if enabled, and DefaultDialect
+// otherwise, see SetDialect.
+func (c *ConfigFile) SetPythonMode(enabled bool) {
+	c.setMode(enabled, PythonDialect)
+}
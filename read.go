@@ -3,6 +3,8 @@ package conf
 import (
 	"bufio"
 	"bytes"
+	"context"
+	"fmt"
 	"io"
 	"os"
 	"strings"
@@ -10,15 +12,22 @@ import (
 
 // ReadConfigFile reads a file and returns a new configuration representation.
 // This representation can be queried with GetString, etc.
-func ReadConfigFile(fname string) (c *ConfigFile, err error) {
+// The file is read in the dialect given, if any, and else in DefaultDialect.
+// Errors are prefixed with the file name; the underlying error can be
+// inspected with errors.Is and errors.As.
+func ReadConfigFile(fname string, dialect ...Dialect) (c *ConfigFile, err error) {
+	defer wrapReadError(fname, &err)
+
 	var file *os.File
 
 	if file, err = os.Open(fname); err != nil {
+		metrics.ConfigRead(err)
 		return nil, err
 	}
 
-	c = NewConfigFile()
-	if err = c.Read(file); err != nil {
+	c = newConfigFile(dialect)
+	if err = c.read(file, fname); err != nil {
+		file.Close()
 		return nil, err
 	}
 
@@ -29,10 +38,49 @@ func ReadConfigFile(fname string) (c *ConfigFile, err error) {
 	return c, nil
 }
 
-func ReadConfigBytes(conf []byte) (c *ConfigFile, err error) {
+// ReadFile reads the named file into the configuration as Read does, keeping
+// its settings, such as SetDialect, and recording where options were read
+// from, see Source.
+func (c *ConfigFile) ReadFile(fname string) (err error) {
+	defer wrapReadError(fname, &err)
+
+	file, err := os.Open(fname)
+	if err != nil {
+		metrics.ConfigRead(err)
+		return err
+	}
+	defer file.Close()
+
+	return c.read(file, fname)
+}
+
+// ReadConfigFileContext reads a file as ReadConfigFile does, but gives up when
+// ctx is done, e.g. on a deadline while a network file system does not respond.
+// The file is then still opened and read in the background until that returns.
+func ReadConfigFileContext(ctx context.Context, fname string, dialect ...Dialect) (c *ConfigFile, err error) {
+	defer wrapReadError(fname, &err)
+
+	data, err := readContext(ctx, func() ([]byte, error) {
+		return os.ReadFile(fname)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	c = newConfigFile(dialect)
+	if err = c.read(bytes.NewReader(data), fname); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// ReadConfigBytes reads a configuration from conf, in the dialect given, if
+// any, and else in DefaultDialect.
+func ReadConfigBytes(conf []byte, dialect ...Dialect) (c *ConfigFile, err error) {
 	buf := bytes.NewBuffer(conf)
 
-	c = NewConfigFile()
+	c = newConfigFile(dialect)
 	if err = c.Read(buf); err != nil {
 		return nil, err
 	}
@@ -41,80 +89,368 @@ func ReadConfigBytes(conf []byte) (c *ConfigFile, err error) {
 }
 
 // Read reads an io.Reader and returns a configuration representation. This
-// representation can be queried with GetString, etc.
+// representation can be queried with GetString, etc. The configuration is read
+// in its dialect, see SetDialect.
 func (c *ConfigFile) Read(reader io.Reader) (err error) {
-	buf := bufio.NewReader(reader)
+	return c.read(reader, "")
+}
 
-	var section, option string
-	section = "default"
-	for {
-		l, buferr := buf.ReadString('\n') // parse line-by-line
-		l = strings.TrimSpace(l)
+// SetInterning enables or disables the interning of option names and values by
+// Read, which then stores a single copy of equal names and values, such as the
+// same option in many sections or values like "true" repeated throughout a
+// large generated configuration. It is enabled by default; disabling it makes
+// reading configurations with few repetitions slightly faster.
+func (c *ConfigFile) SetInterning(enabled bool) {
+	c.interning = enabled
+}
 
-		if buferr != nil {
-			if buferr != io.EOF {
-				return err
-			}
+// ReadContext reads an io.Reader as Read does, but gives up when ctx is done,
+// e.g. on a deadline while a slow source does not respond. The reader is then
+// still read in the background until its Read returns; closing it may stop that.
+// The whole input is read before it is parsed.
+func (c *ConfigFile) ReadContext(ctx context.Context, reader io.Reader) error {
+	data, err := readContext(ctx, func() ([]byte, error) {
+		return io.ReadAll(c.limits.limitReader(reader))
+	})
+	if err != nil {
+		return err
+	}
 
-			if len(l) == 0 {
-				break
-			}
+	return c.Read(bytes.NewReader(data))
+}
+
+// readContext returns the result of read, or the error of ctx if it is done first.
+func readContext(ctx context.Context, read func() ([]byte, error)) ([]byte, error) {
+	type result struct {
+		data []byte
+		err  error
+	}
+	done := make(chan result, 1) // not blocking the reader if ctx is done first
+	go func() {
+		data, err := read()
+		done <- result{data, err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.data, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// read implements Read, recording the locations of options in the named file.
+// Lines are scanned in a single pass each, using a reusable buffer; only names
+// and values are copied out of it, once per distinct name and value if
+// interning is enabled.
+func (c *ConfigFile) read(reader io.Reader, fname string) (err error) {
+	defer func() { metrics.ConfigRead(err) }()
+	c.beginBatch()
+	defer c.endBatch()
+
+	switch {
+	case c.lazy && !c.document && c.dialect.lazyParsing():
+		err = c.readLazy(reader, fname)
+	case c.dialect.syntax == pythonSyntax || c.dialect.syntax == gitSyntax:
+		err = c.parse(reader, fname, "", 0) // options need a section header
+	default:
+		err = c.parse(reader, fname, "default", 0)
+	}
+	if err == nil && c.schema != nil {
+		err = c.coerce(c.schema)
+	}
+
+	return err
+}
+
+// parse implements read, starting in the given section after the given line.
+func (c *ConfigFile) parse(reader io.Reader, fname string, section string, line int) (err error) {
+	c.beginBatch()
+	defer c.endBatch()
+
+	limits := c.limits
+	scanner := bufio.NewScanner(limits.limitReader(reader))
+	if limits.MaxLineLength > 0 {
+		scanner.Buffer(make([]byte, 0, min(64*1024, limits.MaxLineLength+2)), limits.MaxLineLength+2) // with CRLF
+	} else {
+		scanner.Buffer(make([]byte, 0, 64*1024), maxLineLength)
+	}
+	d := c.dialect
+	switch {
+	case d.syntax == gitSyntax:
+		scanner.Split(scanGitLines)
+	case d.Continuation == ContinueBackslash:
+		scanner.Split(scanContinuedLines(d))
+	default:
+		scanner.Split(scanRawLines)
+	}
+	chars := d.commentChars()
+
+	var option string
+	var optionLine, size, sections, options, continued int
+	var strs interned // see SetInterning
+
+	// with ContinueIndented, continuation lines are indented deeper than their
+	// option, and blank lines between them are part of the value
+	var indent, blanks int
+	var seen map[cacheKey]bool // with DuplicatesError and DuplicatesKeepFirst
+	if d.Duplicates == DuplicatesError || d.Duplicates == DuplicatesKeepFirst {
+		seen = make(map[cacheKey]bool)
+	}
+	var ignored bool // whether the option is a repetition ignored with DuplicatesKeepFirst
+	appendLine := func(raw []byte, text string) error {
+		if ignored {
+			c.keep(raw, docEntry{section: section})
+			return nil
+		}
+		prev, _ := c.data[c.foldSection(section)].get(c.foldOption(option))
+		value := prev + strings.Repeat("\n", blanks+1) + text
+		blanks = 0
+		if err := c.SetOption(section, option, value); err != nil {
+			return err
+		}
+		c.setLocation(section, option, Location{fname, optionLine})
+		c.keep(raw, docEntry{section: section, option: option, kind: docContinuation, value: value})
+		return nil
+	}
+
+	for scanner.Scan() { // parse line-by-line
+		raw := scanner.Bytes()
+		l := bytes.TrimSpace(raw)
+		line += 1 + continued
+		switch {
+		case d.syntax == gitSyntax:
+			continued = bytes.Count(l, []byte("\n"))
+		case d.Continuation == ContinueBackslash:
+			l, continued = joinContinued(l, d)
+		}
+		if d.InlineComments == QuotedInlineComments {
+			l = uncommentQuoted(l, chars)
+		}
+		size += len(raw)
+		if err := exceeded(size, limits.MaxSize, "MaxSize"); err != nil {
+			return err
+		}
+		if err := exceeded(len(bytes.TrimRight(raw, "\r\n")), limits.MaxLineLength, "MaxLineLength"); err != nil {
+			return err
+		}
+
+		var directive, arg string
+		var include bool
+		if d.Includes && d.syntax != gitSyntax {
+			directive, arg, include = d.includeDirective(l)
 		}
 
 		// switch written for readability (not performance)
 		switch {
 		case len(l) == 0: // empty line
-			continue
+			blanks++
+			c.keep(raw, docEntry{section: section})
 
-		case l[0] == '#': // comment
-			continue
+		case d.isComment(l): // comment, by default also "rem" for windows users
+			c.keep(raw, docEntry{section: section})
 
-		case l[0] == ';': // comment
-			continue
-
-		case len(l) >= 3 && strings.ToLower(l[0:3]) == "rem": // comment (for windows users)
-			continue
+		case d.Continuation == ContinueIndented && option != "" && lineIndent(raw) > indent: // continuation, even if it looks like an option
+			if err := appendLine(raw, string(l)); err != nil {
+				return err
+			}
 
 		case l[0] == '[' && l[len(l)-1] == ']': // new section
 			option = "" // reset multi-line value
-			section = strings.TrimSpace(l[1 : len(l)-1])
+			section = string(bytes.TrimSpace(l[1 : len(l)-1]))
+			sections++
+			if err := exceeded(sections, limits.MaxSections, "MaxSections"); err != nil {
+				return err
+			}
+			if d.syntax == pythonSyntax {
+				section = string(l[1 : len(l)-1])
+			}
+			if d.Duplicates == DuplicatesError {
+				key := cacheKey{c.foldSection(section), ""}
+				if seen[key] && key.section != DefaultSection {
+					return ReadError{Duplicate, "section [" + section + "]"}
+				}
+				seen[key] = true
+			}
+			if d.syntax == gitSyntax {
+				name, err := gitSection(l[1 : len(l)-1])
+				if err != nil {
+					return err
+				}
+				section = name
+			}
+			if c.logger != nil {
+				c.debugf("%s: section '%s'", Location{fname, line}, section)
+			}
 			c.AddSection(section)
+			c.keep(raw, docEntry{section: section, kind: docSection})
+
+		case include: // include directive
+			option = ""
+			c.keep(raw, docEntry{section: section})
+			if !c.document {
+				if err := c.includeDirective(directive, arg, fname); err != nil {
+					return err
+				}
+			}
+
+		case section == "" && c.document: // keep what cannot be interpreted
+			c.keep(raw, docEntry{section: section})
 
 		case section == "": // not new section and no section defined so far
-			return ReadError{BlankSection, l}
+			return ReadError{BlankSection, string(l)}
 
 		default: // other alternatives
-			i := strings.IndexAny(l, "=:")
+			i := d.optionEnd(l)
+			if d.syntax == gitSyntax && i < 0 {
+				i = len(l) // boolean shorthand
+			}
 			switch {
 			case i > 0: // option and value
-				i := strings.IndexAny(l, "=:")
-				option = strings.TrimSpace(l[0:i])
-				value := strings.TrimSpace(stripComments(l[i+1:]))
-				c.AddOption(section, option, value)
+				options++
+				if err := exceeded(options, limits.MaxOptions, "MaxOptions"); err != nil {
+					return err
+				}
+				rest := l[min(i+1, len(l)):]
+				if d.InlineComments == SpacedInlineComments {
+					rest = stripComments(rest, chars)
+				}
+				var value string
+				if c.interning {
+					option = strs.intern(bytes.TrimSpace(l[0:i]))
+					value = strs.intern(bytes.TrimSpace(rest))
+				} else {
+					ls := string(l) // names and values share this copy
+					option = strings.TrimSpace(ls[0:i])
+					value = strings.TrimSpace(ls[i+1 : i+1+len(rest)])
+				}
+				if d.syntax != gitSyntax {
+					option = d.unescapeName(option)
+				}
+				if seen != nil {
+					key := cacheKey{c.foldSection(section), c.foldOption(option)}
+					if ignored = seen[key] && d.Duplicates == DuplicatesKeepFirst; ignored {
+						indent, blanks = lineIndent(raw), 0
+						c.keep(raw, docEntry{section: section})
+						continue
+					}
+					if seen[key] {
+						return ReadError{Duplicate, "option '" + option + "' in section [" + section + "]"}
+					}
+					seen[key] = true
+				}
+				indent, blanks = lineIndent(raw), 0
+				if d.syntax == gitSyntax {
+					if !isGitName(option) {
+						return ReadError{CouldNotParse, string(l)}
+					}
+					if i == len(l) {
+						value = "true"
+					} else if value, err = gitValue(rest, d.Escapes); err != nil {
+						return err
+					}
+				}
+				kind := docOption
+				if d.Duplicates == DuplicatesAppend && value != "" { // repeated assignments add lines
+					if prev, ok := c.data[c.foldSection(section)].get(c.foldOption(option)); ok {
+						value, kind = prev+"\n"+value, docContinuation
+					}
+				}
+				added, err := c.addOption(section, option, value)
+				if err != nil {
+					return err
+				}
+				if !added && d.Duplicates != DuplicatesAppend && d.syntax != gitSyntax {
+					c.redefined = append(c.redefined, Location{fname, line})
+				}
+				optionLine = line
+				c.setLocation(section, option, Location{fname, optionLine})
+				c.keep(raw, docEntry{section: section, option: option, kind: kind, value: value})
+				if d.syntax == gitSyntax && d.Includes && !c.document && c.foldSection(section) == "include" && c.foldOption(option) == "path" {
+					if err := c.include(value, fname, true); err != nil {
+						return err
+					}
+				}
 
-			case section != "" && option != "": // continuation of multi-line value
-				prev, _ := c.GetRawString(section, option)
-				value := strings.TrimSpace(stripComments(l))
-				c.AddOption(section, option, prev+"\n"+value)
+			case section != "" && option != "" && d.Continuation == ContinueBareLines: // continuation of multi-line value
+				blanks = 0
+				if d.InlineComments == SpacedInlineComments {
+					// unless what remains would read back as a section header
+					if s := bytes.TrimSpace(stripComments(l, chars)); s[0] != '[' || s[len(s)-1] != ']' {
+						l = s
+					}
+				}
+				if err := appendLine(raw, string(bytes.TrimSpace(l))); err != nil {
+					return err
+				}
+
+			case c.document: // keep what cannot be interpreted
+				c.keep(raw, docEntry{section: section})
 
 			default:
-				return ReadError{CouldNotParse, l}
+				return ReadError{CouldNotParse, string(l)}
 			}
 		}
+	}
 
-		// Reached end of file
-		if buferr == io.EOF {
-			break
+	if err := scanner.Err(); err != bufio.ErrTooLong {
+		if err == nil {
+			c.debugf("%s: read %d lines, %d sections, %d options", Location{fname, 0}, line, sections, options)
 		}
+		return err
+	}
+	return ReadError{LimitExceeded, "MaxLineLength"}
+}
+
+// lineIndent returns the number of white space characters the raw line starts with.
+func lineIndent(raw []byte) int {
+	return len(raw) - len(bytes.TrimLeft(raw, " \t\f\v"))
+}
+
+// maxLineLength limits the length of the lines read.
+const maxLineLength = 1 << 30
+
+// scanRawLines is a bufio.SplitFunc like bufio.ScanLines, except that lines
+// include their terminators, which document mode keeps.
+func scanRawLines(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		return i + 1, data[:i+1], nil
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// wrapReadError prefixes a non-nil *err with the name of the file being read.
+func wrapReadError(fname string, err *error) {
+	if *err != nil {
+		*err = fmt.Errorf("reading config %s: %w", fname, *err)
+	}
+}
+
+// interned maps strings to their first copy, see SetInterning.
+type interned map[string]string
+
+// intern returns the copy of b in m, adding one if there is none.
+func (m *interned) intern(b []byte) string {
+	if s, ok := (*m)[string(b)]; ok {
+		return s
+	}
+	if *m == nil {
+		*m = make(interned)
 	}
-	return nil
+	s := string(b)
+	(*m)[s] = s
+	return s
 }
 
-func stripComments(l string) string {
-	// comments are preceded by space or TAB
-	for _, c := range []string{" ;", "\t;", " #", "\t#"} {
-		if i := strings.Index(l, c); i != -1 {
-			l = l[0:i]
+// stripComments cuts l at the first comment, which starts with one of chars
+// preceded by space or TAB.
+func stripComments[S string | []byte](l S, chars string) S {
+	for i := 1; i < len(l); i++ {
+		if strings.IndexByte(chars, l[i]) >= 0 && (l[i-1] == ' ' || l[i-1] == '\t') {
+			return l[:i-1]
 		}
 	}
 	return l
@@ -0,0 +1,41 @@
+package conf
+
+import (
+	"bytes"
+	"path"
+)
+
+// RedactPatterns are the patterns used by StringRedacted if none are given.
+var RedactPatterns = []string{"*password*", "*token*", "*secret*"}
+
+// StringRedacted renders the configuration as Write does, but with the values
+// of options whose names match any of the patterns replaced by asterisks. This
+// makes the configuration safe to log. The patterns use the syntax of
+// path.Match and are matched against lower-case option names; if no patterns
+// are given, RedactPatterns are used.
+func (c *ConfigFile) StringRedacted(patterns ...string) string {
+	if len(patterns) == 0 {
+		patterns = RedactPatterns
+	}
+
+	buf := bytes.NewBuffer(nil)
+	c.write(buf, "", nil, func(section, option, value string) string {
+		if matchAny(patterns, option) {
+			return "********"
+		}
+		return value
+	})
+
+	return buf.String()
+}
+
+// matchAny checks if name matches any of the path.Match patterns.
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+
+	return false
+}
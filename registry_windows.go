@@ -0,0 +1,217 @@
+package conf
+
+import (
+	"strconv"
+	"strings"
+	"syscall"
+	"unicode/utf16"
+	"unsafe"
+)
+
+var (
+	advapi32            = syscall.NewLazyDLL("advapi32.dll")
+	procRegEnumValueW   = advapi32.NewProc("RegEnumValueW")
+	procRegCreateKeyExW = advapi32.NewProc("RegCreateKeyExW")
+	procRegSetValueExW  = advapi32.NewProc("RegSetValueExW")
+)
+
+// ReadRegistry reads the values stored below the key path under root, such as
+// syscall.HKEY_CURRENT_USER and `Software\MyApp`, and returns a new
+// configuration representation. Values of the key itself belong to the default
+// section; each subkey is a section holding the values of that subkey. Deeper
+// subkeys are ignored. String values are taken as they are, without expanding
+// environment variables; multi-string values are joined by newlines into
+// multi-line values; DWORD and QWORD values are converted to decimal numbers.
+// Values of other types and the unnamed default value of a key are ignored.
+func ReadRegistry(root syscall.Handle, path string) (c *ConfigFile, err error) {
+	defer func() { metrics.ConfigRead(err) }()
+
+	key, err := openKey(root, path)
+	if err != nil {
+		return nil, err
+	}
+	defer syscall.RegCloseKey(key)
+
+	c = NewConfigFile()
+	if err = readValues(c, key, DefaultSection); err != nil {
+		return nil, err
+	}
+
+	subkeys, err := subkeyNames(key)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range subkeys {
+		sub, err := openKey(key, name)
+		if err != nil {
+			return nil, err
+		}
+		c.AddSection(name)
+		err = readValues(c, sub, name)
+		syscall.RegCloseKey(sub)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+// WriteRegistry stores the configuration below the key path under root, in
+// the layout read by ReadRegistry, creating keys as needed. Raw values are
+// stored as strings, multi-line values as multi-strings. Values and subkeys
+// already stored which the configuration lacks are left alone.
+func (c *ConfigFile) WriteRegistry(root syscall.Handle, path string) error {
+	for _, section := range c.sections {
+		s := c.data[section]
+		if section == DefaultSection && s.len() == 0 {
+			continue
+		}
+
+		keyPath := path
+		if section != DefaultSection {
+			keyPath += `\` + section
+		}
+		key, err := createKey(root, keyPath)
+		if err != nil {
+			return err
+		}
+		for _, option := range s.keys() {
+			value, _ := s.get(option)
+			if err = setValue(key, option, value); err != nil {
+				break
+			}
+		}
+		syscall.RegCloseKey(key)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func openKey(parent syscall.Handle, path string) (key syscall.Handle, err error) {
+	p, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, err
+	}
+	err = syscall.RegOpenKeyEx(parent, p, 0, syscall.KEY_READ, &key)
+	return key, err
+}
+
+func createKey(parent syscall.Handle, path string) (key syscall.Handle, err error) {
+	p, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, err
+	}
+	var disposition uint32
+	r, _, _ := procRegCreateKeyExW.Call(uintptr(parent), uintptr(unsafe.Pointer(p)), 0, 0, 0,
+		syscall.KEY_READ|syscall.KEY_WRITE, 0, uintptr(unsafe.Pointer(&key)), uintptr(unsafe.Pointer(&disposition)))
+	if r != 0 {
+		return 0, syscall.Errno(r)
+	}
+	return key, nil
+}
+
+// subkeyNames returns the names of the subkeys of key.
+func subkeyNames(key syscall.Handle) (names []string, err error) {
+	var count, maxLen uint32
+	if err = syscall.RegQueryInfoKey(key, nil, nil, nil, &count, &maxLen, nil, nil, nil, nil, nil, nil); err != nil {
+		return nil, err
+	}
+
+	buf := make([]uint16, maxLen+1)
+	for i := uint32(0); i < count; i++ {
+		n := uint32(len(buf))
+		if err = syscall.RegEnumKeyEx(key, i, &buf[0], &n, nil, nil, nil, nil); err != nil {
+			return nil, err
+		}
+		names = append(names, syscall.UTF16ToString(buf[:n]))
+	}
+
+	return names, nil
+}
+
+// readValues adds the values of key to the section.
+func readValues(c *ConfigFile, key syscall.Handle, section string) error {
+	var count, maxNameLen, maxLen uint32
+	if err := syscall.RegQueryInfoKey(key, nil, nil, nil, nil, nil, nil, &count, &maxNameLen, &maxLen, nil, nil); err != nil {
+		return err
+	}
+
+	name := make([]uint16, maxNameLen+1)
+	data := make([]byte, maxLen+2)
+	for i := uint32(0); i < count; i++ {
+		n, size := uint32(len(name)), uint32(len(data))
+		var typ uint32
+		r, _, _ := procRegEnumValueW.Call(uintptr(key), uintptr(i), uintptr(unsafe.Pointer(&name[0])), uintptr(unsafe.Pointer(&n)),
+			0, uintptr(unsafe.Pointer(&typ)), uintptr(unsafe.Pointer(&data[0])), uintptr(unsafe.Pointer(&size)))
+		if r != 0 {
+			return syscall.Errno(r)
+		}
+		if n == 0 {
+			continue // default value of the key
+		}
+
+		var value string
+		switch typ {
+		case syscall.REG_SZ, syscall.REG_EXPAND_SZ:
+			value = decodeUTF16(data[:size])
+		case syscall.REG_MULTI_SZ:
+			value = strings.Join(strings.Split(strings.TrimRight(decodeUTF16(data[:size]), "\x00"), "\x00"), "\n")
+		case syscall.REG_DWORD:
+			if size < 4 {
+				continue
+			}
+			value = strconv.FormatUint(uint64(*(*uint32)(unsafe.Pointer(&data[0]))), 10)
+		case syscall.REG_QWORD:
+			if size < 8 {
+				continue
+			}
+			value = strconv.FormatUint(*(*uint64)(unsafe.Pointer(&data[0])), 10)
+		default:
+			continue
+		}
+		if _, err := c.addOption(section, syscall.UTF16ToString(name[:n]), value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// decodeUTF16 decodes registry string data, keeping the NULs separating the
+// strings of a multi-string but dropping the terminating one.
+func decodeUTF16(data []byte) string {
+	u := make([]uint16, len(data)/2)
+	for i := range u {
+		u[i] = uint16(data[2*i]) | uint16(data[2*i+1])<<8
+	}
+	if len(u) > 0 && u[len(u)-1] == 0 {
+		u = u[:len(u)-1]
+	}
+	return string(utf16.Decode(u))
+}
+
+// setValue stores the value as a string, or as a multi-string if it spans lines.
+func setValue(key syscall.Handle, option string, value string) error {
+	name, err := syscall.UTF16PtrFromString(option)
+	if err != nil {
+		return err
+	}
+
+	typ := uint32(syscall.REG_SZ)
+	if strings.Contains(value, "\n") {
+		typ = syscall.REG_MULTI_SZ
+		value = strings.ReplaceAll(value, "\n", "\x00") + "\x00"
+	}
+	data := utf16.Encode([]rune(value + "\x00"))
+
+	r, _, _ := procRegSetValueExW.Call(uintptr(key), uintptr(unsafe.Pointer(name)), 0, uintptr(typ),
+		uintptr(unsafe.Pointer(&data[0])), uintptr(len(data)*2))
+	if r != 0 {
+		return syscall.Errno(r)
+	}
+	return nil
+}
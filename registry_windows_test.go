@@ -0,0 +1,74 @@
+package conf_test
+
+import (
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+	"unsafe"
+
+	. "github.com/akrennmair/goconf"
+)
+
+var (
+	advapi32          = syscall.NewLazyDLL("advapi32.dll")
+	procRegDeleteTree = advapi32.NewProc("RegDeleteTreeW")
+	procRegSetValueEx = advapi32.NewProc("RegSetValueExW")
+)
+
+// scratchKey returns the path of a key under HKEY_CURRENT_USER which is
+// deleted when the test ends.
+func scratchKey(t *testing.T) string {
+	path := `Software\goconf-test-` + strconv.FormatInt(time.Now().UnixNano(), 36)
+	t.Cleanup(func() {
+		p, _ := syscall.UTF16PtrFromString(path)
+		procRegDeleteTree.Call(uintptr(syscall.HKEY_CURRENT_USER), uintptr(unsafe.Pointer(p)))
+	})
+	return path
+}
+
+func TestRegistry(t *testing.T) {
+	path := scratchKey(t)
+
+	c := NewConfigFile()
+	c.AddOption("default", "host", "example.com")
+	c.AddOption("service-1", "url", "http://%(host)s/")
+	c.AddOption("service-1", "servers", "a\nb")
+	if err := c.WriteRegistry(syscall.HKEY_CURRENT_USER, path); err != nil {
+		t.Fatal(err)
+	}
+
+	// a DWORD value, as written by other programs
+	var key syscall.Handle
+	p, _ := syscall.UTF16PtrFromString(path + `\service-1`)
+	if err := syscall.RegOpenKeyEx(syscall.HKEY_CURRENT_USER, p, 0, syscall.KEY_WRITE, &key); err != nil {
+		t.Fatal(err)
+	}
+	name, _ := syscall.UTF16PtrFromString("port")
+	port := uint32(443)
+	r, _, _ := procRegSetValueEx.Call(uintptr(key), uintptr(unsafe.Pointer(name)), 0, syscall.REG_DWORD,
+		uintptr(unsafe.Pointer(&port)), 4)
+	syscall.RegCloseKey(key)
+	if r != 0 {
+		t.Fatal(syscall.Errno(r))
+	}
+
+	read, err := ReadRegistry(syscall.HKEY_CURRENT_USER, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []stringtest{
+		{"default", "host", "example.com"},
+		{"service-1", "url", "http://example.com/"},
+		{"service-1", "servers", "a\nb"},
+		{"service-1", "port", "443"},
+	} {
+		if v, err := read.GetString(test.section, test.option); err != nil || v != test.answer {
+			t.Errorf("GetString(%q, %q) = %q, %v; want %q", test.section, test.option, v, err, test.answer)
+		}
+	}
+
+	if _, err := ReadRegistry(syscall.HKEY_CURRENT_USER, path+`\missing`); err == nil {
+		t.Error("ReadRegistry of a missing key succeeded")
+	}
+}
@@ -0,0 +1,94 @@
+package conf
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+)
+
+// Reloader holds the configuration read from a file and replaces it atomically
+// whenever the file is reloaded. It implements the classic "kill -HUP to reload
+// the configuration" pattern:
+//
+//	r, err := conf.NewReloader("/etc/app.conf")
+//	r.HandleSIGHUP(func(err error) { log.Print(err) })
+//	c := r.Load() // wherever the current configuration is needed
+type Reloader struct {
+	// If set, a reloaded configuration only replaces the current one if it passes.
+	Validate func(*ConfigFile) error
+
+	path    string
+	current atomic.Value // *ConfigFile
+	mu      sync.Mutex   // Serializes reloads.
+	signals chan os.Signal
+}
+
+// NewReloader reads the configuration file at path and returns a Reloader holding it.
+func NewReloader(path string) (*Reloader, error) {
+	c, err := ReadConfigFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Reloader{path: path}
+	r.current.Store(c)
+
+	return r, nil
+}
+
+// Load returns the current configuration. It is safe to call concurrently with
+// reloads; callers keep the configuration they loaded until they call Load again.
+func (r *Reloader) Load() *ConfigFile {
+	return r.current.Load().(*ConfigFile)
+}
+
+// Reload rereads the configuration file and, if it can be parsed and validated,
+// makes it the current configuration. Otherwise the current configuration is kept
+// and the error is returned.
+func (r *Reloader) Reload() (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	defer func() { metrics.ConfigReloaded(err) }()
+
+	c, err := ReadConfigFile(r.path)
+	if err != nil {
+		return err
+	}
+	if r.Validate != nil {
+		if err = r.Validate(c); err != nil {
+			metrics.ValidationFailed("", "")
+			return err
+		}
+	}
+	r.current.Store(c)
+
+	return nil
+}
+
+// HandleSIGHUP reloads the configuration whenever the process receives SIGHUP.
+// Reload errors are passed to errfn, which may be nil. Calling HandleSIGHUP
+// again replaces errfn.
+func (r *Reloader) HandleSIGHUP(errfn func(error)) {
+	r.Stop()
+
+	r.signals = make(chan os.Signal, 1)
+	signal.Notify(r.signals, syscall.SIGHUP)
+	go func(signals chan os.Signal) {
+		for range signals {
+			if err := r.Reload(); err != nil && errfn != nil {
+				errfn(err)
+			}
+		}
+	}(r.signals)
+}
+
+// Stop stops reloading the configuration on SIGHUP.
+func (r *Reloader) Stop() {
+	if r.signals != nil {
+		signal.Stop(r.signals)
+		close(r.signals)
+		r.signals = nil
+	}
+}
@@ -0,0 +1,158 @@
+package conf
+
+import (
+	"bytes"
+	"os"
+	"sort"
+)
+
+// ChangeKind tells how a reload changed an option, see Change.
+type ChangeKind int
+
+const (
+	OptionAdded    ChangeKind = iota // The option is new.
+	OptionModified                   // The value of the option changed.
+	OptionRemoved                    // The option or its section was removed.
+)
+
+// Change describes an option changed by a reload, see WatchOptions.OnChange.
+type Change struct {
+	Kind    ChangeKind
+	Section string
+	Option  string
+	Old     string // Raw value before the reload, "" if the option was added.
+	New     string // Raw value after the reload, "" if the option was removed.
+}
+
+// reparser reads a file repeatedly, parsing only the sections whose text changed
+// since the last accepted read. The sections it parsed are shared with the
+// configurations it returns, which copy them before they are modified.
+type reparser struct {
+	fname    string
+	sections map[string]*parsedSection // As of the last accepted read.
+	next     map[string]*parsedSection // As of the last read, see accept.
+}
+
+// parsedSection is the result of parsing the text of a section.
+type parsedSection struct {
+	bodies    []pendingBody
+	s         *section
+	redefined []Location
+}
+
+// read reads the file and returns the configuration and the options changed
+// since the last accepted read.
+func (r *reparser) read() (c *ConfigFile, changes []Change, err error) {
+	defer wrapReadError(r.fname, &err)
+	defer func() { metrics.ConfigRead(err) }()
+
+	data, err := os.ReadFile(r.fname)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var order []string
+	bodies := make(map[string][]pendingBody)
+	err = splitSections(data, Limits{}, func(section string, text []byte, line int) {
+		if _, ok := bodies[section]; !ok {
+			order = append(order, section)
+		}
+		bodies[section] = append(bodies[section], pendingBody{text, line})
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	c = NewConfigFile()
+	c.shared = make(map[string]bool, len(order))
+	r.next = make(map[string]*parsedSection, len(order))
+	for _, name := range order {
+		old := r.sections[name]
+		p := old.update(bodies[name])
+		if p == nil {
+			p = &parsedSection{bodies: bodies[name]}
+			p.s, p.redefined = parseSection(name, p.bodies, r.fname, true, nil)
+			if p.s == nil {
+				p.s = newSection(0)
+			}
+			var before *section
+			if old != nil {
+				before = old.s
+			}
+			changes = append(changes, diffSection(name, before, p.s)...)
+		}
+
+		c.AddSection(name)
+		c.data[name] = p.s
+		c.shared[name] = true
+		c.redefined = append(c.redefined, p.redefined...)
+		r.next[name] = p
+	}
+	var removed []string
+	for name := range r.sections {
+		if r.next[name] == nil {
+			removed = append(removed, name)
+		}
+	}
+	sort.Strings(removed)
+	for _, name := range removed {
+		changes = append(changes, diffSection(name, r.sections[name].s, nil)...)
+	}
+
+	return c, changes, nil
+}
+
+// accept makes the last read the one the next read is compared with.
+func (r *reparser) accept() {
+	r.sections, r.next = r.next, nil
+}
+
+// update returns the section parsed from bodies if they have the same text as
+// those p was parsed from, with its locations shifted to the lines of bodies.
+// It returns nil if p is nil or the text changed.
+func (p *parsedSection) update(bodies []pendingBody) *parsedSection {
+	if p == nil || len(p.bodies) != len(bodies) {
+		return nil
+	}
+	shift := bodies[0].line - p.bodies[0].line
+	for i, b := range bodies {
+		if !bytes.Equal(b.text, p.bodies[i].text) || b.line-p.bodies[i].line != shift {
+			return nil
+		}
+	}
+	if shift == 0 {
+		return p
+	}
+
+	dup := &parsedSection{bodies: bodies, s: p.s.copy()}
+	for option, loc := range dup.s.locations {
+		loc.Line += shift
+		dup.s.locations[option] = loc
+	}
+	for _, loc := range p.redefined {
+		loc.Line += shift
+		dup.redefined = append(dup.redefined, loc)
+	}
+
+	return dup
+}
+
+// diffSection returns the changes from the options of before to those of after,
+// either of which may be nil.
+func diffSection(name string, before *section, after *section) (changes []Change) {
+	for _, option := range after.keys() {
+		value := after.values[option]
+		if old, ok := before.get(option); !ok {
+			changes = append(changes, Change{OptionAdded, name, option, "", value})
+		} else if old != value {
+			changes = append(changes, Change{OptionModified, name, option, old, value})
+		}
+	}
+	for _, option := range before.keys() {
+		if _, ok := after.get(option); !ok {
+			changes = append(changes, Change{OptionRemoved, name, option, before.values[option], ""})
+		}
+	}
+
+	return changes
+}
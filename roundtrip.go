@@ -0,0 +1,103 @@
+package conf
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// Normalize changes the configuration to what reading back its output would
+// return: sections and options are kept in their order, but values are
+// changed, and options and sections removed, as Write and Read would change
+// them, such as values ending in white space, which Read trims. Afterwards
+// Write is stable, as described for CheckRoundTrip, and tools rewriting the
+// files they read rewrite them the same way every time. Normalize returns an
+// error, leaving the configuration unchanged, if its output cannot be read
+// back, such as multi-line values in a dialect without continuation.
+func (c *ConfigFile) Normalize() error {
+	d, err := c.readBack(c.WriteConfigBytes(""))
+	if err != nil {
+		return err
+	}
+
+	c.beginBatch()
+	defer c.endBatch()
+
+	for _, section := range append([]string(nil), c.sections...) {
+		if _, ok := d.data[section]; !ok {
+			c.RemoveSection(section)
+			continue
+		}
+		for _, option := range append([]string(nil), c.data[section].keys()...) {
+			if _, ok := d.data[section].get(option); !ok {
+				c.RemoveOption(section, option)
+			}
+		}
+	}
+	for _, section := range d.sections {
+		for _, option := range d.data[section].keys() {
+			value, _ := d.data[section].get(option)
+			if prev, ok := c.data[section].get(option); !ok || prev != value {
+				if err = c.SetOption(section, option, value); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	if c.document {
+		c.doc = d.doc
+	}
+
+	return nil
+}
+
+// readBack reads the output of the configuration in its dialect and mode.
+func (c *ConfigFile) readBack(written []byte) (*ConfigFile, error) {
+	d := NewConfigFile()
+	d.dialect = c.dialect
+	d.SetDocumentMode(c.document)
+	if err := d.Read(bytes.NewReader(written)); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// CheckRoundTrip checks that writing what Read returns for data is stable, as
+// this package guarantees for any input Read accepts: the configuration read
+// from data is written, read back and written again, and both outputs must be
+// the same, byte for byte, so that the order of sections and options and the
+// quoting and escaping of values survive any number of rewrites. The data is
+// read in the dialect given, if any, see ReadConfigBytes, and written in the
+// same one.
+//
+// It returns the error reading data, if any, or an error describing the first
+// line written differently. Tools writing configurations can call it on the
+// files they produce, and tests on their inputs.
+func CheckRoundTrip(data []byte, dialect ...Dialect) error {
+	c, err := ReadConfigBytes(data, dialect...)
+	if err != nil {
+		return err
+	}
+	written := c.WriteConfigBytes("")
+	d, err := c.readBack(written)
+	if err != nil {
+		return fmt.Errorf("reading back output %q: %w", written, err)
+	}
+	again := d.WriteConfigBytes("")
+	if bytes.Equal(again, written) {
+		return nil
+	}
+
+	first, second := bytes.SplitAfter(written, []byte("\n")), bytes.SplitAfter(again, []byte("\n"))
+	line := 0
+	for line < len(first) && line < len(second) && bytes.Equal(first[line], second[line]) {
+		line++
+	}
+	var was, is []byte
+	if line < len(first) {
+		was = first[line]
+	}
+	if line < len(second) {
+		is = second[line]
+	}
+	return fmt.Errorf("output not stable: line %d written as %q, then as %q", line+1, was, is)
+}
@@ -0,0 +1,477 @@
+package conf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ValueType is the type of an option's value as declared in a Schema.
+type ValueType int
+
+const (
+	StringType ValueType = iota
+	IntType
+	FloatType
+	BoolType
+)
+
+var valueTypeNames = []string{"string", "int", "float", "bool"}
+
+func (t ValueType) String() string {
+	if t < 0 || int(t) >= len(valueTypeNames) {
+		return fmt.Sprintf("ValueType(%d)", int(t))
+	}
+	return valueTypeNames[t]
+}
+
+func (t ValueType) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+// UnmarshalText parses the names returned by String, so that schemas can be
+// stored as JSON.
+func (t *ValueType) UnmarshalText(text []byte) error {
+	for i, name := range valueTypeNames {
+		if name == string(text) {
+			*t = ValueType(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown value type '%s'", string(text))
+}
+
+// Range is an inclusive numeric range. Use math.Inf for open ends.
+type Range struct {
+	Min, Max float64
+}
+
+// OptionSpec declares the constraints on one option.
+type OptionSpec struct {
+	Section  string    // Section name; "" means the default section.
+	Option   string    // Option name.
+	Type     ValueType // Type the value must parse as.
+	Required bool      // Whether the option must be present.
+	Allowed  []string  // If not empty, the values the option may take.
+	Range    *Range    // If not nil, the bounds of a numeric value.
+	Unit     Unit      // Unit of a numeric value, which may be given with a suffix.
+
+	Default     string // Value used if the option is missing; "" means none.
+	Description string // Documentation for sample configurations and references.
+}
+
+// Schema declares the options a configuration is expected to have. Besides
+// validating configurations, a schema provides their defaults and documentation,
+// see SetDefaults, WriteSample and WriteMarkdown.
+//
+//	s := &conf.Schema{Options: []conf.OptionSpec{
+//		{Section: "service-1", Option: "port", Type: conf.IntType, Required: true, Range: &conf.Range{1, 65535}},
+//		{Section: "service-1", Option: "mode", Allowed: []string{"fast", "safe"}},
+//	}}
+//	err := c.Validate(s)
+//
+// Constraints spanning options are expressed as Rules, such as those returned
+// by RequiredIf and Ordered:
+//
+//	s.Rules = []conf.Rule{
+//		conf.RequiredIf("server", "tls", "on", "cert-file", "key-file"),
+//		conf.Ordered("workers", "min-workers", "max-workers"),
+//	}
+type Schema struct {
+	Options []OptionSpec
+	Rules   []Rule `json:"-"` // Checked by Validate after the options.
+}
+
+// Rule checks a constraint spanning options. It returns a ValidationError
+// listing the options violating it, another error describing the problem, or
+// nil if the configuration satisfies it.
+type Rule func(c *ConfigFile) error
+
+// SetDefaults registers the defaults declared in the schema with c, see SetDefault.
+func (s *Schema) SetDefaults(c *ConfigFile) {
+	for _, spec := range s.Options {
+		if spec.Default != "" {
+			c.SetDefault(spec.Section, spec.Option, spec.Default)
+		}
+	}
+}
+
+// sections returns the lower-case section names of the schema in the order
+// of their first appearance, and the specs declared for each of them.
+func (s *Schema) sections() (names []string, specs map[string][]OptionSpec) {
+	specs = make(map[string][]OptionSpec)
+	for _, spec := range s.Options {
+		section := foldCase(spec.Section)
+		if section == "" {
+			section = DefaultSection
+		}
+		if _, ok := specs[section]; !ok {
+			names = append(names, section)
+		}
+		specs[section] = append(specs[section], spec)
+	}
+
+	return names, specs
+}
+
+// constraints describes the type and constraints of the option in a few phrases.
+func (spec OptionSpec) constraints() (phrases []string) {
+	phrases = append(phrases, "type "+spec.Type.String())
+	if spec.Required {
+		phrases = append(phrases, "required")
+	}
+	if len(spec.Allowed) > 0 {
+		phrases = append(phrases, "one of "+strings.Join(spec.Allowed, ", "))
+	}
+	if spec.Range != nil {
+		phrases = append(phrases, fmt.Sprintf("range %g to %g", spec.Range.Min, spec.Range.Max))
+	}
+	if spec.Unit != NoUnit {
+		phrases = append(phrases, "in "+spec.Unit.String())
+	}
+	if spec.Default != "" {
+		phrases = append(phrases, "default "+spec.Default)
+	}
+
+	return phrases
+}
+
+// WriteSample writes an example configuration file documenting every option
+// of the schema in comments. Options with a default are written commented out,
+// required options without a default are left for the user to fill in.
+func (s *Schema) WriteSample(w io.Writer) error {
+	buf := bytes.NewBuffer(nil)
+
+	names, specs := s.sections()
+	for i, section := range names {
+		if i > 0 {
+			buf.WriteString("\n")
+		}
+		buf.WriteString("[" + section + "]\n")
+		for _, spec := range specs[section] {
+			buf.WriteString("\n")
+			for _, line := range strings.Split(spec.Description, "\n") {
+				if line != "" {
+					buf.WriteString("# " + line + "\n")
+				}
+			}
+			buf.WriteString("# (" + strings.Join(spec.constraints(), "; ") + ")\n")
+
+			if spec.Required && spec.Default == "" {
+				buf.WriteString(foldCase(spec.Option) + " = \n")
+			} else {
+				buf.WriteString("# " + foldCase(spec.Option) + " = " + spec.Default + "\n")
+			}
+		}
+	}
+
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+// WriteMarkdown writes a reference document describing every option of the schema in Markdown.
+func (s *Schema) WriteMarkdown(w io.Writer) error {
+	buf := bytes.NewBuffer(nil)
+
+	buf.WriteString("# Configuration reference\n")
+	names, specs := s.sections()
+	for _, section := range names {
+		buf.WriteString("\n## [" + section + "]\n")
+		for _, spec := range specs[section] {
+			buf.WriteString("\n### " + foldCase(spec.Option) + "\n\n")
+			if spec.Description != "" {
+				buf.WriteString(spec.Description + "\n\n")
+			}
+			buf.WriteString("- Type: " + spec.Type.String() + "\n")
+			if spec.Unit != NoUnit {
+				buf.WriteString("- Unit: " + spec.Unit.String() + "\n")
+			}
+			if spec.Required {
+				buf.WriteString("- Required\n")
+			}
+			if spec.Default != "" {
+				buf.WriteString("- Default: `" + spec.Default + "`\n")
+			}
+			if len(spec.Allowed) > 0 {
+				buf.WriteString("- Allowed values: `" + strings.Join(spec.Allowed, "`, `") + "`\n")
+			}
+			if spec.Range != nil {
+				buf.WriteString(fmt.Sprintf("- Range: %g to %g\n", spec.Range.Min, spec.Range.Max))
+			}
+		}
+	}
+
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+// Violation describes an option which does not satisfy its OptionSpec.
+type Violation struct {
+	Section  string
+	Option   string
+	Problem  string
+	Location Location // Where the option was read from, if it was.
+}
+
+func (v Violation) String() string {
+	s := v.Problem
+	if v.Option != "" {
+		s = fmt.Sprintf("option '%s' in section '%s': %s", v.Option, v.Section, v.Problem)
+	}
+	if v.Location != (Location{}) {
+		s = v.Location.String() + ": " + s
+	}
+	return s
+}
+
+// ValidationError lists all violations found by Validate.
+type ValidationError struct {
+	Violations []Violation
+}
+
+func (err ValidationError) Error() string {
+	problems := make([]string, len(err.Violations))
+	for i, v := range err.Violations {
+		problems[i] = v.String()
+	}
+
+	return "invalid configuration: " + strings.Join(problems, "; ")
+}
+
+// Validate checks the configuration against the schema, first its options and
+// then its rules. Values are looked up as by GetString, so defaults and
+// environment overrides are validated too. It returns a ValidationError listing
+// every violation, along with where the option was read from, or nil if there
+// is none. Errors of rules other than ValidationError are listed as violations
+// without an option.
+func (c *ConfigFile) Validate(s *Schema) error {
+	var violations []Violation
+
+	for _, spec := range s.Options {
+		section := c.foldSection(spec.Section)
+		if section == "" {
+			section = DefaultSection
+		}
+		option := c.foldOption(spec.Option)
+
+		if problem := c.check(section, option, spec); problem != "" {
+			loc, _ := c.Source(section, option)
+			violations = append(violations, Violation{section, option, problem, loc})
+		}
+	}
+	for _, rule := range s.Rules {
+		var verr ValidationError
+		if err := rule(c); errors.As(err, &verr) {
+			violations = append(violations, verr.Violations...)
+		} else if err != nil {
+			violations = append(violations, Violation{Problem: err.Error()})
+		}
+	}
+
+	if len(violations) > 0 {
+		return ValidationError{violations}
+	}
+	return nil
+}
+
+// RequiredIf returns a rule requiring the options listed as required to be set
+// in the section if the option is set to value, e.g. the files of a
+// certificate and its key if TLS is on. Values which are both bools, see
+// BoolStrings, are compared as bools.
+func RequiredIf(section string, option string, value string, required ...string) Rule {
+	return func(c *ConfigFile) error {
+		section := c.foldSection(section)
+		if section == "" {
+			section = DefaultSection
+		}
+		actual, err := c.GetString(section, option)
+		if err != nil || !sameValue(actual, value) {
+			return nil
+		}
+
+		var violations []Violation
+		for _, name := range required {
+			name = c.foldOption(name)
+			if _, err := c.GetString(section, name); err != nil {
+				problem := fmt.Sprintf("required option is missing, as '%s' is %s", c.foldOption(option), value)
+				violations = append(violations, Violation{section, name, problem, Location{}})
+			}
+		}
+		if len(violations) > 0 {
+			return ValidationError{violations}
+		}
+		return nil
+	}
+}
+
+// sameValue reports whether the values are equal, or both bools of the same value.
+func sameValue(a string, b string) bool {
+	if a == b {
+		return true
+	}
+	x, xok := BoolStrings[strings.ToLower(a)]
+	y, yok := BoolStrings[strings.ToLower(b)]
+	return xok && yok && x == y
+}
+
+// Ordered returns a rule requiring the numeric values of the options in the
+// section not to decrease in the order listed, e.g. a minimum not to exceed
+// the corresponding maximum. Missing options are skipped; values which are
+// not numbers are left to the checks of their OptionSpec.
+func Ordered(section string, options ...string) Rule {
+	return func(c *ConfigFile) error {
+		section := c.foldSection(section)
+		if section == "" {
+			section = DefaultSection
+		}
+
+		var violations []Violation
+		var prev string
+		var max float64
+		for _, option := range options {
+			option = c.foldOption(option)
+			value, err := c.GetFloat64(section, option)
+			if err != nil {
+				continue
+			}
+			if prev != "" && value < max {
+				loc, _ := c.Source(section, option)
+				problem := fmt.Sprintf("value %g is less than %g of '%s'", value, max, prev)
+				violations = append(violations, Violation{section, option, problem, loc})
+				continue
+			}
+			prev, max = option, value
+		}
+		if len(violations) > 0 {
+			return ValidationError{violations}
+		}
+		return nil
+	}
+}
+
+// check returns the problem with the option, or "" if it satisfies spec.
+func (c *ConfigFile) check(section string, option string, spec OptionSpec) string {
+	value, err := c.GetString(section, option)
+	if err != nil {
+		if errors.Is(err, ErrSectionNotFound) || errors.Is(err, ErrOptionNotFound) {
+			if spec.Required {
+				return "required option is missing"
+			}
+			return ""
+		}
+		return err.Error()
+	}
+
+	var number float64
+	switch {
+	case spec.Unit != NoUnit && (spec.Type == IntType || spec.Type == FloatType):
+		number, err = spec.Unit.parse(value)
+		if err != nil || (spec.Type == IntType && number != math.Trunc(number)) {
+			return fmt.Sprintf("value '%s' is not a number of %s", value, spec.Unit)
+		}
+	case spec.Type == IntType:
+		n, err := c.GetInt(section, option)
+		if err != nil {
+			return "value '" + value + "' is not an int"
+		}
+		number = float64(n)
+	case spec.Type == FloatType:
+		if number, err = c.GetFloat64(section, option); err != nil {
+			return "value '" + value + "' is not a float"
+		}
+	case spec.Type == BoolType:
+		if _, err = c.GetBool(section, option); err != nil {
+			return "value '" + value + "' is not a bool"
+		}
+	}
+
+	if len(spec.Allowed) > 0 {
+		allowed := false
+		for _, a := range spec.Allowed {
+			allowed = allowed || a == value
+		}
+		if !allowed {
+			return fmt.Sprintf("value '%s' is not one of %s", value, strings.Join(spec.Allowed, ", "))
+		}
+	}
+
+	if spec.Range != nil && (spec.Type == IntType || spec.Type == FloatType) {
+		if number < spec.Range.Min || number > spec.Range.Max {
+			return fmt.Sprintf("value %s is out of range [%g, %g]", value, spec.Range.Min, spec.Range.Max)
+		}
+	}
+
+	return ""
+}
+
+// SetSchema attaches a schema which Read validates the configuration against
+// after every file read, so that invalid configurations fail to load rather
+// than when their options are eventually looked up. Read then returns the
+// ValidationError of Validate, which lists every violation with the line it
+// was read from. The values read of valid int, float and bool options are
+// coerced to decimal integers, floats as formatted by strconv.FormatFloat
+// and "true" or "false", except for values with placeholders and in document
+// mode, which keeps values as written. GetInt and GetFloat64 convert values of
+// options with a Unit, which values read are coerced to. A nil schema detaches
+// it.
+func (c *ConfigFile) SetSchema(s *Schema) {
+	c.schema = s
+	c.units = nil
+	if s != nil {
+		c.units = c.schemaUnits(s)
+	}
+}
+
+// coerce validates the configuration against the schema and coerces the typed
+// values read, see SetSchema.
+func (c *ConfigFile) coerce(s *Schema) error {
+	if err := c.Validate(s); err != nil {
+		return err
+	}
+	if c.document {
+		return nil
+	}
+
+	for _, spec := range s.Options {
+		section := c.foldSection(spec.Section)
+		if section == "" {
+			section = DefaultSection
+		}
+		option := c.foldOption(spec.Option)
+
+		raw, ok := c.data[section].get(option)
+		if !ok || spec.Type == StringType {
+			continue
+		}
+		if value, err := c.GetString(section, option); err != nil || value != raw {
+			continue // set elsewhere or unfolded
+		}
+
+		var canonical string
+		switch spec.Type {
+		case IntType:
+			n, _ := c.GetInt(section, option)
+			canonical = strconv.Itoa(n)
+		case FloatType:
+			f, _ := c.GetFloat64(section, option)
+			canonical = strconv.FormatFloat(f, 'g', -1, 64)
+		case BoolType:
+			b, _ := c.GetBool(section, option)
+			canonical = strconv.FormatBool(b)
+		}
+		if canonical != raw {
+			loc, located := c.data[section].location(option)
+			c.mutableSection(section).set(option, canonical)
+			if located {
+				c.setLocation(section, option, loc)
+			}
+			c.changed()
+		}
+	}
+
+	return nil
+}
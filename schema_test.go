@@ -0,0 +1,352 @@
+package conf_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	. "github.com/akrennmair/goconf"
+)
+
+var testSchema = &Schema{Options: []OptionSpec{
+	{Section: "", Option: "host", Type: StringType, Required: true},
+	{Section: "service-1", Option: "port", Type: IntType, Required: true, Range: &Range{1, 1024}},
+	{Section: "service-1", Option: "mode", Allowed: []string{"fast", "safe"}},
+	{Section: "service-1", Option: "ratio", Type: FloatType, Range: &Range{0, 1}},
+	{Section: "service-2", Option: "enabled", Type: BoolType, Required: true},
+}}
+
+func TestValidate(t *testing.T) {
+	c, err := ReadConfigBytes([]byte(confFile))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	c.AddOption("service-1", "mode", "slow")
+	c.AddOption("service-1", "ratio", "1.5")
+
+	err = c.Validate(testSchema)
+	verr, ok := err.(ValidationError)
+	if !ok {
+		t.Fatalf("c.Validate() = %v; want ValidationError", err)
+	}
+
+	want := []string{"service-1 mode", "service-1 ratio", "service-2 enabled"}
+	if len(verr.Violations) != len(want) {
+		t.Fatalf("c.Validate() found %d violations; want %d: %v", len(verr.Violations), len(want), err)
+	}
+	for i, v := range verr.Violations {
+		if v.Section+" "+v.Option != want[i] {
+			t.Errorf("violation %d is for %s %s; want %s", i, v.Section, v.Option, want[i])
+		}
+	}
+	if !strings.Contains(err.Error(), "'slow' is not one of fast, safe") {
+		t.Error("unexpected error message: " + err.Error())
+	}
+
+	c.AddOption("service-1", "mode", "fast")
+	c.AddOption("service-1", "ratio", "0.5")
+	c.AddOption("service-2", "enabled", "yes")
+	if err = c.Validate(testSchema); err != nil {
+		t.Error("c.Validate() of a valid configuration returned error: " + err.Error())
+	}
+}
+
+func TestSetSchema(t *testing.T) {
+	c := NewConfigFile()
+	c.SetSchema(testSchema)
+	err := c.Read(strings.NewReader(`host = example.com
+
+[service-1]
+port = 2048
+ratio = .50
+mode = fast
+
+[service-2]
+enabled = maybe
+`))
+	verr, ok := err.(ValidationError)
+	if !ok {
+		t.Fatalf("c.Read() = %v; want ValidationError", err)
+	}
+	want := []string{
+		"<input>:4: option 'port' in section 'service-1': value 2048 is out of range [1, 1024]",
+		"<input>:9: option 'enabled' in section 'service-2': value 'maybe' is not a bool",
+	}
+	if len(verr.Violations) != len(want) {
+		t.Fatalf("c.Read() found %d violations; want %d: %v", len(verr.Violations), len(want), err)
+	}
+	for i, v := range verr.Violations {
+		if v.String() != want[i] {
+			t.Errorf("violation %d is %q; want %q", i, v.String(), want[i])
+		}
+	}
+
+	c = NewConfigFile()
+	c.SetSchema(testSchema)
+	err = c.Read(strings.NewReader(`host = example.com
+ports = 0x10
+
+[service-1]
+port = +80
+ratio = .50
+url = http://%(host)s/
+
+[service-2]
+enabled = Yes
+`))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	for _, tc := range [][3]string{
+		{"service-1", "port", "80"},
+		{"service-1", "ratio", "0.5"},
+		{"service-2", "enabled", "true"},
+		{"default", "ports", "0x10"},
+	} {
+		if raw, _ := c.GetRawString(tc[0], tc[1]); raw != tc[2] {
+			t.Errorf("c.GetRawString(%q, %q) = %q; want %q", tc[0], tc[1], raw, tc[2])
+		}
+	}
+	if loc, _ := c.Source("service-2", "enabled"); loc.Line != 10 {
+		t.Errorf("coerced option read from %v; want line 10", loc)
+	}
+}
+
+func TestRules(t *testing.T) {
+	s := &Schema{Rules: []Rule{
+		RequiredIf("server", "tls", "on", "cert-file", "key-file"),
+		Ordered("workers", "min-workers", "max-workers"),
+		func(c *ConfigFile) error {
+			if c.HasSection("legacy") {
+				return errors.New("section 'legacy' is no longer supported")
+			}
+			return nil
+		},
+	}}
+
+	c := NewConfigFile()
+	err := c.Read(strings.NewReader(`[server]
+tls = yes
+cert-file = server.pem
+
+[workers]
+min-workers = 8
+max-workers = 4
+
+[legacy]
+`))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	err = c.Validate(s)
+	verr, ok := err.(ValidationError)
+	if !ok {
+		t.Fatalf("c.Validate() = %v; want ValidationError", err)
+	}
+	want := []string{
+		"option 'key-file' in section 'server': required option is missing, as 'tls' is on",
+		"<input>:7: option 'max-workers' in section 'workers': value 4 is less than 8 of 'min-workers'",
+		"section 'legacy' is no longer supported",
+	}
+	if len(verr.Violations) != len(want) {
+		t.Fatalf("c.Validate() found %d violations; want %d: %v", len(verr.Violations), len(want), err)
+	}
+	for i, v := range verr.Violations {
+		if v.String() != want[i] {
+			t.Errorf("violation %d is %q; want %q", i, v.String(), want[i])
+		}
+	}
+
+	c.RemoveSection("legacy")
+	c.AddOption("server", "tls", "off")
+	c.AddOption("workers", "max-workers", "16")
+	if err = c.Validate(s); err != nil {
+		t.Error("c.Validate() of a valid configuration returned error: " + err.Error())
+	}
+}
+
+func TestWriteSample(t *testing.T) {
+	s := &Schema{Options: []OptionSpec{
+		{Option: "host", Required: true, Description: "Host name to listen on."},
+		{Section: "service-1", Option: "port", Type: IntType, Range: &Range{1, 65535}, Default: "443"},
+	}}
+
+	buf := new(strings.Builder)
+	if err := s.WriteSample(buf); err != nil {
+		t.Fatal(err.Error())
+	}
+	want := `[default]
+
+# Host name to listen on.
+# (type string; required)
+host = 
+
+[service-1]
+
+# (type int; range 1 to 65535; default 443)
+# port = 443
+`
+	if buf.String() != want {
+		t.Errorf("s.WriteSample() wrote\n%s\nwant\n%s", buf.String(), want)
+	}
+
+	c, err := ReadConfigBytes([]byte(buf.String()))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	s.SetDefaults(c)
+	if port, _ := c.GetInt("service-1", "port"); port != 443 {
+		t.Errorf("default port = %d; want 443", port)
+	}
+
+	buf.Reset()
+	if err := s.WriteMarkdown(buf); err != nil {
+		t.Fatal(err.Error())
+	}
+	if !strings.Contains(buf.String(), "### port\n\n- Type: int\n- Default: `443`\n- Range: 1 to 65535\n") {
+		t.Errorf("s.WriteMarkdown() wrote unexpected reference:\n%s", buf.String())
+	}
+}
+
+func TestLint(t *testing.T) {
+	c := NewConfigFile()
+	err := c.Read(strings.NewReader(`[default]
+host = example.com
+unused = 1
+
+[service-1]
+url = http://%(host)s/
+MaxClients = 10
+maxclients = 20
+max-clients = 30
+max_clients = 40
+empty =
+
+[service-2]
+`))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	var got []string
+	for _, f := range Lint(c, LintAll) {
+		got = append(got, f.String())
+	}
+	want := []string{
+		"<input>:3: option 'unused' in the default section is never referenced",
+		"<input>:8: option redefined, earlier definitions are ignored",
+		"<input>:10: option 'max_clients' in section 'service-1' is easily confused with 'max-clients'",
+		"<input>:11: option 'empty' in section 'service-1' is empty",
+		"section 'service-2' has no options",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Lint() found\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestUnits(t *testing.T) {
+	s := &Schema{Options: []OptionSpec{
+		{Option: "timeout", Type: IntType, Unit: Seconds, Range: &Range{1, 3600}},
+		{Option: "interval", Type: FloatType, Unit: Seconds},
+		{Option: "cache-size", Type: IntType, Unit: Bytes},
+		{Option: "threshold", Type: FloatType, Unit: Percent},
+	}}
+	c := NewConfigFile()
+	c.SetSchema(s)
+	err := c.Read(strings.NewReader(`timeout = 5m
+interval = 250ms
+cache-size = 64KiB
+threshold = 75%
+`))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if timeout, _ := c.GetInt("", "timeout"); timeout != 300 {
+		t.Errorf("timeout = %d; want 300", timeout)
+	}
+	if raw, _ := c.GetRawString("", "timeout"); raw != "300" {
+		t.Errorf("timeout read as %q; want it coerced to 300", raw)
+	}
+	if interval, _ := c.GetFloat64("", "interval"); interval != 0.25 {
+		t.Errorf("interval = %g; want 0.25", interval)
+	}
+	if size, _ := c.GetInt("", "cache-size"); size != 65536 {
+		t.Errorf("cache-size = %d; want 65536", size)
+	}
+	c.SetOption("default", "cache-size", "2 MB")
+	if size, _ := c.GetInt("", "cache-size"); size != 2000000 {
+		t.Errorf("cache-size = %d; want 2000000", size)
+	}
+	if threshold, _ := c.GetFloat64("", "threshold"); threshold != 75 {
+		t.Errorf("threshold = %g; want 75", threshold)
+	}
+
+	c.SetOption("default", "timeout", "2h")
+	c.SetOption("default", "cache-size", "1.5B")
+	err = c.Validate(s)
+	want := "invalid configuration: option 'timeout' in section 'default': value 2h is out of range [1, 3600]; " +
+		"option 'cache-size' in section 'default': value '1.5B' is not a number of bytes"
+	if err == nil || err.Error() != want {
+		t.Errorf("c.Validate() = %v; want %s", err, want)
+	}
+
+	buf := new(strings.Builder)
+	s.WriteSample(buf)
+	if !strings.Contains(buf.String(), "# (type int; range 1 to 3600; in seconds)\n") {
+		t.Errorf("s.WriteSample() does not document the unit:\n%s", buf.String())
+	}
+}
+
+func TestWriteHelp(t *testing.T) {
+	s := &Schema{Options: []OptionSpec{
+		{Option: "host", Required: true, Description: "Host name to listen on."},
+		{Section: "Service-1", Option: "Mode", Allowed: []string{"fast", "safe"}},
+		{Section: "service-1", Option: "verbose", Type: BoolType},
+	}}
+	if keys := strings.Join(s.Keys(), " "); keys != "host service-1.mode service-1.verbose" {
+		t.Errorf("s.Keys() = %s", keys)
+	}
+
+	buf := new(strings.Builder)
+	if err := s.WriteHelp(buf); err != nil {
+		t.Fatal(err.Error())
+	}
+	want := "  host string\n" +
+		"    \tHost name to listen on.\n" +
+		"    \t(required)\n" +
+		"  service-1.mode string\n" +
+		"    \t(one of fast, safe)\n" +
+		"  service-1.verbose bool\n"
+	if buf.String() != want {
+		t.Errorf("s.WriteHelp() wrote\n%s\nwant\n%s", buf.String(), want)
+	}
+
+	buf.Reset()
+	if err := s.WriteBashCompletion(buf, "my-app"); err != nil {
+		t.Fatal(err.Error())
+	}
+	for _, want := range []string{
+		"'service-1.mode') COMPREPLY=($(compgen -P \"$prefix\" -W 'fast safe' -- \"${cur#*=}\")) ;;\n",
+		"'service-1.verbose') COMPREPLY=($(compgen -P \"$prefix\" -W 'true false' -- \"${cur#*=}\")) ;;\n",
+		"-W 'host service-1.mode service-1.verbose' -- \"$cur\"",
+		"complete -o default -F _my_app_conf 'my-app'\n",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("s.WriteBashCompletion() lacks %q:\n%s", want, buf.String())
+		}
+	}
+
+	buf.Reset()
+	if err := s.WriteZshCompletion(buf, "my-app"); err != nil {
+		t.Fatal(err.Error())
+	}
+	for _, want := range []string{
+		"#compdef my-app\n",
+		"\t'host:Host name to listen on.'\n",
+		"\t'service-1.mode') compadd -- 'fast' 'safe' ;;\n",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("s.WriteZshCompletion() lacks %q:\n%s", want, buf.String())
+		}
+	}
+}
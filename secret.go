@@ -0,0 +1,73 @@
+package conf
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"strings"
+)
+
+const (
+	secretPrefix = "ENC[AES256,"
+	secretSuffix = "]"
+)
+
+// SetEncryptionKey sets the 32 byte key used to decrypt values of the form
+//
+//	password = ENC[AES256,<base64>]
+//
+// which GetString then returns decrypted, and to encrypt values set with SetSecret.
+// Values are encrypted with AES-256 in GCM mode. Decrypted values are never
+// unfolded.
+func (c *ConfigFile) SetEncryptionKey(key []byte) error {
+	if len(key) != 32 {
+		return errors.New("encryption key must be 32 bytes long")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return err
+	}
+	if c.aead, err = cipher.NewGCM(block); err != nil {
+		return err
+	}
+	c.changed()
+
+	return nil
+}
+
+// SetSecret encrypts the value with the key set by SetEncryptionKey and adds
+// the encrypted value to the configuration, as SetOption does.
+// Validators set with SetValidator check the encrypted value.
+func (c *ConfigFile) SetSecret(section string, option string, value string) error {
+	if c.aead == nil {
+		return errors.New("no encryption key set")
+	}
+
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	sealed := c.aead.Seal(nonce, nonce, []byte(value), nil)
+	return c.SetOption(section, option, secretPrefix+base64.StdEncoding.EncodeToString(sealed)+secretSuffix)
+}
+
+// isSecret checks if the value is encrypted and can be decrypted.
+func (c *ConfigFile) isSecret(value string) bool {
+	return c.aead != nil && strings.HasPrefix(value, secretPrefix) && strings.HasSuffix(value, secretSuffix)
+}
+
+// decrypt returns the plain text of an encrypted value of the option in the section.
+func (c *ConfigFile) decrypt(section string, option string, value string) (string, error) {
+	sealed, err := base64.StdEncoding.DecodeString(value[len(secretPrefix) : len(value)-len(secretSuffix)])
+	if err == nil && len(sealed) >= c.aead.NonceSize() {
+		var plain []byte
+		n := c.aead.NonceSize()
+		if plain, err = c.aead.Open(nil, sealed[:n], sealed[n:], nil); err == nil {
+			return string(plain), nil
+		}
+	}
+
+	return "", GetError{DecryptionFailed, "", value, section, option, err}
+}
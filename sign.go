@@ -0,0 +1,114 @@
+package conf
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"os"
+	"strings"
+)
+
+// signaturePrefix starts the comment line appended to signed configuration files.
+const signaturePrefix = "# signature: "
+
+// Signer signs configuration files, see WriteConfigFileSigned.
+type Signer interface {
+	Algorithm() string
+	Sign(data []byte) ([]byte, error)
+}
+
+// Verifier checks the signatures of configuration files, see ReadConfigFileVerified.
+type Verifier interface {
+	Algorithm() string
+	Verify(data []byte, sig []byte) bool
+}
+
+// HMACKey signs and verifies configuration files with HMAC-SHA256.
+type HMACKey []byte
+
+func (k HMACKey) Algorithm() string { return "hmac-sha256" }
+
+func (k HMACKey) Sign(data []byte) ([]byte, error) {
+	mac := hmac.New(sha256.New, k)
+	mac.Write(data)
+	return mac.Sum(nil), nil
+}
+
+func (k HMACKey) Verify(data []byte, sig []byte) bool {
+	expected, _ := k.Sign(data)
+	return hmac.Equal(sig, expected)
+}
+
+// Ed25519PrivateKey signs configuration files with Ed25519.
+type Ed25519PrivateKey ed25519.PrivateKey
+
+func (k Ed25519PrivateKey) Algorithm() string { return "ed25519" }
+
+func (k Ed25519PrivateKey) Sign(data []byte) ([]byte, error) {
+	return ed25519.Sign(ed25519.PrivateKey(k), data), nil
+}
+
+// Ed25519PublicKey verifies configuration files signed with Ed25519.
+type Ed25519PublicKey ed25519.PublicKey
+
+func (k Ed25519PublicKey) Algorithm() string { return "ed25519" }
+
+func (k Ed25519PublicKey) Verify(data []byte, sig []byte) bool {
+	return len(k) == ed25519.PublicKeySize && ed25519.Verify(ed25519.PublicKey(k), data, sig)
+}
+
+// WriteConfigFileSigned saves the configuration to a file as WriteConfigFile does,
+// followed by a comment line holding a signature of the preceding contents.
+// Readers which don't verify the signature ignore it like any other comment.
+func (c *ConfigFile) WriteConfigFileSigned(fname string, perm uint32, header string, signer Signer, dialect ...Dialect) (err error) {
+	defer wrapWriteError(fname, &err)
+
+	data := c.WriteConfigBytes(header, dialect...)
+
+	sig, err := signer.Sign(data)
+	if err != nil {
+		return err
+	}
+	data = append(data, signaturePrefix+signer.Algorithm()+" "+base64.StdEncoding.EncodeToString(sig)+"\n"...)
+
+	return os.WriteFile(fname, data, os.FileMode(perm))
+}
+
+// ReadConfigFileVerified reads a file written by WriteConfigFileSigned and returns
+// a new configuration representation, provided that the file's signature is valid.
+// Otherwise it returns an error matching ErrInvalidSignature. Include directives
+// and include.path options of the dialect, see Dialect.Includes, are reported as a
+// ReadError with the reason IncludeRefused, as the signature does not cover the
+// files they name.
+func ReadConfigFileVerified(fname string, verifier Verifier, dialect ...Dialect) (c *ConfigFile, err error) {
+	defer wrapReadError(fname, &err)
+
+	data, err := os.ReadFile(fname)
+	if err != nil {
+		return nil, err
+	}
+
+	content, trailer := data, ""
+	if i := bytes.LastIndex(data, []byte(signaturePrefix)); i >= 0 && (i == 0 || data[i-1] == '\n') {
+		content, trailer = data[:i], strings.TrimSpace(string(data[i+len(signaturePrefix):]))
+	}
+
+	fields := strings.Fields(trailer)
+	if len(fields) != 2 || fields[0] != verifier.Algorithm() {
+		return nil, ReadError{InvalidSignature, trailer}
+	}
+	sig, err := base64.StdEncoding.DecodeString(fields[1])
+	if err != nil || !verifier.Verify(content, sig) {
+		return nil, ReadError{InvalidSignature, trailer}
+	}
+
+	c = newConfigFile(dialect)
+	c.noIncludes = true
+	if err = c.read(bytes.NewReader(content), fname); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
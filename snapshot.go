@@ -0,0 +1,36 @@
+package conf
+
+// Snapshot is an opaque copy of the state of a configuration, see ConfigFile.Snapshot.
+type Snapshot struct {
+	sections []string
+	data     map[string]*section
+}
+
+// Snapshot saves the sections and options of the configuration, so that they
+// can be restored with Restore later on. Settings such as defaults, aliases and
+// environment overrides are not part of the snapshot.
+func (c *ConfigFile) Snapshot() *Snapshot {
+	return &Snapshot{copySections(c.sections), copyData(c.data)}
+}
+
+// Restore reverts the sections and options of the configuration to the state
+// saved in the snapshot. A snapshot can be restored any number of times.
+func (c *ConfigFile) Restore(s *Snapshot) {
+	c.sections = copySections(s.sections)
+	c.data = copyData(s.data)
+	c.shared = nil
+	c.changed()
+}
+
+func copySections(sections []string) []string {
+	return append([]string(nil), sections...)
+}
+
+func copyData(data map[string]*section) map[string]*section {
+	dup := make(map[string]*section, len(data))
+	for name, s := range data {
+		dup[name] = s.copy()
+	}
+
+	return dup
+}
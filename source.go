@@ -0,0 +1,75 @@
+package conf
+
+import (
+	"os"
+)
+
+// Source returns where the value GetRawString returns for the option in the
+// section came from: the file and line it was read from, or, for environment
+// overrides added with AddEnvOverrides, a location whose File is "env:" followed
+// by the name of the variable. It returns false if the option does not exist or
+// was not read from either, e.g. if it was added with AddOption or SetDefault.
+func (c *ConfigFile) Source(section string, option string) (loc Location, ok bool) {
+	if section == "" {
+		section = "default"
+	}
+	section = c.foldSection(section)
+	option = c.foldOption(option)
+
+	if name, ok := c.envSource(section, option); ok {
+		return Location{"env:" + name, 0}, true
+	}
+	if c.profile != "" {
+		if loc, found, ok := c.dataSource(section+"@"+c.profile, option); found {
+			return loc, ok
+		}
+	}
+	loc, _, ok = c.dataSource(section, option)
+
+	return loc, ok
+}
+
+// envSource returns the name of the environment variable overriding the option in the section.
+func (c *ConfigFile) envSource(section string, option string) (name string, ok bool) {
+	for i := len(c.envPrefixes) - 1; i >= 0; i-- {
+		name = envName(c.envPrefixes[i], section, option)
+		if _, ok = os.LookupEnv(name); ok {
+			return name, true
+		}
+	}
+
+	return "", false
+}
+
+// dataSource returns the location of the value lookupData returns for the
+// option in the section. found reports whether there is such a value, ok
+// whether its location is known.
+func (c *ConfigFile) dataSource(section string, option string) (loc Location, found bool, ok bool) {
+	if _, found = c.data[section]; !found {
+		return Location{}, false, false
+	}
+
+	options := []string{}
+	for _, cond := range conditions() {
+		options = append(options, option+"."+cond)
+	}
+	options = append(options, option)
+	for _, o := range options {
+		if _, found = c.data[section].get(o); found {
+			loc, ok = c.data[section].location(o)
+			return loc, true, ok
+		}
+	}
+
+	for _, old := range c.aliases[cacheKey{section, option}] {
+		if name, ok := c.envSource(section, old); ok {
+			return Location{"env:" + name, 0}, true, true
+		}
+		if _, found = c.data[section].get(old); found {
+			loc, ok = c.data[section].location(old)
+			return loc, true, ok
+		}
+	}
+
+	return Location{}, false, false
+}
@@ -0,0 +1,307 @@
+package conf
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Stack composes several configurations into one, answering lookups by
+// walking its layers in priority order. A typical application stacks
+// hard-coded defaults, a system file, a user file, environment settings and
+// explicit overrides:
+//
+//	s := conf.NewStack()
+//	s.Push("defaults", defaults)
+//	s.Push("/etc/app.conf", system)
+//	s.Push("~/.app.conf", user)
+//	s.GetInt("service-1", "maxclients") // answered by the user file if set there
+//
+// Values are read from the highest priority layer that has the option, and
+// unfolded in the dialect of that layer. Placeholders refer to the merged view
+// of all layers, so that an override file can refer to %(base-url)s defined in
+// a base file, and an override of base-url applies to the values of lower
+// layers referring to it. A placeholder resolves to the option it names in the
+// section of the value, looked up in the layers from the highest priority
+// down, and then to the option in the default section, looked up the same way.
+// Options of extended placeholders naming a section are looked up in that
+// section, which any layer may have.
+type Stack struct {
+	layers []stackLayer // Ordered from lowest to highest priority.
+}
+
+type stackLayer struct {
+	name   string
+	config *ConfigFile
+}
+
+// NewStack creates an empty configuration stack.
+func NewStack() *Stack {
+	return new(Stack)
+}
+
+// Push adds a configuration on top of the stack, where it takes precedence
+// over all layers pushed before it. The name identifies the layer, e.g. by
+// the path of the file it was read from.
+func (s *Stack) Push(name string, c *ConfigFile) {
+	s.layers = append(s.layers, stackLayer{name, c})
+}
+
+// Layers returns the names of the layers, highest priority first.
+func (s *Stack) Layers() (names []string) {
+	names = make([]string, len(s.layers))
+	for i := range s.layers {
+		names[i] = s.layers[len(s.layers)-1-i].name
+	}
+
+	return names
+}
+
+// layer returns the highest priority configuration which has the option in the section.
+// It returns an error if no layer has the option.
+func (s *Stack) layer(section string, option string) (*ConfigFile, error) {
+	for i := len(s.layers) - 1; i >= 0; i-- {
+		if _, err := s.layers[i].config.GetRawString(section, option); err == nil {
+			return s.layers[i].config, nil
+		}
+	}
+
+	if section == "" {
+		section = "default"
+	}
+	section = foldCase(section)
+	if !s.HasSection(section) {
+		return nil, GetError{SectionNotFound, "", "", section, foldCase(option), nil}
+	}
+	return nil, GetError{OptionNotFound, "", "", section, foldCase(option), nil}
+}
+
+// GetSections returns the list of sections found in any layer.
+func (s *Stack) GetSections() (sections []string) {
+	seen := make(map[string]bool)
+	for _, l := range s.layers {
+		for _, section := range l.config.GetSections() {
+			if !seen[section] {
+				seen[section] = true
+				sections = append(sections, section)
+			}
+		}
+	}
+
+	return sections
+}
+
+// HasSection checks if any layer has the given section.
+func (s *Stack) HasSection(section string) bool {
+	for _, l := range s.layers {
+		if l.config.HasSection(section) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// HasOption checks if any layer has the given option in the section.
+func (s *Stack) HasOption(section string, option string) bool {
+	for _, l := range s.layers {
+		if l.config.HasOption(section, option) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// GetRawString gets the raw string value of the option from the highest priority layer that has it.
+func (s *Stack) GetRawString(section string, option string) (value string, err error) {
+	c, err := s.layer(section, option)
+	if err != nil {
+		return "", err
+	}
+
+	return c.GetRawString(section, option)
+}
+
+// GetString gets the string value of the option from the highest priority layer
+// that has it, unfolding placeholders as described for Stack.
+func (s *Stack) GetString(section string, option string) (value string, err error) {
+	c, err := s.layer(section, option)
+	if err != nil {
+		return "", err
+	}
+
+	return s.unfolded(c, section, option)
+}
+
+// unfolded returns the value of the option in the layer c, unfolding its
+// placeholders as described for Stack.
+func (s *Stack) unfolded(c *ConfigFile, section string, option string) (value string, err error) {
+	if section == "" {
+		section = "default"
+	}
+
+	return c.unfolded(cacheKey{c.foldSection(section), c.foldOption(option)}, s.resolver(c))
+}
+
+// resolver returns the resolver of the placeholders of values of the layer c,
+// which looks options up in all layers, see Stack.
+func (s *Stack) resolver(c *ConfigFile) resolver {
+	return func(section string, ref string) (nsection string, noption string, nvalue string, err error) {
+		nsection, noption = section, c.foldOption(ref)
+		if c.dialect.Interpolation == ExtendedInterpolation {
+			if i := strings.Index(noption, ":"); i >= 0 {
+				nsection, noption = noption[:i], noption[i+1:]
+				if !s.HasSection(nsection) {
+					return "", "", "", GetError{SectionNotFound, "", "", nsection, noption, nil}
+				}
+			}
+		}
+
+		for _, name := range []string{nsection, DefaultSection} {
+			for i := len(s.layers) - 1; i >= 0; i-- {
+				l := s.layers[i].config
+				value, ok := l.lookup(l.foldSection(name), l.foldOption(noption))
+				if !ok {
+					continue
+				}
+				if l.isSecret(value) {
+					value, err = l.decrypt(name, noption, value)
+				}
+				return name, noption, value, err
+			}
+		}
+
+		return "", "", "", GetError{OptionNotFound, "", "", nsection, noption, nil}
+	}
+}
+
+// GetStringsAll gets the string values of the option from every layer that has it,
+// highest priority first, e.g. to accumulate lists contributed by several files.
+// It returns an error if no layer has the option, or a value could not be unfolded.
+func (s *Stack) GetStringsAll(section string, option string) (values []string, err error) {
+	for i := len(s.layers) - 1; i >= 0; i-- {
+		c := s.layers[i].config
+		if _, err := c.GetRawString(section, option); err != nil {
+			continue
+		}
+		value, err := s.unfolded(c, section, option)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+
+	if values == nil {
+		_, err = s.layer(section, option)
+	}
+	return values, err
+}
+
+// GetInt has the same behaviour as GetString but converts the response to int.
+func (s *Stack) GetInt(section string, option string) (value int, err error) {
+	c, err := s.layer(section, option)
+	if err != nil {
+		return 0, err
+	}
+	sv, err := s.unfolded(c, section, option)
+	if err != nil {
+		return 0, err
+	}
+
+	return c.parseInt(sv, section, option)
+}
+
+// GetFloat64 has the same behaviour as GetString but converts the response to float64.
+func (s *Stack) GetFloat64(section string, option string) (value float64, err error) {
+	c, err := s.layer(section, option)
+	if err != nil {
+		return 0, err
+	}
+	sv, err := s.unfolded(c, section, option)
+	if err != nil {
+		return 0, err
+	}
+
+	return c.parseFloat(sv, section, option)
+}
+
+// GetBool has the same behaviour as GetString but converts the response to bool.
+func (s *Stack) GetBool(section string, option string) (value bool, err error) {
+	c, err := s.layer(section, option)
+	if err != nil {
+		return false, err
+	}
+	sv, err := s.unfolded(c, section, option)
+	if err != nil {
+		return false, err
+	}
+
+	return c.boolValue(sv, section, option)
+}
+
+// Source returns where the value of the option in the section came from, like
+// ConfigFile.Source, in the layer answering lookups of the option. Locations
+// without a file name are reported under the name of the layer.
+func (s *Stack) Source(section string, option string) (loc Location, ok bool) {
+	for i := len(s.layers) - 1; i >= 0; i-- {
+		l := s.layers[i]
+		if _, err := l.config.GetRawString(section, option); err == nil {
+			if loc, ok = l.config.Source(section, option); ok && loc.File == "" {
+				loc.File = l.name
+			}
+			return loc, ok
+		}
+	}
+
+	return Location{}, false
+}
+
+// Contribution describes what a layer of a Stack contributes to an option,
+// see Explain.
+type Contribution struct {
+	Layer     string   // Name of the layer.
+	Present   bool     // Whether the layer has the option.
+	Value     string   // Raw value of the option in the layer, "" if absent.
+	Origin    Location // Where the value came from, see Stack.Source.
+	Effective bool     // Whether the stack answers lookups of the option from this layer.
+}
+
+func (c Contribution) String() string {
+	switch {
+	case !c.Present:
+		return c.Layer + ": absent"
+	case c.Effective:
+		return fmt.Sprintf("%s: '%s' from %s (effective)", c.Layer, c.Value, c.Origin)
+	}
+	return fmt.Sprintf("%s: '%s' from %s (overridden)", c.Layer, c.Value, c.Origin)
+}
+
+// Explain returns what every layer contributes to the option in the section,
+// highest priority first, e.g. to find out why the stack returns a value:
+//
+//	for _, c := range s.Explain("service-1", "maxclients") {
+//		fmt.Println(c)
+//	}
+//
+// The first layer which has the option is the effective one; the values of
+// the layers below it are overridden. Values are raw, see GetRawString, and
+// their origins reported as by Source.
+func (s *Stack) Explain(section string, option string) []Contribution {
+	contributions := make([]Contribution, 0, len(s.layers))
+	effective := false
+	for i := len(s.layers) - 1; i >= 0; i-- {
+		l := s.layers[i]
+		c := Contribution{Layer: l.name}
+		if value, err := l.config.GetRawString(section, option); err == nil {
+			c.Present, c.Value = true, value
+			c.Effective, effective = !effective, true
+			c.Origin, _ = l.config.Source(section, option)
+			if c.Origin.File == "" {
+				c.Origin.File = l.name
+			}
+		}
+		contributions = append(contributions, c)
+	}
+
+	return contributions
+}
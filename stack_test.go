@@ -0,0 +1,115 @@
+package conf_test
+
+import (
+	"testing"
+
+	. "github.com/akrennmair/goconf"
+)
+
+func TestStack(t *testing.T) {
+	defaults := NewConfigFile()
+	defaults.AddOption("service-1", "maxclients", "100")
+	defaults.AddOption("service-1", "host", "localhost")
+
+	user, err := ReadConfigBytes([]byte("[service-1]\nmaxclients = 200\n"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	s := NewStack()
+	s.Push("defaults", defaults)
+	s.Push("user", user)
+
+	if n, err := s.GetInt("service-1", "maxclients"); err != nil || n != 200 {
+		t.Errorf("s.GetInt(\"service-1\",\"maxclients\") = %d, %v; want 200", n, err)
+	}
+	if v, err := s.GetString("service-1", "host"); err != nil || v != "localhost" {
+		t.Errorf("s.GetString(\"service-1\",\"host\") = %q, %v; want localhost", v, err)
+	}
+	if _, err := s.GetString("service-1", "missing"); err == nil {
+		t.Error("expected error for missing option")
+	}
+	if _, err := s.GetString("service-2", "host"); err == nil {
+		t.Error("expected error for missing section")
+	}
+	if names := s.Layers(); len(names) != 2 || names[0] != "user" {
+		t.Errorf("s.Layers() = %v; want [user defaults]", names)
+	}
+}
+
+func TestStackGetStringsAll(t *testing.T) {
+	system, _ := ReadConfigBytes([]byte("[service-1]\nplugins = auth\n"))
+	user, _ := ReadConfigBytes([]byte("[service-1]\nplugins = metrics\nhost = localhost\n"))
+
+	s := NewStack()
+	s.Push("system", system)
+	s.Push("user", user)
+
+	if v, err := s.GetStringsAll("service-1", "plugins"); err != nil || len(v) != 2 || v[0] != "metrics" || v[1] != "auth" {
+		t.Errorf("s.GetStringsAll(\"service-1\",\"plugins\") = %q, %v; want [metrics auth]", v, err)
+	}
+	if v, err := s.GetStringsAll("service-1", "host"); err != nil || len(v) != 1 {
+		t.Errorf("s.GetStringsAll(\"service-1\",\"host\") = %q, %v; want [localhost]", v, err)
+	}
+	if _, err := s.GetStringsAll("service-1", "missing"); err == nil {
+		t.Error("expected error for missing option")
+	}
+}
+
+func TestStackInterpolation(t *testing.T) {
+	base, _ := ReadConfigBytes([]byte("base-url = http://example.com\nport = 80\n\n[service-1]\nhealth = %(base-url)s/health\n"))
+	override, _ := ReadConfigBytes([]byte("[service-1]\nbase-url = http://localhost:%(port)s\nurl = %(base-url)s/api\nworkers = %(port)s\n"))
+
+	s := NewStack()
+	s.Push("base", base)
+	s.Push("override", override)
+
+	for _, tc := range [][3]string{
+		{"service-1", "url", "http://localhost:80/api"},
+		{"service-1", "health", "http://localhost:80/health"},
+		{"default", "base-url", "http://example.com"},
+	} {
+		if v, err := s.GetString(tc[0], tc[1]); err != nil || v != tc[2] {
+			t.Errorf("s.GetString(%q, %q) = %q, %v; want %q", tc[0], tc[1], v, err, tc[2])
+		}
+	}
+	if n, err := s.GetInt("service-1", "workers"); err != nil || n != 80 {
+		t.Errorf("s.GetInt(\"service-1\", \"workers\") = %d, %v; want 80", n, err)
+	}
+	if v, err := s.GetStringsAll("service-1", "url"); err != nil || len(v) != 1 || v[0] != "http://localhost:80/api" {
+		t.Errorf("s.GetStringsAll(\"service-1\", \"url\") = %q, %v", v, err)
+	}
+	if v, _ := base.GetString("service-1", "health"); v != "http://example.com/health" {
+		t.Errorf("base layer unfolded health to %q", v)
+	}
+}
+
+func TestStackExplain(t *testing.T) {
+	defaults := NewConfigFile()
+	defaults.AddOption("service-1", "maxclients", "100")
+	system, _ := ReadConfigBytes([]byte("[service-1]\nmaxclients = 200\n"))
+	user, _ := ReadConfigBytes([]byte("[service-2]\nmaxclients = 50\n"))
+
+	s := NewStack()
+	s.Push("defaults", defaults)
+	s.Push("/etc/app.conf", system)
+	s.Push("~/.app.conf", user)
+
+	want := []string{
+		"~/.app.conf: absent",
+		"/etc/app.conf: '200' from /etc/app.conf:2 (effective)",
+		"defaults: '100' from defaults (overridden)",
+	}
+	explained := s.Explain("Service-1", "MaxClients")
+	if len(explained) != len(want) {
+		t.Fatalf("s.Explain() returned %d contributions; want %d", len(explained), len(want))
+	}
+	for i, c := range explained {
+		if c.String() != want[i] {
+			t.Errorf("contribution %d is %q; want %q", i, c, want[i])
+		}
+	}
+	if c := explained[1]; !c.Present || !c.Effective || c.Value != "200" || c.Origin.Line != 2 {
+		t.Errorf("effective contribution is %+v", c)
+	}
+}
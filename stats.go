@@ -0,0 +1,58 @@
+package conf
+
+// Approximate sizes in bytes of the data structures counted by Stats, for
+// 64-bit platforms, including the room maps and slices keep for growing.
+const (
+	sectionSize  = 160 // Section struct and its maps, entries in data and sections.
+	optionSize   = 88  // Map entry of the value, entry in the list of options.
+	locationSize = 72  // Map entry of a location; file names are shared.
+)
+
+// Stats reports the size of a configuration, see ConfigFile.Stats.
+type Stats struct {
+	Sections int // Number of sections, including the default section.
+	Options  int // Number of options in all sections.
+	Bytes    int // Approximate memory used by the sections and options.
+}
+
+// SetCapacity presizes the configuration for the expected number of sections
+// and of options per section, so that building or reading a large configuration
+// does not repeatedly grow its maps. It is best called on a new configuration,
+// before it is filled.
+func (c *ConfigFile) SetCapacity(sections int, options int) {
+	if sections > len(c.data) {
+		data := make(map[string]*section, sections)
+		for name, s := range c.data {
+			data[name] = s
+		}
+		c.data = data
+		c.sections = append(make([]string, 0, sections), c.sections...)
+	}
+
+	c.capacity = options
+	for name, s := range c.data {
+		if s.pending == nil && s.len() == 0 && !c.shared[name] {
+			c.data[name] = newSection(options)
+		}
+	}
+}
+
+// Stats returns the number of sections and options of the configuration and
+// an estimate of the memory they use, e.g. to budget the memory of embedded
+// deployments. Names and values shared by interning (see SetInterning) are
+// counted for every use, and sections read lazily (see SetLazy) are parsed.
+// Settings such as defaults and the cache of unfolded values are not counted.
+func (c *ConfigFile) Stats() Stats {
+	st := Stats{Sections: len(c.sections)}
+	for _, name := range c.sections {
+		s := c.data[name]
+		st.Options += s.len()
+		st.Bytes += sectionSize + len(name)
+		for _, option := range s.keys() {
+			st.Bytes += optionSize + len(option) + len(s.values[option])
+		}
+		st.Bytes += locationSize * len(s.locations)
+	}
+
+	return st
+}
@@ -0,0 +1,75 @@
+package conf
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// StreamSeparator is the line separating the configurations of a stream, see
+// ReadConfigStream.
+var StreamSeparator = "---"
+
+// ReadConfigStream reads a stream of configurations separated by lines
+// consisting of StreamSeparator, such as a bundle of the configurations of
+// several tenants, in the dialect given, if any, and else in DefaultDialect.
+// Every separator starts a new configuration, so that a stream without one
+// holds a single configuration. Errors are prefixed with the number of the
+// configuration, starting at 1, and report lines counted from its start.
+func ReadConfigStream(reader io.Reader, dialect ...Dialect) (configs []*ConfigFile, err error) {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	for n, part := range splitStream(data) {
+		c := newConfigFile(dialect)
+		if err = c.Read(bytes.NewReader(part)); err != nil {
+			return nil, fmt.Errorf("configuration %d: %w", n+1, err)
+		}
+		configs = append(configs, c)
+	}
+
+	return configs, nil
+}
+
+// WriteConfigStream writes the configurations to the io.Writer, separated by
+// lines consisting of StreamSeparator, so that ReadConfigStream reads them
+// back. Each is written as by Write without a header, in the dialect given, if
+// any, and else in its own.
+func WriteConfigStream(writer io.Writer, configs []*ConfigFile, dialect ...Dialect) error {
+	buf := bytes.NewBuffer(nil)
+	for i, c := range configs {
+		if i > 0 {
+			buf.WriteString(StreamSeparator + "\n")
+		}
+		if err := c.Write(buf, "", dialect...); err != nil {
+			return err
+		}
+		if b := buf.Bytes(); len(b) > 0 && b[len(b)-1] != '\n' {
+			buf.WriteByte('\n')
+		}
+	}
+
+	_, err := buf.WriteTo(writer)
+	return err
+}
+
+// splitStream splits data at the lines consisting of StreamSeparator, which
+// may be surrounded by white space.
+func splitStream(data []byte) (parts [][]byte) {
+	start := 0
+	for pos := 0; pos < len(data); {
+		end := len(data)
+		if i := bytes.IndexByte(data[pos:], '\n'); i >= 0 {
+			end = pos + i + 1
+		}
+		if string(bytes.TrimSpace(data[pos:end])) == StreamSeparator {
+			parts = append(parts, data[start:pos])
+			start = end
+		}
+		pos = end
+	}
+
+	return append(parts, data[start:])
+}
@@ -0,0 +1,36 @@
+package conf
+
+// SystemdDialect handles the syntax of systemd unit files and desktop entries
+// (.desktop files):
+//
+//   - section and option names are case sensitive,
+//   - only "=" separates options from values, and only lines starting with
+//     "#" or ";" are comments; "#" and ";" within values are kept,
+//   - a line ending in a backslash continues on the next line, the backslash
+//     being replaced by a space; indented lines do not continue values,
+//   - repeated assignments to an option add a line to its value each, and
+//     assigning the empty value resets it. A reset followed by assignments
+//     is kept as a leading empty line, so that drop-ins resetting lists are
+//     written as they were read. Settings which are not lists take the last
+//     line of their value,
+//   - Write writes every line of a value as an assignment of its own.
+//
+// Reading a unit and then its drop-ins into the same configuration merges them
+// as systemd does. Read does not defer parsing in this dialect, even if
+// SetLazy is enabled.
+var SystemdDialect = Dialect{
+	CommentPrefixes:       []string{"#", ";"},
+	InlineComments:        NoInlineComments,
+	Delimiters:            "=",
+	CaseSensitiveSections: true,
+	CaseSensitiveOptions:  true,
+	Continuation:          ContinueBackslash,
+	Duplicates:            DuplicatesAppend,
+	Interpolation:         BasicInterpolation,
+}
+
+// SetSystemdMode selects SystemdDialect if enabled, and DefaultDialect
+// otherwise, see SetDialect.
+func (c *ConfigFile) SetSystemdMode(enabled bool) {
+	c.setMode(enabled, SystemdDialect)
+}
@@ -0,0 +1,31 @@
+package conf
+
+import (
+	"strings"
+	"text/template"
+)
+
+// GetTemplate has the same behaviour as GetString but parses the response as a
+// text/template and returns the result of executing it with data, e.g.
+//
+//	log-format = {{.Time.Format "15:04:05"}} {{.Level}} {{.Message}}
+//
+// It returns an error if the template could not be parsed or executed.
+func (c *ConfigFile) GetTemplate(section string, option string, data any) (value string, err error) {
+	sv, err := c.GetString(section, option)
+	if err != nil {
+		return "", err
+	}
+
+	tmpl, err := template.New(section + "." + option).Parse(sv)
+	if err != nil {
+		return "", GetError{CouldNotParse, "template", sv, section, option, err}
+	}
+
+	var buf strings.Builder
+	if err = tmpl.Execute(&buf, data); err != nil {
+		return "", GetError{TemplateFailed, "template", sv, section, option, err}
+	}
+
+	return buf.String(), nil
+}
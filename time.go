@@ -0,0 +1,114 @@
+package conf
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GetDurationList has the same behaviour as GetString but converts the response
+// to a list of durations separated by commas, e.g.
+//
+//	backoff = 1s, 2s, 5s, 30s
+//
+// Each duration is parsed by time.ParseDuration. An empty value is an empty list.
+func (c *ConfigFile) GetDurationList(section string, option string) (value []time.Duration, err error) {
+	sv, err := c.GetString(section, option)
+	if err != nil || strings.TrimSpace(sv) == "" {
+		return nil, err
+	}
+
+	for _, s := range strings.Split(sv, ",") {
+		d, err := time.ParseDuration(strings.TrimSpace(s))
+		if err != nil {
+			return nil, GetError{CouldNotParse, "duration", sv, section, option, err}
+		}
+		value = append(value, d)
+	}
+
+	return value, nil
+}
+
+// TimeWindow is a daily window of time, given by its start and end as offsets
+// from midnight. A window whose end is before its start spans midnight.
+type TimeWindow struct {
+	Start time.Duration
+	End   time.Duration
+}
+
+// Contains reports whether the time of day of t lies within the window,
+// including its start and excluding its end.
+func (w TimeWindow) Contains(t time.Time) bool {
+	d := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute +
+		time.Duration(t.Second())*time.Second + time.Duration(t.Nanosecond())
+	if w.End < w.Start {
+		return d >= w.Start || d < w.End
+	}
+	return d >= w.Start && d < w.End
+}
+
+func (w TimeWindow) String() string {
+	return formatTimeOfDay(w.Start) + "-" + formatTimeOfDay(w.End)
+}
+
+// GetTimeWindow has the same behaviour as GetString but converts the response
+// to a daily time window given by start and end times, e.g.
+//
+//	maintenance = 02:00-04:00
+//
+// Times are given as hours and minutes, optionally followed by seconds.
+func (c *ConfigFile) GetTimeWindow(section string, option string) (value TimeWindow, err error) {
+	sv, err := c.GetString(section, option)
+	if err != nil {
+		return TimeWindow{}, err
+	}
+
+	start, end, ok := strings.Cut(sv, "-")
+	if ok {
+		value.Start, ok = parseTimeOfDay(strings.TrimSpace(start))
+	}
+	if ok {
+		value.End, ok = parseTimeOfDay(strings.TrimSpace(end))
+	}
+	if !ok {
+		return TimeWindow{}, GetError{CouldNotParse, "time window", sv, section, option, nil}
+	}
+
+	return value, nil
+}
+
+// parseTimeOfDay parses a time of day of the form HH:MM or HH:MM:SS,
+// where 24:00 denotes the end of the day.
+func parseTimeOfDay(s string) (d time.Duration, ok bool) {
+	fields := strings.Split(s, ":")
+	if len(fields) < 2 || len(fields) > 3 {
+		return 0, false
+	}
+
+	for i, max := range []int{24, 59, 59}[:len(fields)] {
+		n, err := strconv.Atoi(fields[i])
+		if err != nil || len(fields[i]) != 2 || n < 0 || n > max {
+			return 0, false
+		}
+		d = d*60 + time.Duration(n)
+	}
+	for i := len(fields); i < 3; i++ {
+		d *= 60
+	}
+	d *= time.Second
+
+	if d > 24*time.Hour {
+		return 0, false
+	}
+	return d, true
+}
+
+// formatTimeOfDay formats an offset from midnight as HH:MM or HH:MM:SS.
+func formatTimeOfDay(d time.Duration) string {
+	h, m, s := int(d/time.Hour), int(d/time.Minute)%60, int(d/time.Second)%60
+	if s != 0 {
+		return fmt.Sprintf("%02d:%02d:%02d", h, m, s)
+	}
+	return fmt.Sprintf("%02d:%02d", h, m)
+}
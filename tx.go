@@ -0,0 +1,153 @@
+package conf
+
+import (
+	"errors"
+)
+
+// ErrTxDone is returned by Commit on a transaction which has already been
+// committed or rolled back.
+var ErrTxDone = errors.New("transaction already committed or rolled back")
+
+// Tx stages modifications of a configuration so that they are applied all at
+// once by Commit, or discarded by Rollback. Staged modifications are not visible
+// through the configuration's getters before they are committed.
+type Tx struct {
+	c    *ConfigFile
+	ops  []func() error
+	done bool
+}
+
+// Begin starts a transaction on the configuration.
+func (c *ConfigFile) Begin() *Tx {
+	return &Tx{c: c}
+}
+
+// AddSection stages the addition of a section, see ConfigFile.AddSection.
+func (tx *Tx) AddSection(section string) {
+	tx.ops = append(tx.ops, func() error { tx.c.AddSection(section); return nil })
+}
+
+// RemoveSection stages the removal of a section, see ConfigFile.RemoveSection.
+func (tx *Tx) RemoveSection(section string) {
+	tx.ops = append(tx.ops, func() error {
+		if err := tx.c.checkProtected(section, ""); err != nil {
+			return err
+		}
+		tx.c.RemoveSection(section)
+		return nil
+	})
+}
+
+// AddOption stages the addition or replacement of an option, see ConfigFile.AddOption.
+// Commit fails if the value is rejected by a validator.
+func (tx *Tx) AddOption(section string, option string, value string) {
+	tx.ops = append(tx.ops, func() error { return tx.c.SetOption(section, option, value) })
+}
+
+// RemoveOption stages the removal of an option, see ConfigFile.RemoveOption.
+func (tx *Tx) RemoveOption(section string, option string) {
+	tx.ops = append(tx.ops, func() error {
+		if err := tx.c.checkProtected(section, option); err != nil {
+			return err
+		}
+		tx.c.RemoveOption(section, option)
+		return nil
+	})
+}
+
+// RenameSection stages the renaming of a section, which keeps its options; a
+// section already named to is merged with it, the options renamed replacing
+// those of the same names. Renaming a missing section does nothing.
+// Commit fails if the section is protected or is the default section.
+func (tx *Tx) RenameSection(section string, to string) {
+	tx.ops = append(tx.ops, func() error { return tx.c.renameSection(section, to) })
+}
+
+// RenameOption stages the renaming of an option within its section, replacing
+// an option already named to. Renaming a missing option does nothing.
+// Commit fails if either option is protected or a validator rejects the value.
+func (tx *Tx) RenameOption(section string, option string, to string) {
+	tx.ops = append(tx.ops, func() error { return tx.c.renameOption(section, option, to) })
+}
+
+// Commit applies the staged modifications in the order they were made. The
+// configuration's change handler is called once for the whole transaction, so
+// that e.g. a handler saving the configuration writes it only once.
+// If a modification fails, e.g. because a validator rejects a value, none of
+// them are applied, including to metadata, the change handler is not called
+// and its error is returned.
+func (tx *Tx) Commit() (err error) {
+	if tx.done {
+		return ErrTxDone
+	}
+	tx.done = true
+
+	tx.c.beginBatch()
+	defer func() {
+		if err != nil {
+			tx.c.abortBatch()
+		} else {
+			tx.c.endBatch()
+		}
+	}()
+	before, metadata := tx.c.Snapshot(), copyMetadata(tx.c.metadata)
+	for _, op := range tx.ops {
+		if err = op(); err != nil {
+			tx.c.Restore(before)
+			tx.c.metadata = metadata
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Rollback discards the staged modifications.
+func (tx *Tx) Rollback() {
+	tx.done = true
+	tx.ops = nil
+}
+
+// renameSection implements Tx.RenameSection.
+func (c *ConfigFile) renameSection(section string, to string) error {
+	name := c.foldSection(section)
+	s, ok := c.data[name]
+	switch {
+	case !ok || name == c.foldSection(to):
+		return nil
+	case name == DefaultSection:
+		return errors.New("the default section cannot be renamed")
+	}
+	if err := c.checkProtected(name, ""); err != nil {
+		return err
+	}
+
+	c.AddSection(to)
+	for _, option := range s.keys() {
+		value, _ := s.get(option)
+		if err := c.SetOption(to, option, value); err != nil {
+			return err
+		}
+	}
+	c.RemoveSection(name)
+
+	return nil
+}
+
+// renameOption implements Tx.RenameOption.
+func (c *ConfigFile) renameOption(section string, option string, to string) error {
+	value, ok := c.data[c.foldSection(section)].get(c.foldOption(option))
+	if !ok || c.foldOption(option) == c.foldOption(to) {
+		return nil
+	}
+	if err := c.checkProtected(section, option); err != nil {
+		return err
+	}
+
+	if err := c.SetOption(section, to, value); err != nil {
+		return err
+	}
+	c.RemoveOption(section, option)
+
+	return nil
+}
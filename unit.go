@@ -0,0 +1,115 @@
+package conf
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Unit is the unit of an option's numeric value as declared in a Schema.
+// Values of options with a unit may be given as bare numbers in the unit or
+// with a suffix, which GetInt and GetFloat64 convert to the unit once the
+// schema is attached with SetSchema:
+//
+//   - Seconds accepts durations as by time.ParseDuration, e.g. 1m30s is 90,
+//   - Bytes accepts the suffixes B, the decimal kB, MB, GB and TB and the binary
+//     KiB, MiB, GiB and TiB, ignoring case and with the B optional, e.g. 4k is
+//     4000 and 4KiB is 4096,
+//   - Percent accepts a percent sign, e.g. 75% is 75.
+type Unit int
+
+const (
+	NoUnit Unit = iota
+	Seconds
+	Bytes
+	Percent
+)
+
+var unitNames = []string{"", "seconds", "bytes", "percent"}
+
+func (u Unit) String() string {
+	if u < 0 || int(u) >= len(unitNames) {
+		return fmt.Sprintf("Unit(%d)", int(u))
+	}
+	return unitNames[u]
+}
+
+func (u Unit) MarshalText() ([]byte, error) {
+	return []byte(u.String()), nil
+}
+
+// UnmarshalText parses the names returned by String, so that schemas can be
+// stored as JSON.
+func (u *Unit) UnmarshalText(text []byte) error {
+	for i, name := range unitNames {
+		if name == string(text) {
+			*u = Unit(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown unit '%s'", string(text))
+}
+
+// byteSuffixes maps the lower-case suffixes of sizes to their multiples of bytes.
+var byteSuffixes = map[string]float64{
+	"": 1, "b": 1,
+	"k": 1e3, "kb": 1e3, "m": 1e6, "mb": 1e6, "g": 1e9, "gb": 1e9, "t": 1e12, "tb": 1e12,
+	"ki": 1 << 10, "kib": 1 << 10, "mi": 1 << 20, "mib": 1 << 20, "gi": 1 << 30, "gib": 1 << 30, "ti": 1 << 40, "tib": 1 << 40,
+}
+
+// parse converts the value, a bare number or one with a suffix, to the unit.
+func (u Unit) parse(sv string) (value float64, err error) {
+	if value, err = strconv.ParseFloat(sv, 64); err == nil {
+		return value, nil
+	}
+
+	switch u {
+	case Seconds:
+		d, err := time.ParseDuration(sv)
+		return d.Seconds(), err
+	case Bytes:
+		i := strings.LastIndexAny(sv, "0123456789.") + 1
+		mult, ok := byteSuffixes[strings.ToLower(strings.TrimSpace(sv[i:]))]
+		if !ok {
+			return 0, fmt.Errorf("unknown size suffix in '%s'", sv)
+		}
+		value, err = strconv.ParseFloat(sv[:i], 64)
+		return value * mult, err
+	case Percent:
+		if s, ok := strings.CutSuffix(sv, "%"); ok {
+			return strconv.ParseFloat(strings.TrimSpace(s), 64)
+		}
+	}
+	return 0, err
+}
+
+// unit returns the unit of the option in the section declared by the schema
+// attached with SetSchema, if any.
+func (c *ConfigFile) unit(section string, option string) Unit {
+	if len(c.units) == 0 {
+		return NoUnit
+	}
+	if section == "" {
+		section = "default"
+	}
+	return c.units[cacheKey{c.foldSection(section), c.foldOption(option)}]
+}
+
+// schemaUnits returns the units of the options declared by the schema.
+func (c *ConfigFile) schemaUnits(s *Schema) (units map[cacheKey]Unit) {
+	for _, spec := range s.Options {
+		if spec.Unit == NoUnit {
+			continue
+		}
+		if units == nil {
+			units = make(map[cacheKey]Unit)
+		}
+		section := spec.Section
+		if section == "" {
+			section = DefaultSection
+		}
+		units[cacheKey{c.foldSection(section), c.foldOption(spec.Option)}] = spec.Unit
+	}
+	return units
+}
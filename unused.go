@@ -0,0 +1,37 @@
+package conf
+
+import (
+	"sort"
+)
+
+// markUsed records that the option in the section has been looked up.
+func (c *ConfigFile) markUsed(section string, option string) {
+	c.mu.Lock()
+	if c.used == nil {
+		c.used = make(map[cacheKey]bool)
+	}
+	c.used[cacheKey{section, option}] = true
+	c.mu.Unlock()
+}
+
+// UnusedOptions returns the options of the configuration which have never been
+// looked up, neither by a getter nor as a placeholder in another option's value.
+// The options are returned sorted, in the form "section.option".
+//
+// Calling UnusedOptions at the end of a program's startup reveals misspelled
+// and stale settings.
+func (c *ConfigFile) UnusedOptions() (options []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, section := range c.sections {
+		for _, option := range c.data[section].keys() {
+			if !c.used[cacheKey{section, option}] {
+				options = append(options, section+"."+option)
+			}
+		}
+	}
+	sort.Strings(options)
+
+	return options
+}
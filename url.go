@@ -0,0 +1,175 @@
+package conf
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// URLOptions configures how configurations are fetched over HTTP(S).
+type URLOptions struct {
+	Timeout            time.Duration // Timeout of each request; 30s if zero.
+	TLSConfig          *tls.Config   // TLS settings, e.g. custom root CAs or client certificates.
+	InsecureSkipVerify bool          // Disables verification of the server's certificate.
+	Client             *http.Client  // If set, used as is instead of the settings above.
+	Dialect            *Dialect      // Dialect of the configuration; DefaultDialect if nil.
+}
+
+func (opts URLOptions) client() *http.Client {
+	if opts.Client != nil {
+		return opts.Client
+	}
+
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	config := opts.TLSConfig
+	if opts.InsecureSkipVerify {
+		if config == nil {
+			config = new(tls.Config)
+		} else {
+			config = config.Clone()
+		}
+		config.InsecureSkipVerify = true
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = config
+
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
+
+// ReadConfigURL fetches a configuration over HTTP(S) and returns a new configuration representation.
+// Include directives and include.path options of the dialect, see Dialect.Includes,
+// are reported as a ReadError with the reason IncludeRefused, as they would read
+// local files named by the server.
+func ReadConfigURL(url string, opts URLOptions) (*ConfigFile, error) {
+	return ReadConfigURLContext(context.Background(), url, opts)
+}
+
+// ReadConfigURLContext fetches a configuration as ReadConfigURL does, but gives
+// up when ctx is done, in addition to the timeout of opts.
+func ReadConfigURLContext(ctx context.Context, url string, opts URLOptions) (*ConfigFile, error) {
+	c, _, err := NewURLSource(url, opts).FetchContext(ctx)
+	return c, err
+}
+
+// URLSource fetches a configuration over HTTP(S) repeatedly, using the ETag and
+// Last-Modified headers of the previous response to avoid transferring and
+// parsing the configuration again if it has not changed. Includes are refused
+// as by ReadConfigURL.
+type URLSource struct {
+	url     string
+	client  *http.Client
+	dialect []Dialect
+
+	mu           sync.Mutex
+	etag         string
+	lastModified string
+	current      *ConfigFile
+}
+
+// NewURLSource creates a source for the configuration at url.
+func NewURLSource(url string, opts URLOptions) *URLSource {
+	s := &URLSource{url: url, client: opts.client()}
+	if opts.Dialect != nil {
+		s.dialect = []Dialect{*opts.Dialect}
+	}
+	return s
+}
+
+// Fetch returns the configuration at the source's URL. If the server reports
+// that it has not changed since the previous fetch, the previously returned
+// configuration is returned again and changed is false.
+func (s *URLSource) Fetch() (c *ConfigFile, changed bool, err error) {
+	return s.FetchContext(context.Background())
+}
+
+// FetchContext fetches the configuration as Fetch does, but gives up when ctx
+// is done.
+func (s *URLSource) FetchContext(ctx context.Context) (c *ConfigFile, changed bool, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", s.url, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	if s.current != nil {
+		if s.etag != "" {
+			req.Header.Set("If-None-Match", s.etag)
+		}
+		if s.lastModified != "" {
+			req.Header.Set("If-Modified-Since", s.lastModified)
+		}
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, false, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified && s.current != nil:
+		return s.current, false, nil
+	case resp.StatusCode != http.StatusOK:
+		return nil, false, fmt.Errorf("fetching config %s: %s", s.url, resp.Status)
+	}
+
+	c = newConfigFile(s.dialect)
+	c.noIncludes = true
+	if err = c.read(resp.Body, s.url); err != nil {
+		return nil, false, err
+	}
+	s.current = c
+	s.etag = resp.Header.Get("ETag")
+	s.lastModified = resp.Header.Get("Last-Modified")
+
+	return c, true, nil
+}
+
+// Poller periodically fetches a configuration, see URLSource.Poll.
+type Poller struct {
+	stop chan bool
+	done chan bool
+}
+
+// Poll fetches the configuration every interval and calls fn with it whenever it
+// has changed, or with the error if fetching it failed. fn is called from the
+// poller's goroutine, never concurrently with itself.
+func (s *URLSource) Poll(interval time.Duration, fn func(newCfg *ConfigFile, err error)) *Poller {
+	p := &Poller{make(chan bool), make(chan bool)}
+
+	go func() {
+		defer close(p.done)
+		for {
+			select {
+			case <-p.stop:
+				return
+			case <-time.After(interval):
+			}
+
+			c, changed, err := s.Fetch()
+			if err != nil || changed {
+				metrics.ConfigReloaded(err)
+			}
+			if err != nil {
+				fn(nil, err)
+			} else if changed {
+				fn(c, nil)
+			}
+		}
+	}()
+
+	return p
+}
+
+// Close stops the poller. No callbacks are made once Close returns.
+func (p *Poller) Close() {
+	close(p.stop)
+	<-p.done
+}
@@ -0,0 +1,162 @@
+package conf_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/akrennmair/goconf"
+)
+
+func TestURLSource(t *testing.T) {
+	requests := 0
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte(confFile))
+	}))
+	defer ts.Close()
+
+	if _, err := ReadConfigURL(ts.URL, URLOptions{}); err == nil {
+		t.Error("fetching from a server with an unknown certificate succeeded")
+	}
+
+	s := NewURLSource(ts.URL, URLOptions{Client: ts.Client()})
+	c, changed, err := s.Fetch()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if ans, _ := c.GetInt("service-1", "port"); !changed || ans != 443 {
+		t.Errorf("first fetch: changed %v, port %d; want true, 443", changed, ans)
+	}
+
+	c2, changed, err := s.Fetch()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if changed || c2 != c {
+		t.Error("unchanged configuration reported as changed")
+	}
+	if requests != 2 {
+		t.Errorf("server received %d requests; want 2", requests)
+	}
+}
+
+func TestURLIncludes(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("[include]\n\tpath = /etc/passwd\n"))
+	}))
+	defer ts.Close()
+
+	d := GitDialect
+	if _, err := ReadConfigURL(ts.URL, URLOptions{Dialect: &d}); !errors.Is(err, ErrIncludeRefused) {
+		t.Errorf("ReadConfigURL of a file with includes returned %v; want ErrIncludeRefused", err)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	c, err := ReadConfigBytes([]byte(confFile))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	c.AddOption("service-1", "password", "hunter2")
+	c.SetDefault("service-1", "timeout", "30")
+	if err = c.SetEncryptionKey(bytes.Repeat([]byte{1}, 32)); err != nil {
+		t.Fatal(err.Error())
+	}
+	if err = c.SetSecret("db", "dsn", "postgres://u:hunter2@h/db"); err != nil {
+		t.Fatal(err.Error())
+	}
+	c.SetCommandSubstitution(true)
+	c.AddOption("db", "user", "$(whoami)")
+
+	h := NewHandler(c)
+	h.Authorize = func(r *http.Request) bool { return r.Header.Get("Authorization") == "Bearer ok" }
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "?format=json")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	var sections map[string]map[string]string
+	err = json.NewDecoder(resp.Body).Decode(&sections)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if sections["service-1"]["port"] != "443" || sections["service-1"]["password"] != "********" ||
+		sections["service-1"]["url"] != "http://%(host)s/something" || sections["service-1"]["timeout"] != "30" ||
+		sections["db"]["dsn"] != "********" || sections["db"]["user"] != "$(whoami)" {
+		t.Errorf("unexpected JSON configuration: %v", sections)
+	}
+	if len(c.UnusedOptions()) == 0 {
+		t.Error("serving the configuration marked its options as used")
+	}
+
+	for _, auth := range []string{"Bearer wrong", "Bearer ok"} {
+		req, _ := http.NewRequest("PUT", ts.URL+"?section=service-1&option=port", strings.NewReader("8443"))
+		req.Header.Set("Authorization", auth)
+		if resp, err = http.DefaultClient.Do(req); err != nil {
+			t.Fatal(err.Error())
+		}
+		resp.Body.Close()
+	}
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("authorized PUT returned %s", resp.Status)
+	}
+	if port, _ := h.Config().GetInt("service-1", "port"); port != 8443 {
+		t.Errorf("port after PUT = %d; want 8443", port)
+	}
+	if port, _ := c.GetInt("service-1", "port"); port != 443 {
+		t.Errorf("port of the configuration served before = %d; want 443", port)
+	}
+}
+
+// blockingReader blocks until unblock is closed.
+type blockingReader struct {
+	unblock chan bool
+}
+
+func (r blockingReader) Read(p []byte) (int, error) {
+	<-r.unblock
+	return 0, io.EOF
+}
+
+func TestReadContext(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	r := blockingReader{make(chan bool)}
+	defer close(r.unblock)
+	if err := NewConfigFile().ReadContext(ctx, r); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("c.ReadContext() of a blocking reader returned %v", err)
+	}
+
+	c := NewConfigFile()
+	if err := c.ReadContext(context.Background(), strings.NewReader(confFile)); err != nil {
+		t.Fatal(err)
+	}
+	if port, _ := c.GetInt("service-1", "port"); port != 443 {
+		t.Errorf("port = %d; want 443", port)
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done() // never answers
+	}))
+	defer ts.Close()
+	if _, err := ReadConfigURLContext(ctx, ts.URL, URLOptions{}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("ReadConfigURLContext() of a server not answering returned %v", err)
+	}
+}
@@ -0,0 +1,170 @@
+package conf
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// UserConfigPaths returns the paths LoadUserConfig searches for the
+// configuration of the application, highest priority first:
+//
+//	$XDG_CONFIG_HOME/appname/appname.conf
+//	~/.config/appname/appname.conf
+//	/etc/appname/appname.conf              (not on Windows)
+//	%APPDATA%\appname\appname.conf         (on Windows)
+//
+// Locations whose variables are not set are left out.
+func UserConfigPaths(appname string) (paths []string) {
+	var dirs []string
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		dirs = append(dirs, dir)
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		dirs = append(dirs, filepath.Join(home, ".config"))
+	}
+	if runtime.GOOS == "windows" {
+		if dir := os.Getenv("APPDATA"); dir != "" {
+			dirs = append(dirs, dir)
+		}
+	} else {
+		dirs = append(dirs, "/etc")
+	}
+
+	seen := make(map[string]bool, len(dirs))
+	for _, dir := range dirs {
+		path := filepath.Join(dir, appname, appname+".conf")
+		if !seen[path] {
+			seen[path] = true
+			paths = append(paths, path)
+		}
+	}
+
+	return paths
+}
+
+// LoadUserConfig reads the configuration of the application from the paths
+// returned by UserConfigPaths and merges the files it finds, so that options
+// in files of higher priority, such as a user's, override those in files of
+// lower priority, such as the system-wide one. Source reports the file each
+// option came from. It returns the configuration and the paths of the files
+// read, highest priority first; if none is found, the configuration is empty.
+// Files which exist but cannot be read are reported as errors.
+func LoadUserConfig(appname string) (c *ConfigFile, paths []string, err error) {
+	c = NewConfigFile()
+	candidates := UserConfigPaths(appname)
+	for i := len(candidates) - 1; i >= 0; i-- {
+		if _, err := os.Stat(candidates[i]); errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		found, err := ReadConfigFile(candidates[i])
+		if err != nil {
+			return nil, nil, err
+		}
+		if err = c.merge(found); err != nil {
+			return nil, nil, err
+		}
+		paths = append([]string{candidates[i]}, paths...)
+	}
+
+	return c, paths, nil
+}
+
+// EnsureConfigFile returns the configuration in the file at path, creating the
+// file on first run. If the file does not exist, it is created with the given
+// permissions, listing the options of defaults commented out for the user to
+// edit, and the configuration returned is a clone of defaults. Otherwise the file is read and merged into a clone of defaults, so
+// that options missing from the file keep their defaults. The file is created
+// atomically: other processes either find no file or a complete one, and an
+// existing file is never replaced. It returns whether the file was created.
+func EnsureConfigFile(path string, defaults *ConfigFile, perm uint32) (c *ConfigFile, created bool, err error) {
+	c = defaults.Clone()
+
+	found, err := ReadConfigFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		if created, err = createConfigFile(path, defaults, perm); err != nil || created {
+			return c, created, err
+		}
+		found, err = ReadConfigFile(path) // created by another process meanwhile
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if err = c.merge(found); err != nil {
+		return nil, false, err
+	}
+
+	return c, false, nil
+}
+
+// createConfigFile writes the commented options of defaults to a temporary file
+// and links it to path. It returns false if path exists by then.
+func createConfigFile(path string, defaults *ConfigFile, perm uint32) (created bool, err error) {
+	defer wrapWriteError(path, &err)
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return false, err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.Write(defaults.commentedBytes()); err != nil {
+		tmp.Close()
+		return false, err
+	}
+	if err = tmp.Chmod(os.FileMode(perm)); err != nil {
+		tmp.Close()
+		return false, err
+	}
+	if err = tmp.Close(); err != nil {
+		return false, err
+	}
+
+	if err = os.Link(tmp.Name(), path); errors.Is(err, fs.ErrExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// commentedBytes returns the configuration with its options commented out.
+func (c *ConfigFile) commentedBytes() []byte {
+	buf := bytes.NewBuffer(nil)
+
+	buf.WriteString("# Default configuration. Uncomment options to change them.\n")
+	for _, section := range c.sections {
+		s := c.data[section]
+		if section == DefaultSection && s.len() == 0 {
+			continue
+		}
+		buf.WriteString("\n[" + section + "]\n")
+		for _, option := range s.keys() {
+			value, _ := s.get(option)
+			buf.WriteString("# " + option + " = " + strings.ReplaceAll(value, "\n", "\n#   ") + "\n")
+		}
+	}
+
+	return buf.Bytes()
+}
+
+// merge adds the sections and options of other to the configuration, replacing
+// the values of options it already has. Where options were read from is kept.
+func (c *ConfigFile) merge(other *ConfigFile) error {
+	for _, section := range other.sections {
+		c.AddSection(section)
+		s := other.data[section]
+		for _, option := range s.keys() {
+			value, _ := s.get(option)
+			if _, err := c.addOption(section, option, value); err != nil {
+				return err
+			}
+			if loc, ok := s.location(option); ok {
+				c.setLocation(section, option, loc)
+			}
+		}
+	}
+
+	return nil
+}
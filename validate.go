@@ -0,0 +1,36 @@
+package conf
+
+// SetValidator sets a function checking the values set for the option in the
+// section, so that AddOption, SetOption, Read and the other ways of setting
+// options reject invalid values when they are set rather than when they are
+// eventually read. A nil function removes the validator. Values already set
+// are not checked.
+func (c *ConfigFile) SetValidator(section string, option string, fn func(value string) error) {
+	key := cacheKey{c.foldSection(section), c.foldOption(option)}
+
+	if fn == nil {
+		delete(c.validators, key)
+		return
+	}
+	if c.validators == nil {
+		c.validators = make(map[cacheKey]func(string) error)
+	}
+	c.validators[key] = fn
+}
+
+// validate checks the value of the option in the section with its validator.
+func (c *ConfigFile) validate(section string, option string, value string) error {
+	if c.validators == nil {
+		return nil
+	}
+	section, option = c.foldSection(section), c.foldOption(option)
+
+	if fn := c.validators[cacheKey{section, option}]; fn != nil {
+		if err := fn(value); err != nil {
+			metrics.ValidationFailed(section, option)
+			return SetError{InvalidValue, value, section, option, err}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,130 @@
+package conf
+
+import (
+	"os"
+	"time"
+)
+
+// WatchOptions configures a Watcher.
+type WatchOptions struct {
+	Interval time.Duration           // How often the file is checked for changes; 1s if zero.
+	Debounce time.Duration           // How long a changed file must stay unchanged before it is read; 100ms if zero.
+	Validate func(*ConfigFile) error // If set, reloaded configurations are only delivered if they pass.
+	OnChange func([]Change)          // If set, called with the options changed by each delivered reload.
+}
+
+// Watcher monitors a configuration file and delivers a freshly read
+// configuration whenever the file changes.
+type Watcher struct {
+	path string
+	r    *reparser
+	opts WatchOptions
+	fn   func(*ConfigFile, error)
+	stop chan bool
+	done chan bool
+}
+
+// Watch starts monitoring the configuration file at path with default options,
+// see WatchWithOptions.
+func Watch(path string, fn func(newCfg *ConfigFile, err error)) (*Watcher, error) {
+	return WatchWithOptions(path, WatchOptions{}, fn)
+}
+
+// WatchWithOptions starts monitoring the configuration file at path by polling
+// its modification time and size. When the file changes, it is read once it has
+// stayed unchanged for opts.Debounce, and fn is called with the new configuration.
+// If the file cannot be read, parsed or validated, fn is called with the error
+// instead and the caller should keep using its current configuration.
+//
+// Only the sections whose text changed are parsed again; the others are shared
+// with the previously delivered configuration until either is modified.
+// Reloads which change no option, e.g. because only comments were edited, are
+// not delivered. Otherwise opts.OnChange, if set, is called with the changed
+// options before fn.
+//
+// fn is called from the watcher's goroutine, never concurrently with itself.
+// The current contents of the file are not delivered; read them with
+// ReadConfigFile before or after starting the watcher.
+func WatchWithOptions(path string, opts WatchOptions, fn func(newCfg *ConfigFile, err error)) (*Watcher, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = time.Second
+	}
+	if opts.Debounce <= 0 {
+		opts.Debounce = 100 * time.Millisecond
+	}
+
+	w := &Watcher{path, &reparser{fname: path}, opts, fn, make(chan bool), make(chan bool)}
+	if _, _, err = w.r.read(); err == nil {
+		w.r.accept() // compare reloads with the current contents
+	}
+	go w.run(fi)
+
+	return w, nil
+}
+
+// Close stops the watcher. No callbacks are made once Close returns.
+func (w *Watcher) Close() {
+	close(w.stop)
+	<-w.done
+}
+
+func (w *Watcher) run(last os.FileInfo) {
+	defer close(w.done)
+
+	pending := false // whether a change waits for the debounce period to pass
+	var lastErr error
+	for {
+		wait := w.opts.Interval
+		if pending {
+			wait = w.opts.Debounce
+		}
+		select {
+		case <-w.stop:
+			return
+		case <-time.After(wait):
+		}
+
+		fi, err := os.Stat(w.path)
+		if err != nil {
+			if lastErr == nil || lastErr.Error() != err.Error() {
+				w.fn(nil, err)
+			}
+			lastErr, last, pending = err, nil, false
+			continue
+		}
+		lastErr = nil
+
+		if last == nil || !fi.ModTime().Equal(last.ModTime()) || fi.Size() != last.Size() {
+			last, pending = fi, true // changed again, restart the debounce period
+			continue
+		}
+		if !pending {
+			continue
+		}
+		pending = false
+
+		c, changes, err := w.r.read()
+		if err == nil && w.opts.Validate != nil {
+			if err = w.opts.Validate(c); err != nil {
+				metrics.ValidationFailed("", "")
+			}
+		}
+		metrics.ConfigReloaded(err)
+		if err != nil {
+			w.fn(nil, err)
+			continue
+		}
+		w.r.accept()
+		if len(changes) == 0 {
+			continue
+		}
+		if w.opts.OnChange != nil {
+			w.opts.OnChange(changes)
+		}
+		w.fn(c, nil)
+	}
+}
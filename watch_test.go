@@ -0,0 +1,156 @@
+package conf_test
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	. "github.com/akrennmair/goconf"
+)
+
+func TestWatch(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "watch.conf")
+	if err := os.WriteFile(fname, []byte("port = 1\n"), 0644); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	type result struct {
+		c   *ConfigFile
+		err error
+	}
+	results := make(chan result, 10)
+	opts := WatchOptions{
+		Interval: 10 * time.Millisecond,
+		Debounce: 20 * time.Millisecond,
+		Validate: func(c *ConfigFile) error {
+			_, err := c.GetInt("", "port")
+			return err
+		},
+	}
+	w, err := WatchWithOptions(fname, opts, func(c *ConfigFile, err error) { results <- result{c, err} })
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer w.Close()
+
+	next := func() result {
+		select {
+		case r := <-results:
+			return r
+		case <-time.After(5 * time.Second):
+			t.Fatal("no reload after change")
+		}
+		return result{}
+	}
+
+	if err := os.WriteFile(fname, []byte("port = 22\n"), 0644); err != nil {
+		t.Fatal(err.Error())
+	}
+	if r := next(); r.err != nil {
+		t.Error("reload returned error: " + r.err.Error())
+	} else if port, _ := r.c.GetInt("", "port"); port != 22 {
+		t.Errorf("reloaded port = %d; want 22", port)
+	}
+
+	if err := os.WriteFile(fname, []byte("port = twenty\n"), 0644); err != nil {
+		t.Fatal(err.Error())
+	}
+	if r := next(); r.err == nil {
+		t.Error("reload of an invalid configuration returned no error")
+	}
+}
+
+func TestReloader(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "reload.conf")
+	if err := os.WriteFile(fname, []byte("port = 1\n"), 0644); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	r, err := NewReloader(fname)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	r.Validate = func(c *ConfigFile) error {
+		_, err := c.GetInt("", "port")
+		return err
+	}
+	old := r.Load()
+
+	if err := os.WriteFile(fname, []byte("port = 2\n"), 0644); err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := r.Reload(); err != nil {
+		t.Fatal(err.Error())
+	}
+	if port, _ := r.Load().GetInt("", "port"); port != 2 {
+		t.Errorf("reloaded port = %d; want 2", port)
+	}
+	if port, _ := old.GetInt("", "port"); port != 1 {
+		t.Errorf("previously loaded port = %d; want 1", port)
+	}
+
+	if err := os.WriteFile(fname, []byte("port = two\n"), 0644); err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := r.Reload(); err == nil {
+		t.Error("reload of an invalid configuration returned no error")
+	}
+	if port, _ := r.Load().GetInt("", "port"); port != 2 {
+		t.Errorf("port after failed reload = %d; want 2", port)
+	}
+}
+
+func TestWatchChanges(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "watch.conf")
+	write := func(data string) {
+		if err := os.WriteFile(fname, []byte(data), 0644); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+	write("[service-1]\nhost = localhost\nport = 443\n[service-2]\nhost = example.com\n")
+
+	type result struct {
+		c       *ConfigFile
+		changes []Change
+	}
+	results := make(chan result, 10)
+	var changes []Change
+	opts := WatchOptions{
+		Interval: 10 * time.Millisecond,
+		Debounce: 20 * time.Millisecond,
+		OnChange: func(c []Change) { changes = c },
+	}
+	w, err := WatchWithOptions(fname, opts, func(c *ConfigFile, err error) {
+		if err != nil {
+			t.Error(err)
+		}
+		results <- result{c, changes}
+	})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer w.Close()
+
+	write("# comments only\n[service-1]\nhost = localhost\nport = 443\n[service-2]\nhost = example.com\n")
+	time.Sleep(200 * time.Millisecond)
+	write("# comments only\n[service-1]\nhost = localhost\nport = 8443\n[service-2]\nhost = example.com\n[service-3]\n")
+
+	var r result
+	select {
+	case r = <-results:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no reload after change")
+	}
+	want := []Change{{OptionModified, "service-1", "port", "443", "8443"}}
+	if !reflect.DeepEqual(r.changes, want) {
+		t.Errorf("changes = %v, want %v", r.changes, want)
+	}
+	if loc, ok := r.c.Source("service-2", "host"); !ok || loc.Line != 6 {
+		t.Errorf("r.c.Source(\"service-2\",\"host\") = %v, %v", loc, ok)
+	}
+	if !r.c.HasSection("service-3") {
+		t.Error("section service-3 missing")
+	}
+}
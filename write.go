@@ -2,57 +2,87 @@ package conf
 
 import (
 	"bytes"
+	"fmt"
 	"io"
 	"os"
+	"strings"
 )
 
 // WriteConfigFile saves the configuration representation to a file.
-// The desired file permissions must be passed as in os.Open.
-// The header is a string that is saved as a comment in the first line of the file.
-func (c *ConfigFile) WriteConfigFile(fname string, perm uint32, header string) (err error) {
+// The desired file permissions must be passed as in os.OpenFile; they apply
+// if the file is created.
+// The header is a string that is saved as comments in the first lines of the
+// file, each of its lines commented out; HeaderOptions composes the headers of
+// generated files.
+// The file is written in the dialect given, if any, and else in the dialect of
+// the configuration, see SetDialect; in another dialect, lines kept in document
+// mode are not written.
+// Errors are prefixed with the file name; the underlying error can be
+// inspected with errors.Is and errors.As.
+func (c *ConfigFile) WriteConfigFile(fname string, perm uint32, header string, dialect ...Dialect) (err error) {
+	defer wrapWriteError(fname, &err)
+
 	var file *os.File
 
-	if file, err = os.Create(fname); err != nil {
+	if file, err = os.OpenFile(fname, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, os.FileMode(perm)); err != nil {
 		return err
 	}
-	if err = c.Write(file, header); err != nil {
+	if err = c.Write(file, header, dialect...); err != nil {
+		file.Close()
 		return err
 	}
 
 	return file.Close()
 }
 
-// WriteConfigBytes returns the configuration file.
-func (c *ConfigFile) WriteConfigBytes(header string) (config []byte) {
+// WriteConfigBytes returns the configuration file, in the dialect given as by
+// WriteConfigFile.
+func (c *ConfigFile) WriteConfigBytes(header string, dialect ...Dialect) (config []byte) {
 	buf := bytes.NewBuffer(nil)
 
-	c.Write(buf, header)
+	c.Write(buf, header, dialect...)
 
 	return buf.Bytes()
 }
 
-// Writes the configuration file to the io.Writer.
-func (c *ConfigFile) Write(writer io.Writer, header string) (err error) {
+// Writes the configuration file to the io.Writer, in the dialect given as by
+// WriteConfigFile.
+func (c *ConfigFile) Write(writer io.Writer, header string, dialect ...Dialect) (err error) {
+	return c.write(writer, header, dialect, nil)
+}
+
+// write implements Write, writing in the last of the dialects, if any, and
+// passing every value through filter if it is not nil.
+func (c *ConfigFile) write(writer io.Writer, header string, dialect []Dialect, filter func(section, option, value string) string) (err error) {
 	buf := bytes.NewBuffer(nil)
 
+	d, document := c.dialect, c.document && len(c.doc) > 0
+	if len(dialect) > 0 { // lines kept in document mode are in the dialect of c
+		d, document = dialect[len(dialect)-1], false
+	}
+	if document {
+		c.writeDocument(buf, filter)
+		_, err = buf.WriteTo(writer)
+		return err
+	}
+
 	if header != "" {
-		if _, err = buf.WriteString("# " + header + "\n"); err != nil {
+		if _, err = buf.WriteString(d.formatHeader(header)); err != nil {
 			return err
 		}
 	}
 
-	for section, sectionmap := range c.data {
-		if section == DefaultSection && len(sectionmap) == 0 {
+	for _, section := range c.sections {
+		sectionmap := c.data[section]
+		if section == DefaultSection && sectionmap.len() == 0 {
 			continue // skip default section if empty
 		}
-		if _, err = buf.WriteString("[" + section + "]\n"); err != nil {
-			return err
-		}
-		for option, value := range sectionmap {
-			if _, err = buf.WriteString(option + "=" + value + "\n"); err != nil {
+		if d.syntax != phpSyntax || section != DefaultSection {
+			if _, err = buf.WriteString(d.formatSection(section) + "\n"); err != nil {
 				return err
 			}
 		}
+		c.formatOptions(buf, d, section, "\n", filter)
 		if _, err = buf.WriteString("\n"); err != nil {
 			return err
 		}
@@ -62,3 +92,62 @@ func (c *ConfigFile) Write(writer io.Writer, header string) (err error) {
 
 	return nil
 }
+
+// formatOptions writes the options of the section in the dialect, lines
+// terminated by eol, passing every value through filter if it is not nil.
+func (c *ConfigFile) formatOptions(buf *bytes.Buffer, d Dialect, section string, eol string, filter func(section, option, value string) string) {
+	s := c.data[section]
+	for _, option := range s.keys() {
+		value := s.values[option]
+		if filter != nil {
+			value = filter(section, option, value)
+		}
+		buf.WriteString(d.formatOption(option, value, eol) + eol)
+	}
+}
+
+// formatSection returns the header of the section as written.
+func (d Dialect) formatSection(section string) string {
+	if d.syntax == gitSyntax {
+		return gitHeader(section)
+	}
+	if d.syntax == pythonSyntax && section == DefaultSection {
+		section = "DEFAULT"
+	}
+	return "[" + section + "]"
+}
+
+// formatOption returns the option with its value as written, the lines of
+// the value separated by eol.
+func (d Dialect) formatOption(option string, value string, eol string) string {
+	if d.syntax == gitSyntax {
+		return "\t" + option + " = " + gitQuote(value, d.Escapes)
+	}
+	return d.escapeName(option) + d.delimiter() + d.formatValue(option, value, eol)
+}
+
+// formatValue returns the value of the option as written after the delimiter,
+// its lines separated by eol.
+func (d Dialect) formatValue(option string, value string, eol string) string {
+	if d.syntax == gitSyntax {
+		return gitQuote(value, d.Escapes)
+	}
+	// a double quote left open by the name would turn the quotes around
+	if d.InlineComments != QuotedInlineComments || !opensQuote(d.escapeName(option)) {
+		value = d.escapeValue(value)
+	}
+	switch {
+	case d.Duplicates == DuplicatesAppend:
+		return strings.Replace(value, "\n", eol+d.escapeName(option)+d.delimiter(), -1)
+	case d.Continuation == ContinueIndented:
+		return strings.Replace(value, "\n", eol+"\t", -1)
+	}
+	return strings.Replace(value, "\n", eol, -1)
+}
+
+// wrapWriteError prefixes a non-nil *err with the name of the file being written.
+func wrapWriteError(fname string, err *error) {
+	if *err != nil {
+		*err = fmt.Errorf("writing config %s: %w", fname, *err)
+	}
+}